@@ -0,0 +1,189 @@
+package kece
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// AOFFsyncAlways constanta, fsync after every write
+	AOFFsyncAlways = "always"
+	// AOFFsyncEverySec constanta, fsync once every second
+	AOFFsyncEverySec = "everysec"
+	// AOFFsyncNo constanta, let operating system decide when to flush
+	AOFFsyncNo = "no"
+)
+
+var aofFsyncPolicies = map[string]bool{
+	AOFFsyncAlways:   true,
+	AOFFsyncEverySec: true,
+	AOFFsyncNo:       true,
+}
+
+// appendOnlyFile will log every mutating command in wire format
+type appendOnlyFile struct {
+	file  *os.File
+	fsync string
+
+	// db is database of the last written command, command of other database is preceded by SELECT
+	db int
+	sync.Mutex
+}
+
+func openAppendOnlyFile(path, fsync string) (*appendOnlyFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &appendOnlyFile{file: file, fsync: fsync}, nil
+}
+
+// Write will append a single command of database db to file, RESP array is written as is
+func (aof *appendOnlyFile) Write(db int, line []byte) error {
+	aof.Lock()
+	defer aof.Unlock()
+
+	if db != aof.db {
+		if _, err := aof.file.Write(selectCommand(db)); err != nil {
+			return err
+		}
+		aof.db = db
+	}
+
+	if _, err := aof.file.Write(commandLine(line)); err != nil {
+		return err
+	}
+
+	if aof.fsync == AOFFsyncAlways {
+		return aof.file.Sync()
+	}
+	return nil
+}
+
+// Sync will flush written commands to disk
+func (aof *appendOnlyFile) Sync() error {
+	aof.Lock()
+	defer aof.Unlock()
+	return aof.file.Sync()
+}
+
+// Close will flush and close the file
+func (aof *appendOnlyFile) Close() error {
+	aof.Lock()
+	defer aof.Unlock()
+
+	if err := aof.file.Sync(); err != nil {
+		return err
+	}
+	return aof.file.Close()
+}
+
+// commandLine return command in the form it is logged and streamed to replicas,
+// kece line is terminated by CR/LF and RESP array is kept as is
+func commandLine(raw []byte) []byte {
+	if isFrame(raw) {
+		return raw
+	}
+
+	trimmed := bytes.TrimSpace(raw)
+	line := make([]byte, 0, len(trimmed)+len(crlf))
+	line = append(line, trimmed...)
+	return append(line, crlf...)
+}
+
+// durableLines will return commands of cm in the form they are logged to append only file. Lifetime is relative
+// to now, so command setting lifetime is logged with its deadline by PEXPIREAT, otherwise key replayed after
+// its deadline would come back with a fresh lifetime
+func durableLines(cm *ClientMessage, now time.Time) [][]byte {
+	unit := time.Millisecond
+	switch string(cm.Cmd) {
+	case commands["EXPIRE"], commands["SETEX"], commands["RESTORE"]:
+		unit = time.Second
+	case commands["PEXPIRE"], commands["PSETEX"]:
+	case commands["SET"]:
+		if cm.Exp == 0 {
+			return [][]byte{cm.Raw}
+		}
+		return [][]byte{
+			respProtocol{}.Array([][]byte{[]byte("SET"), cm.Key, cm.Value}),
+			expireAtCommand(cm.Key, now.Add(cm.Exp)),
+		}
+	default:
+		return [][]byte{cm.Raw}
+	}
+
+	lifetime, err := strconv.ParseInt(string(cm.Args[1]), 10, 64)
+	if err != nil {
+		return [][]byte{cm.Raw}
+	}
+
+	exp, ok := lifetimeDuration(lifetime, unit)
+	if !ok {
+		return [][]byte{cm.Raw}
+	}
+	deadline := expireAtCommand(cm.Key, now.Add(exp))
+
+	switch string(cm.Cmd) {
+	case commands["SETEX"], commands["PSETEX"]:
+		return [][]byte{respProtocol{}.Array([][]byte{[]byte("SET"), cm.Key, cm.Value}), deadline}
+	case commands["RESTORE"]:
+		// zero lifetime of RESTORE means no lifetime
+		if lifetime == 0 {
+			return [][]byte{cm.Raw}
+		}
+
+		restore := append([][]byte{[]byte("RESTORE"), cm.Key, []byte("0")}, cm.Args[2:]...)
+		return [][]byte{respProtocol{}.Array(restore), deadline}
+	}
+	return [][]byte{deadline}
+}
+
+// expireAtCommand return PEXPIREAT of key at deadline in the form it is logged
+func expireAtCommand(key []byte, deadline time.Time) []byte {
+	// UnixNano overflows after year 2262, lifetime can be longer
+	milliseconds := deadline.Unix()*1000 + int64(deadline.Nanosecond())/int64(time.Millisecond)
+	return respProtocol{}.Array([][]byte{[]byte("PEXPIREAT"), key, []byte(strconv.FormatInt(milliseconds, 10))})
+}
+
+// selectCommand return SELECT of database db in the form it is logged and streamed to replicas
+func selectCommand(db int) []byte {
+	return respProtocol{}.Array([][]byte{[]byte("SELECT"), []byte(strconv.Itoa(db))})
+}
+
+// readAppendOnlyFile will return every command in path, missing file is not an error
+func readAppendOnlyFile(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	reader := bufio.NewReader(f)
+	for {
+		// kece line is read the same way as RESP inline command
+		line, _, err := readFrame(reader)
+		if !isFrame(line) {
+			line = bytes.TrimSpace(line)
+		}
+
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package kece
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendOnlyFile(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "kece-aof")
+	if err != nil {
+		t.Fatalf("error create temp dir %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kece.aof")
+
+	t.Run("should rebuild keyspace by replaying append only file", func(t *testing.T) {
+		args := &Arguments{AOFPath: path, AOFFsync: AOFFsyncAlways}
+		server := NewServer(args, NewCommander(newStructureMock()))
+
+		if err := server.restore(); err != nil {
+			t.Fatalf("error restore %s", err.Error())
+		}
+
+		if err := server.openAppendOnly(); err != nil {
+			t.Fatalf("error open append only file %s", err.Error())
+		}
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		for _, message := range []string{`SET 1 "wuriyanto 48"`, "SET 2 agung", "GET 1", "DEL 2", "INCR counter"} {
+			processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)})
+		}
+
+		// server is killed without shutdown, so only fsync policy protect the commands
+		lines, err := readAppendOnlyFile(path)
+		if err != nil {
+			t.Fatalf("error read append only file %s", err.Error())
+		}
+
+		if len(lines) != 4 {
+			t.Errorf("only mutating commands should be logged, got %d lines", len(lines))
+		}
+
+		restartedCmd := NewCommander(newStructureMock())
+		restarted := NewServer(args, restartedCmd)
+
+		if err := restarted.restore(); err != nil {
+			t.Fatalf("error restore %s", err.Error())
+		}
+
+		value, err := restartedCmd.Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(value.Value) != "wuriyanto 48" {
+			t.Error("key 1 should be present after replay")
+		}
+
+		if _, err := restartedCmd.Get(ctx, []byte("GET"), []byte("2")); err == nil {
+			t.Error("deleted key 2 should not be present after replay")
+		}
+
+		value, err = restartedCmd.Get(ctx, []byte("GET"), []byte("counter"))
+		if err != nil || string(value.Value) != "1" {
+			t.Error("counter should be present after replay")
+		}
+	})
+
+	t.Run("should replay commands into their database", func(t *testing.T) {
+		args := &Arguments{AOFPath: filepath.Join(dir, "databases.aof"), AOFFsync: AOFFsyncAlways, Databases: 2}
+
+		// every session ends in database 1, so the next session must select database 0 again
+		for _, value := range []string{"first", "second"} {
+			server := NewServer(args, NewCommander(newStructureMock()))
+			if err := server.restore(); err != nil {
+				t.Fatalf("error restore %s", err.Error())
+			}
+
+			if err := server.openAppendOnly(); err != nil {
+				t.Fatalf("error open append only file %s", err.Error())
+			}
+
+			serverConn, clientConn := net.Pipe()
+			client := &Client{ID: "001", Conn: serverConn}
+			reader := bufio.NewReader(clientConn)
+
+			for _, message := range []string{"SET 1 " + value, "SELECT 1", "SET 1 agung", "SET " + value + " yes"} {
+				processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)})
+			}
+			clientConn.Close()
+			server.aof.Close()
+		}
+
+		restartedCmd := NewCommander(newStructureMock())
+		restarted := NewServer(args, restartedCmd)
+		if err := restarted.restore(); err != nil {
+			t.Fatalf("error restore %s", err.Error())
+		}
+
+		value, err := restartedCmd.Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(value.Value) != "second" {
+			t.Error("key of database 0 should be replayed into database 0")
+		}
+
+		for _, key := range []string{"first", "second"} {
+			if exist, _ := restartedCmd.Exists(ctx, []byte("EXISTS"), []byte(key)); exist {
+				t.Errorf("key %s of database 1 should not be in database 0", key)
+			}
+
+			if exist, _ := restarted.databases[1].Exists(ctx, []byte("EXISTS"), []byte(key)); !exist {
+				t.Errorf("key %s should be replayed into database 1", key)
+			}
+		}
+	})
+	t.Run("should keep deadline of keys across restart", func(t *testing.T) {
+		args := &Arguments{AOFPath: filepath.Join(dir, "expire.aof"), AOFFsync: AOFFsyncAlways}
+		server := NewServer(args, NewCommander(newStructureMock()))
+
+		if err := server.openAppendOnly(); err != nil {
+			t.Fatalf("error open append only file %s", err.Error())
+		}
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		messages := []string{
+			"SET expire wuriyanto", "PEXPIRE expire 100",
+			"PSETEX psetex 100 wuriyanto",
+			"SET live wuriyanto", "PEXPIRE live 100000",
+			"SET setex wuriyanto", "SETEX setex 100 agung",
+			"SET far wuriyanto", "EXPIRE far 9200000000",
+		}
+		for _, message := range messages {
+			processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)})
+		}
+		server.aof.Close()
+
+		// restart after the deadline
+		time.Sleep(200 * time.Millisecond)
+
+		restartedCmd := NewCommander(newStructureMock())
+		restarted := NewServer(args, restartedCmd)
+		if err := restarted.restore(); err != nil {
+			t.Fatalf("error restore %s", err.Error())
+		}
+
+		for _, key := range []string{"expire", "psetex"} {
+			if _, err := restartedCmd.Get(ctx, []byte("GET"), []byte(key)); err == nil {
+				t.Errorf("key %s should stay expired after replay", key)
+			}
+		}
+
+		if ttl, err := restartedCmd.PTTL(ctx, []byte("live")); err != nil || ttl <= 0 || ttl > 100000-200 {
+			t.Errorf("lifetime of live key should not be refreshed by replay, got %d", ttl)
+		}
+
+		value, err := restartedCmd.Get(ctx, []byte("GET"), []byte("setex"))
+		if err != nil || string(value.Value) != "agung" {
+			t.Error("value of SETEX should be replayed")
+		}
+
+		if ttl, err := restartedCmd.PTTL(ctx, []byte("setex")); err != nil || ttl <= 0 || ttl > 100000-200 {
+			t.Errorf("lifetime of SETEX should not be refreshed by replay, got %d", ttl)
+		}
+
+		// deadline after year 2262 doesn't fit in unix nanoseconds
+		if ttl, err := restartedCmd.TTL(ctx, []byte("TTL"), []byte("far")); err != nil || ttl <= 0 {
+			t.Errorf("lifetime of far key should be replayed, got %d", ttl)
+		}
+	})
+}
@@ -4,32 +4,147 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"time"
 )
 
 // Arguments struct will hold flag and arguments from stdin
 type Arguments struct {
-	Auth            string
-	Network         string
-	Port            string
-	DataStorageType string
-	ShowVersion     bool
-	Help            func()
+	Auth             string
+	Users            map[string]string
+	ACL              map[string]map[string]bool
+	Network          string
+	Host             string
+	Port             string
+	SocketPath       string
+	AllowedCIDRs     []*net.IPNet
+	DeniedCIDRs      []*net.IPNet
+	Protocol         string
+	LengthPrefixed   bool
+	DataStorageType  string
+	DataFile         string
+	SweepInterval    time.Duration
+	ShutdownTimeout  time.Duration
+	SlowLogThreshold time.Duration
+	SlowLogMaxLen    int
+	HashIterations   int
+	CommandTimeout   time.Duration
+	IdleTimeout      time.Duration
+	WriteTimeout     time.Duration
+	MaxClients       int
+	MaxCommandSize   int
+	KeyValidator     func([]byte) error
+	MaxKeys          int
+	Databases        int
+	Workers          int
+	Shards           int
+	TLSCertFile      string
+	TLSKeyFile       string
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	AOFPath          string
+	AOFFsync         string
+	MetricsAddr      string
+	ReplicaOf        string
+	PrimaryAuth      string
+	ReadOnly         bool
+	DebugEnabled     bool
+	LogLevel         string
+	Logger           Logger
+	NoColor          bool
+	ShowVersion      bool
+	Help             func()
 }
 
 // ParseArgs function, this function will parse flag and arguments from stdin to Arguments struct
 func ParseArgs() (*Arguments, error) {
 	var (
-		auth            string
-		network         string
-		port            string
-		dataStorageType string
-		showVersion     bool
+		auth             string
+		usersFile        string
+		aclFile          string
+		network          string
+		host             string
+		port             string
+		socketPath       string
+		allowedCIDRs     string
+		deniedCIDRs      string
+		protocol         string
+		lengthPrefixed   bool
+		dataStorageType  string
+		dataFile         string
+		sweepInterval    time.Duration
+		shutdownTimeout  time.Duration
+		slowLogThreshold time.Duration
+		slowLogMaxLen    int
+		hashIterations   int
+		idleTimeout      time.Duration
+		writeTimeout     time.Duration
+		commandTimeout   time.Duration
+		maxClients       int
+		maxCommandSize   int
+		keyValidator     string
+		maxKeys          int
+		databases        int
+		workers          int
+		shards           int
+		tlsCertFile      string
+		tlsKeyFile       string
+		snapshotPath     string
+		snapshotInterval time.Duration
+		aofPath          string
+		aofFsync         string
+		metricsAddr      string
+		replicaOf        string
+		primaryAuth      string
+		readOnly         bool
+		debugEnabled     bool
+		logLevel         string
+		noColor          bool
+		showVersion      bool
 	)
 
 	flag.StringVar(&auth, "auth", "", "set server auth eg: -auth my-secret")
+	flag.StringVar(&usersFile, "users", "", "file of users, a username:password per line, client send AUTH username password eg: -users kece.users")
+	flag.StringVar(&aclFile, "acl", "", "file of commands every user may run, a username followed by commands per line eg: -acl kece.acl")
 	flag.StringVar(&network, "net", "tcp", "network type eg: -net tcp")
+	flag.StringVar(&host, "host", "", "interface to bind, empty means every interface eg: -host 127.0.0.1")
 	flag.StringVar(&port, "port", "9000", "port to listen eg: -port 9000")
-	flag.StringVar(&dataStorageType, "ds", HashMap, "data storage type (hashmap or binary tree)")
+	flag.StringVar(&socketPath, "socket", "", "unix socket to listen if network type is unix eg: -net unix -socket /tmp/kece.sock")
+	flag.StringVar(&allowedCIDRs, "allow", "", "comma separated CIDR ranges of client IP allowed to connect, empty means every IP eg: -allow 10.0.0.0/8,127.0.0.1/32")
+	flag.StringVar(&deniedCIDRs, "deny", "", "comma separated CIDR ranges of client IP denied to connect eg: -deny 192.168.1.0/24")
+	flag.StringVar(&protocol, "protocol", ProtocolKece, "wire protocol (kece or resp) eg: -protocol resp")
+	flag.BoolVar(&lengthPrefixed, "length-prefixed", false, "read value of kece protocol by length when the last token is $<length>, so it may contain new lines eg: SET k $11")
+	flag.StringVar(&dataStorageType, "ds", HashMap, "data storage type (hashmap, binary tree or disk)")
+	flag.StringVar(&dataFile, "data-file", DefaultDataFile, "data file of disk data storage eg: -data-file kece.data")
+	flag.DurationVar(&sweepInterval, "sweep", DefaultSweepInterval, "interval of deleting expired keys eg: -sweep 1s")
+	flag.DurationVar(&commandTimeout, "command-timeout", 0, "reply ERROR if command is not done within the duration, 0 means never eg: -command-timeout 1s")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 0, "close client connection after idle for the duration, 0 means never eg: -idle-timeout 5m")
+	flag.IntVar(&maxCommandSize, "max-command-size", DefaultMaxCommandSize, "maximum size of a single command in bytes, client sending larger command is disconnected eg: -max-command-size 1048576")
+	flag.StringVar(&keyValidator, "key-validator", "", "reject key created by command if it is invalid, no-spaces or printable eg: -key-validator printable")
+	flag.DurationVar(&writeTimeout, "write-timeout", 0, "close client connection if it doesn't read reply within the duration, 0 means never eg: -write-timeout 10s")
+	flag.IntVar(&maxClients, "max-clients", 0, "maximum number of connected clients, 0 means unlimited eg: -max-clients 1000")
+	flag.IntVar(&maxKeys, "max-keys", 0, "maximum number of keys, least recently used key is evicted once it is exceeded, 0 means unlimited eg: -max-keys 100000")
+	flag.IntVar(&databases, "databases", DefaultDatabases, "number of logical databases, client switch database by SELECT eg: -databases 16")
+	flag.IntVar(&workers, "workers", 0, "number of goroutines processing messages of every client, 0 means a goroutine per client eg: -workers 8")
+	flag.IntVar(&shards, "shards", 1, "number of shards of keyspace, every shard has its own lock eg: -shards 16")
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "TLS certificate file, TLS is enabled if both -tls-cert and -tls-key are set eg: -tls-cert server.crt")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "TLS private key file eg: -tls-key server.key")
+	flag.StringVar(&snapshotPath, "snapshot", "", "snapshot file of keyspace, loaded on start eg: -snapshot kece.snapshot")
+	flag.DurationVar(&snapshotInterval, "snapshot-interval", DefaultSnapshotInterval, "interval of writing snapshot eg: -snapshot-interval 5m")
+	flag.StringVar(&aofPath, "aof", "", "append only file of mutating commands, replayed on start eg: -aof kece.aof")
+	flag.StringVar(&aofFsync, "aof-fsync", AOFFsyncEverySec, "fsync policy of append only file (always, everysec or no) eg: -aof-fsync always")
+	flag.StringVar(&metricsAddr, "metrics", "", "address of http server exposing prometheus metrics on /metrics eg: -metrics :9100")
+	flag.StringVar(&replicaOf, "replicaof", "", "address of primary to replicate from, keyspace is copied then every write of primary is applied eg: -replicaof 10.0.0.1:9000")
+	flag.StringVar(&primaryAuth, "primary-auth", "", "password sent by AUTH to primary before SYNC eg: -primary-auth my-secret")
+	flag.BoolVar(&readOnly, "read-only", false, "reject every mutating command of clients, writes of primary are still applied")
+	flag.BoolVar(&debugEnabled, "debug", false, "enable DEBUG command, it may block the server eg: -debug")
+	flag.StringVar(&logLevel, "log-level", LogLevelInfo, "log level (debug, info, warn or error) eg: -log-level debug")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", DefaultShutdownTimeout, "maximum time of waiting running commands on shutdown eg: -shutdown-timeout 5s")
+	flag.DurationVar(&slowLogThreshold, "slowlog-threshold", 0, "log command whose processing exceeds the duration, 0 means never eg: -slowlog-threshold 10ms")
+	flag.IntVar(&slowLogMaxLen, "slowlog-max-len", DefaultSlowLogMaxLen, "number of the last slow commands kept for SLOWLOG GET eg: -slowlog-max-len 128")
+	flag.IntVar(&hashIterations, "hash-iterations", DefaultHashIterations, "number of PBKDF2-HMAC-SHA256 iterations of hashing password eg: -hash-iterations 600000")
+
+	flag.BoolVar(&noColor, "no-color", false, "disable colored output")
 
 	flag.BoolVar(&showVersion, "version", false, "show version")
 	flag.BoolVar(&showVersion, "v", false, "show version")
@@ -42,10 +157,47 @@ func ParseArgs() (*Arguments, error) {
 		printGreenColor("    Kece (an Experimental Distributed Key Value Store)   ")
 		fmt.Println()
 		printGreenColor("	-net  | --net network type eg: -net tcp")
+		printGreenColor("	-host | --host interface to bind, empty means every interface eg: -host 127.0.0.1")
 		printGreenColor("	-port | --port port to listen eg: -port 9000")
+		printGreenColor("	-socket | --socket unix socket to listen if network type is unix eg: -net unix -socket /tmp/kece.sock")
+		printGreenColor("	-allow | --allow comma separated CIDR ranges of client IP allowed to connect, empty means every IP eg: -allow 10.0.0.0/8")
+		printGreenColor("	-deny | --deny comma separated CIDR ranges of client IP denied to connect eg: -deny 192.168.1.0/24")
+		printGreenColor("	-protocol | --protocol wire protocol (kece or resp), use resp to connect with redis clients")
+		printGreenColor("	-length-prefixed | --length-prefixed read value by length when the last token is $<length>, so it may contain new lines")
 		printGreenColor("	-auth | --auth if you want to client send auth before exchange data")
+		printGreenColor("	-users | --users file of users, a username:password per line, client send AUTH username password")
+		printGreenColor("	-acl | --acl file of commands every user may run, a username followed by commands per line eg: reader GET EXISTS MGET")
 		printGreenColor("	-ds   | --ds  acronym from (data storage), ")
-		printGreenColor("	                you can choose either type (hashmap or binary tree)")
+		printGreenColor("	                you can choose either type (hashmap, binary tree or disk)")
+		printGreenColor("	-data-file | --data-file data file of disk data storage, keys survive restart eg: -data-file kece.data")
+		printGreenColor("	-sweep | --sweep interval of deleting expired keys eg: -sweep 1s")
+		printGreenColor("	-command-timeout | --command-timeout reply ERROR if command is not done within the duration, 0 means never eg: -command-timeout 1s")
+		printGreenColor("	-idle-timeout | --idle-timeout close client connection after idle for the duration, 0 means never eg: -idle-timeout 5m")
+		printGreenColor("	-write-timeout | --write-timeout close client connection if it doesn't read reply within the duration, 0 means never eg: -write-timeout 10s")
+		printGreenColor("	-max-clients | --max-clients maximum number of connected clients, 0 means unlimited eg: -max-clients 1000")
+		printGreenColor("	-max-command-size | --max-command-size maximum size of a single command in bytes, client sending larger command is disconnected")
+		printGreenColor("	-key-validator | --key-validator reject key created by command if it is invalid, no-spaces or printable")
+		printGreenColor("	-max-keys | --max-keys maximum number of keys, least recently used key is evicted once it is exceeded, 0 means unlimited")
+		printGreenColor("	-databases | --databases number of logical databases, client switch database by SELECT eg: -databases 16")
+		printGreenColor("	-workers | --workers number of goroutines processing messages of every client, 0 means a goroutine per client")
+		printGreenColor("	-shards | --shards number of shards of keyspace, every shard has its own lock eg: -shards 16")
+		printGreenColor("	-tls-cert | --tls-cert TLS certificate file, TLS is enabled if both -tls-cert and -tls-key are set")
+		printGreenColor("	-tls-key | --tls-key TLS private key file")
+		printGreenColor("	-snapshot | --snapshot snapshot file of keyspace, loaded on start eg: -snapshot kece.snapshot")
+		printGreenColor("	-snapshot-interval | --snapshot-interval interval of writing snapshot eg: -snapshot-interval 5m")
+		printGreenColor("	-aof | --aof append only file of mutating commands, replayed on start eg: -aof kece.aof")
+		printGreenColor("	-aof-fsync | --aof-fsync fsync policy of append only file (always, everysec or no) eg: -aof-fsync always")
+		printGreenColor("	-metrics | --metrics address of http server exposing prometheus metrics on /metrics eg: -metrics :9100")
+		printGreenColor("	-replicaof | --replicaof address of primary to replicate from, keyspace is copied then every write of primary is applied")
+		printGreenColor("	-primary-auth | --primary-auth password sent by AUTH to primary before SYNC")
+		printGreenColor("	-read-only | --read-only reject every mutating command of clients, writes of primary are still applied")
+		printGreenColor("	-debug | --debug enable DEBUG command, it may block the server")
+		printGreenColor("	-log-level | --log-level log level (debug, info, warn or error) eg: -log-level debug")
+		printGreenColor("	-shutdown-timeout | --shutdown-timeout maximum time of waiting running commands on shutdown eg: -shutdown-timeout 5s")
+		printGreenColor("	-slowlog-threshold | --slowlog-threshold log command whose processing exceeds the duration, 0 means never eg: -slowlog-threshold 10ms")
+		printGreenColor("	-slowlog-max-len | --slowlog-max-len number of the last slow commands kept for SLOWLOG GET eg: -slowlog-max-len 128")
+		printGreenColor("	-hash-iterations | --hash-iterations number of PBKDF2-HMAC-SHA256 iterations of hashing password eg: -hash-iterations 600000")
+		printGreenColor("	-no-color | --no-color disable colored output, color is disabled by default if output is not a terminal")
 		printGreenColor("	-v    | --version show kece version")
 		printGreenColor("	-h    | --help show help and usage")
 		fmt.Println()
@@ -58,36 +210,151 @@ func ParseArgs() (*Arguments, error) {
 
 	flag.Parse()
 
+	if noColor {
+		disableColor()
+	}
+
 	if len(network) <= 0 {
 		return &Arguments{Help: flag.Usage}, errors.New("	(-net) arg required")
 	}
 
+	if network == NetworkUnix && len(socketPath) <= 0 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-socket) arg required by unix network")
+	}
+
 	if len(port) <= 0 {
 		return &Arguments{Help: flag.Usage}, errors.New("	(-port) arg required")
 	}
 
-	return &Arguments{
-		Auth:            auth,
-		Network:         network,
-		Port:            port,
-		DataStorageType: dataStorageType,
-		ShowVersion:     showVersion,
-		Help:            flag.Usage,
-	}, nil
-}
+	if !protocols[protocol] {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-protocol) arg should be kece or resp")
+	}
 
-func printRedColor(s string) {
-	fmt.Printf("\033[31m%s\033[0m%s", s, "\n")
-}
+	if dataStorageType == Disk && len(dataFile) <= 0 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-data-file) arg required by disk data storage")
+	}
 
-func printGreenColor(s string) {
-	fmt.Printf("\033[32m%s\033[0m%s", s, "\n")
-}
+	if _, ok := keyValidators[keyValidator]; len(keyValidator) > 0 && !ok {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-key-validator) arg should be no-spaces or printable")
+	}
 
-func printYellowColor(s string) {
-	fmt.Printf("\033[33m%s\033[0m%s", s, "\n")
-}
+	if maxCommandSize < 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-max-command-size) arg should be at least 1")
+	}
+
+	if slowLogMaxLen < 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-slowlog-max-len) arg should be at least 1")
+	}
+
+	if hashIterations < 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-hash-iterations) arg should be at least 1")
+	}
+
+	if databases < 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-databases) arg should be at least 1")
+	}
+
+	if workers < 0 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-workers) arg should not be negative")
+	}
 
-func printCyanColor(s string) {
-	fmt.Printf("\033[36m%s\033[0m%s", s, "\n")
+	if shards < 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-shards) arg should be at least 1")
+	}
+
+	if dataStorageType == Disk && shards > 1 {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-shards) arg is not supported by disk data storage")
+	}
+
+	if (len(tlsCertFile) > 0) != (len(tlsKeyFile) > 0) {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-tls-cert) and (-tls-key) args should be set together")
+	}
+
+	if !aofFsyncPolicies[aofFsync] {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-aof-fsync) arg should be always, everysec or no")
+	}
+
+	if len(replicaOf) > 0 {
+		if _, _, err := net.SplitHostPort(replicaOf); err != nil {
+			return &Arguments{Help: flag.Usage}, errors.New("	(-replicaof) arg should be host:port")
+		}
+	}
+
+	if _, ok := logLevels[logLevel]; !ok {
+		return &Arguments{Help: flag.Usage}, errors.New("	(-log-level) arg should be debug, info, warn or error")
+	}
+
+	allowed, err := parseCIDRs(allowedCIDRs)
+	if err != nil {
+		return &Arguments{Help: flag.Usage}, fmt.Errorf("	(-allow) %v", err)
+	}
+
+	denied, err := parseCIDRs(deniedCIDRs)
+	if err != nil {
+		return &Arguments{Help: flag.Usage}, fmt.Errorf("	(-deny) %v", err)
+	}
+
+	var users map[string]string
+	if len(usersFile) > 0 {
+		var err error
+		users, err = readUsers(usersFile)
+		if err != nil {
+			return &Arguments{Help: flag.Usage}, fmt.Errorf("	(-users) %v", err)
+		}
+	}
+
+	var acl map[string]map[string]bool
+	if len(aclFile) > 0 {
+		var err error
+		acl, err = readACL(aclFile)
+		if err != nil {
+			return &Arguments{Help: flag.Usage}, fmt.Errorf("	(-acl) %v", err)
+		}
+	}
+
+	return &Arguments{
+		Auth:             auth,
+		Users:            users,
+		ACL:              acl,
+		Network:          network,
+		Host:             host,
+		Port:             port,
+		SocketPath:       socketPath,
+		AllowedCIDRs:     allowed,
+		DeniedCIDRs:      denied,
+		Protocol:         protocol,
+		LengthPrefixed:   lengthPrefixed,
+		DataStorageType:  dataStorageType,
+		DataFile:         dataFile,
+		SweepInterval:    sweepInterval,
+		ShutdownTimeout:  shutdownTimeout,
+		SlowLogThreshold: slowLogThreshold,
+		SlowLogMaxLen:    slowLogMaxLen,
+		HashIterations:   hashIterations,
+		CommandTimeout:   commandTimeout,
+		IdleTimeout:      idleTimeout,
+		WriteTimeout:     writeTimeout,
+		MaxClients:       maxClients,
+		MaxCommandSize:   maxCommandSize,
+		KeyValidator:     keyValidators[keyValidator],
+		MaxKeys:          maxKeys,
+		Databases:        databases,
+		Workers:          workers,
+		Shards:           shards,
+		TLSCertFile:      tlsCertFile,
+		TLSKeyFile:       tlsKeyFile,
+		SnapshotPath:     snapshotPath,
+		SnapshotInterval: snapshotInterval,
+		AOFPath:          aofPath,
+		AOFFsync:         aofFsync,
+		MetricsAddr:      metricsAddr,
+		ReplicaOf:        replicaOf,
+		PrimaryAuth:      primaryAuth,
+		ReadOnly:         readOnly,
+		DebugEnabled:     debugEnabled,
+		LogLevel:         logLevel,
+		NoColor:          noColor,
+		ShowVersion:      showVersion,
+		Help:             flag.Usage,
+	}, nil
 }
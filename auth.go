@@ -0,0 +1,226 @@
+package kece
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultUser is the user authenticated by AUTH password when Auth is set
+const DefaultUser = "default"
+
+// maxAuthFailures is the number of failed AUTH after which client is disconnected
+const maxAuthFailures = 5
+
+// readUsers will read users file, every line is username:password. Empty line and line starting with # are ignored
+func readUsers(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.Index(line, ":")
+		if idx <= 0 || idx == len(line)-1 {
+			return nil, fmt.Errorf("invalid user at line %d of %s, it should be username:password", n, path)
+		}
+		users[line[:idx]] = line[idx+1:]
+	}
+	return users, scanner.Err()
+}
+
+// readACL will read ACL file, every line is username followed by commands the user may run => ex: reader GET EXISTS MGET.
+// Empty line and line starting with # are ignored
+func readACL(path string) (map[string]map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	acl := make(map[string]map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		allowed := make(map[string]bool, len(fields)-1)
+		for _, name := range fields[1:] {
+			command, ok := commands[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown command %s at line %d of %s", name, n, path)
+			}
+			allowed[command] = true
+		}
+		acl[fields[0]] = allowed
+	}
+	return acl, scanner.Err()
+}
+
+// permitted return true if user may run command, user without ACL may run every command.
+// Public commands are always permitted, so user can still AUTH as another user
+func (server *Server) permitted(username, command string) bool {
+	if publicCommands[command] {
+		return true
+	}
+
+	allowed, ok := server.args.ACL[username]
+	if !ok {
+		return true
+	}
+	return allowed[command]
+}
+
+// authRequired return true if client must send valid AUTH before any other command
+func (server *Server) authRequired() bool {
+	server.RLock()
+	defer server.RUnlock()
+	return len(server.args.Auth) > 0 || len(server.args.Users) > 0
+}
+
+// authenticate will return name of user matching the credentials, empty username is the single password form of AUTH.
+// It is accepted if Auth is set or exactly one user is configured, so existing clients keep working.
+// At most one password per CPU is verified at once, the others wait
+func (server *Server) authenticate(username, password string) (string, bool) {
+	server.verifications <- struct{}{}
+	defer func() { <-server.verifications }()
+
+	username, cred, ok := server.credential(username)
+	if !ok {
+		// unknown user is verified against an empty credential, so it takes as long as a wrong password
+		unknownCredential(server.hashIterations()).verify(password)
+		return "", false
+	}
+
+	if !cred.verify(password) {
+		return "", false
+	}
+	return username, true
+}
+
+// credential will find credential of username, empty username is resolved to DefaultUser or the only configured user.
+// Auth and credentials may be changed by CONFIG SET, so they are read under lock
+func (server *Server) credential(username string) (string, credential, bool) {
+	server.RLock()
+	defer server.RUnlock()
+
+	if len(username) <= 0 {
+		switch {
+		case len(server.args.Auth) > 0:
+			username = DefaultUser
+		case len(server.args.Users) == 1:
+			for name := range server.args.Users {
+				username = name
+			}
+		default:
+			return "", credential{}, false
+		}
+	}
+
+	cred, ok := server.credentials[username]
+	return username, cred, ok
+}
+
+// hashIterations will return number of iterations of hashing password, zero HashIterations means default
+func (server *Server) hashIterations() int {
+	return hashIterationsOf(server.args)
+}
+
+func hashIterationsOf(args *Arguments) int {
+	if args.HashIterations <= 0 {
+		return DefaultHashIterations
+	}
+	return args.HashIterations
+}
+
+// newCredentials will hash password of every user, Auth is the password of DefaultUser
+func newCredentials(args *Arguments) map[string]credential {
+	iterations := hashIterationsOf(args)
+
+	credentials := make(map[string]credential, len(args.Users)+1)
+	for username, password := range args.Users {
+		credentials[username] = newCredential(password, iterations)
+	}
+
+	if len(args.Auth) > 0 {
+		credentials[DefaultUser] = newCredential(args.Auth, iterations)
+	}
+	return credentials
+}
+
+const saltLength = 16
+
+// credential is salted hash of password, plaintext password is not needed to verify it.
+// Iterations is kept with the hash, so credential is verified with the cost it is hashed
+type credential struct {
+	salt       []byte
+	hash       []byte
+	iterations int
+}
+
+// newCredential will hash password with a random salt,
+// it panics if random source fail because there is no safe way to continue without it
+func newCredential(password string, iterations int) credential {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return credential{salt: salt, hash: pbkdf2([]byte(password), salt, iterations, sha256.Size), iterations: iterations}
+}
+
+// unknownCredential is verified when user is not exist, no password match its empty hash
+func unknownCredential(iterations int) credential {
+	return credential{salt: make([]byte, saltLength), hash: make([]byte, sha256.Size), iterations: iterations}
+}
+
+// verify will compare hash of password in constant time
+func (c credential) verify(password string) bool {
+	hash := pbkdf2([]byte(password), c.salt, c.iterations, len(c.hash))
+	return subtle.ConstantTimeCompare(hash, c.hash) == 1
+}
+
+// pbkdf2 derive key from password as described in RFC 8018 using HMAC-SHA256, it is used instead of bcrypt or scrypt
+// so kece doesn't depend on module outside of standard library. Iterations follow OWASP guidance of PBKDF2-HMAC-SHA256
+func pbkdf2(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, keyLength)
+
+	block := make([]byte, 4)
+	for i := uint32(1); len(key) < keyLength; i++ {
+		binary.BigEndian.PutUint32(block, i)
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range t {
+				t[x] ^= u[x]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
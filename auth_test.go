@@ -0,0 +1,297 @@
+package kece
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testHashIterations keep hashing of test credentials fast, DefaultHashIterations take seconds with race detector
+const testHashIterations = 1000
+
+func TestAuthUsers(t *testing.T) {
+	t.Run("should authenticate named users", func(t *testing.T) {
+		users := map[string]string{"wuriyanto": "secret-1", "agung": "secret-2"}
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Users: users}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET 1 wuriyanto", reply: ErrorInvalidAuth},
+			{message: "AUTH wuriyanto secret-2", reply: ErrorInvalidAuth},
+			{message: "AUTH unknown secret-1", reply: ErrorInvalidAuth},
+			{message: "AUTH secret-1", reply: ErrorInvalidAuth},
+			{message: "SET 1 wuriyanto", reply: ErrorInvalidAuth},
+			{message: "AUTH wuriyanto secret-1", reply: replies["OK"]},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+
+		if client.User() != "wuriyanto" {
+			t.Errorf("authenticated user should be wuriyanto, got %q", client.User())
+		}
+	})
+
+	t.Run("should accept single password if only one user is configured", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Users: map[string]string{"wuriyanto": "secret-1"}}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("AUTH secret-1")}); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		if client.User() != "wuriyanto" {
+			t.Errorf("authenticated user should be wuriyanto, got %q", client.User())
+		}
+	})
+
+	t.Run("should authenticate Auth password as default user", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("AUTH default my-secret")}); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		if client.User() != DefaultUser {
+			t.Errorf("authenticated user should be %s, got %q", DefaultUser, client.User())
+		}
+	})
+}
+
+func TestReadUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kece-users")
+	if err != nil {
+		t.Fatalf("error create temp dir %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("should read a user per line", func(t *testing.T) {
+		path := filepath.Join(dir, "kece.users")
+		if err := ioutil.WriteFile(path, []byte("# users\nwuriyanto:secret:1\n\nagung:secret-2\n"), 0600); err != nil {
+			t.Fatalf("error write users file %s", err.Error())
+		}
+
+		users, err := readUsers(path)
+		if err != nil {
+			t.Fatalf("error read users %s", err.Error())
+		}
+
+		if len(users) != 2 || users["wuriyanto"] != "secret:1" || users["agung"] != "secret-2" {
+			t.Errorf("users should be read, got %v", users)
+		}
+	})
+
+	t.Run("should fail on user without password", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.users")
+		if err := ioutil.WriteFile(path, []byte("wuriyanto\n"), 0600); err != nil {
+			t.Fatalf("error write users file %s", err.Error())
+		}
+
+		if _, err := readUsers(path); err == nil {
+			t.Error("user without password should be an error")
+		}
+	})
+}
+
+func TestACL(t *testing.T) {
+	t.Run("should deny command which is not permitted to user", func(t *testing.T) {
+		users := map[string]string{"reader": "secret-1", "writer": "secret-2"}
+		acl := map[string]map[string]bool{
+			"reader": {commands["GET"]: true, commands["EXISTS"]: true, commands["MGET"]: true},
+		}
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Users: users, ACL: acl}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "AUTH writer secret-2", reply: replies["OK"]},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "AUTH reader secret-1", reply: replies["OK"]},
+			{message: "GET 1", reply: "wuriyanto" + crlf},
+			{message: "EXISTS 1", reply: "1" + crlf},
+			{message: "PING", reply: replies["PONG"]},
+			{message: "SET 1 agung", reply: ErrorNoPermission},
+			{message: "DEL 1", reply: ErrorNoPermission},
+			{message: "GET 1", reply: "wuriyanto" + crlf},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should read ACL file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kece-acl")
+		if err != nil {
+			t.Fatalf("error create temp dir %s", err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "kece.acl")
+		if err := ioutil.WriteFile(path, []byte("# read only\nreader get EXISTS mget\n"), 0600); err != nil {
+			t.Fatalf("error write acl file %s", err.Error())
+		}
+
+		acl, err := readACL(path)
+		if err != nil {
+			t.Fatalf("error read acl %s", err.Error())
+		}
+
+		if len(acl["reader"]) != 3 || !acl["reader"][commands["GET"]] || acl["reader"][commands["SET"]] {
+			t.Errorf("reader should be permitted GET, EXISTS and MGET only, got %v", acl["reader"])
+		}
+
+		if err := ioutil.WriteFile(path, []byte("reader FLY\n"), 0600); err != nil {
+			t.Fatalf("error write acl file %s", err.Error())
+		}
+
+		if _, err := readACL(path); err == nil {
+			t.Error("unknown command should be an error")
+		}
+	})
+}
+
+func TestCredential(t *testing.T) {
+	t.Run("should derive key of RFC test vector", func(t *testing.T) {
+		key := pbkdf2([]byte("password"), []byte("salt"), 2, 32)
+		if hex.EncodeToString(key) != "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43" {
+			t.Errorf("derived key is not equal to test vector, got %x", key)
+		}
+	})
+
+	t.Run("should verify only the correct password", func(t *testing.T) {
+		cred := newCredential("my-secret", testHashIterations)
+		if bytes.Contains(cred.hash, []byte("my-secret")) {
+			t.Error("password should not be stored in plaintext")
+		}
+
+		if !cred.verify("my-secret") {
+			t.Error("correct password should be verified")
+		}
+
+		if cred.verify("my-secret ") || cred.verify("") {
+			t.Error("wrong password should not be verified")
+		}
+	})
+
+	t.Run("should hash with configured iterations", func(t *testing.T) {
+		if iterations := hashIterationsOf(&Arguments{}); iterations != DefaultHashIterations {
+			t.Errorf("zero HashIterations should use %d iterations, got %d", DefaultHashIterations, iterations)
+		}
+
+		cred := newCredentials(&Arguments{Auth: "my-secret", HashIterations: 10})[DefaultUser]
+		if cred.iterations != 10 || !cred.verify("my-secret") {
+			t.Errorf("credential should be hashed and verified with 10 iterations, got %d", cred.iterations)
+		}
+
+		// the same password hashed with other cost derive other key
+		other := cred
+		other.iterations = 11
+		if other.verify("my-secret") {
+			t.Error("credential should not be verified with other iterations")
+		}
+	})
+
+	t.Run("should salt every credential", func(t *testing.T) {
+		if bytes.Equal(newCredential("my-secret", testHashIterations).hash, newCredential("my-secret", testHashIterations).hash) {
+			t.Error("the same password should be hashed differently")
+		}
+	})
+}
+
+func TestAuthFailures(t *testing.T) {
+	t.Run("should disconnect client after max failed AUTH", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Auth: "my-secret", HashIterations: testHashIterations},
+			NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		for i := 0; i < maxAuthFailures; i++ {
+			if _, err := conn.Write([]byte("AUTH wrong-secret\r\n")); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := reader.ReadString('\n'); reply != ErrorInvalidAuth {
+				t.Fatalf("reply of failed AUTH should be %q, got %q", ErrorInvalidAuth, reply)
+			}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		conn.Write([]byte("AUTH my-secret\r\n"))
+		if reply, err := reader.ReadString('\n'); err == nil {
+			t.Errorf("connection should be closed after %d failed AUTH, got %q", maxAuthFailures, reply)
+		}
+	})
+
+	t.Run("should bound concurrent verifications", func(t *testing.T) {
+		server := NewServer(&Arguments{Auth: "my-secret", HashIterations: testHashIterations}, NewCommander(newStructureMock()))
+		for i := 0; i < cap(server.verifications); i++ {
+			server.verifications <- struct{}{}
+		}
+
+		done := make(chan bool)
+		go func() {
+			_, ok := server.authenticate("", "my-secret")
+			done <- ok
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("password should not be verified while every verification is running")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		<-server.verifications
+		if ok := <-done; !ok {
+			t.Error("password should be verified once a verification is done")
+		}
+	})
+}
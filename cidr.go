@@ -0,0 +1,58 @@
+package kece
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// parseCIDRs will parse comma separated CIDR ranges => ex: 10.0.0.0/8,192.168.1.0/24, empty value is no range
+func parseCIDRs(value string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s", cidr)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// containsIP will return true if ip is in any of ranges
+func containsIP(ranges []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ranges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedAddr will return false if addr is in DeniedCIDRs, or AllowedCIDRs is set and addr is not in it.
+// Address without IP like unix socket is always allowed
+func (server *Server) allowedAddr(addr net.Addr) bool {
+	if len(server.args.AllowedCIDRs) == 0 && len(server.args.DeniedCIDRs) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+
+	if containsIP(server.args.DeniedCIDRs, ip) {
+		return false
+	}
+	return len(server.args.AllowedCIDRs) == 0 || containsIP(server.args.AllowedCIDRs, ip)
+}
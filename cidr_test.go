@@ -0,0 +1,79 @@
+package kece
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	ranges, err := parseCIDRs("10.0.0.0/8, 127.0.0.1/32,")
+	if err != nil {
+		t.Fatalf("error parse CIDRs %s", err.Error())
+	}
+
+	if len(ranges) != 2 {
+		t.Errorf("ranges should have 2 elements, got %d", len(ranges))
+	}
+
+	if !containsIP(ranges, net.ParseIP("10.1.2.3")) || containsIP(ranges, net.ParseIP("127.0.0.2")) {
+		t.Error("ranges should contain only addresses of 10.0.0.0/8 and 127.0.0.1")
+	}
+
+	if _, err := parseCIDRs("10.0.0.0"); err == nil {
+		t.Error("address without prefix length should be invalid")
+	}
+}
+
+func TestServerCIDRs(t *testing.T) {
+	mustParse := func(value string) []*net.IPNet {
+		ranges, err := parseCIDRs(value)
+		if err != nil {
+			t.Fatalf("error parse CIDRs %s", err.Error())
+		}
+		return ranges
+	}
+
+	tests := []struct {
+		name     string
+		args     *Arguments
+		accepted bool
+	}{
+		{"should drop connection of denied IP", &Arguments{DeniedCIDRs: mustParse("127.0.0.0/8")}, false},
+		{"should drop connection of IP which is not allowed", &Arguments{AllowedCIDRs: mustParse("10.0.0.0/8")}, false},
+		{"should deny even if IP is allowed", &Arguments{AllowedCIDRs: mustParse("127.0.0.0/8"), DeniedCIDRs: mustParse("127.0.0.1/32")}, false},
+		{"should accept connection of allowed IP", &Arguments{AllowedCIDRs: mustParse("127.0.0.1/32")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args.Network = "tcp"
+			tt.args.Host = "127.0.0.1"
+			tt.args.Port = "0"
+
+			server := NewServer(tt.args, NewCommander(newStructureMock()))
+			go func() {
+				if err := server.Start(); err != nil {
+					t.Errorf("error start server %s", err.Error())
+				}
+			}()
+			defer server.Stop()
+
+			conn := dialServer(t, server)
+			defer conn.Close()
+
+			// write may succeed before server close the connection, reading tell whether it is dropped
+			conn.Write([]byte("PING\r\n"))
+			conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+			reply, err := bufio.NewReader(conn).ReadString('\n')
+			if tt.accepted && reply != replies["PONG"] {
+				t.Errorf("reply should be PONG, got %q", reply)
+			}
+
+			if !tt.accepted && err == nil {
+				t.Errorf("connection should be dropped, got %q", reply)
+			}
+		})
+	}
+}
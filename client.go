@@ -1,6 +1,7 @@
 package kece
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,12 +17,216 @@ import (
 type Client struct {
 	ID   string
 	Conn net.Conn
+
+	// Authenticated is true once client send valid AUTH, it lives as long as the connection
+	Authenticated bool
+	// Username is the user authenticated by AUTH
+	Username string
+	closed   bool
+	replica  bool
+	// quit is true once client send QUIT, commands it sent after QUIT are dropped
+	quit bool
+	// authFailures count failed AUTH, client is disconnected once it reach maxAuthFailures
+	authFailures int
+	// replay is true for client applying commands of append only file or primary, read only mode doesn't apply to it
+	replay bool
+	// db is index of database selected by SELECT
+	db int
+	// multi is true between MULTI and EXEC, queued hold commands sent meanwhile
+	multi  bool
+	queued []*ClientMessage
+	// watched hold version of keys sent by WATCH, EXEC is aborted once any of them is changed
+	watched []watchedKey
+	// writer buffer replies of the running command, it is flushed once the command is done
+	writer *bufio.Writer
+	// pending track messages of client which are queued but not processed yet
+	pending sync.WaitGroup
+	mu      sync.RWMutex
+
+	// ConnectedAt is the time connection is accepted
+	ConnectedAt time.Time
+}
+
+// SetAuthenticated client method, this function will set authentication state of client session
+func (client *Client) SetAuthenticated(authenticated bool) {
+	client.mu.Lock()
+	client.Authenticated = authenticated
+	client.mu.Unlock()
+}
+
+// Authenticate client method, this function will mark client session as authenticated by username
+func (client *Client) Authenticate(username string) {
+	client.mu.Lock()
+	client.Authenticated = true
+	client.Username = username
+	client.mu.Unlock()
+}
+
+// User client method, this function will return username of authenticated client session
+func (client *Client) User() string {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.Username
+}
+
+// IsAuthenticated client method, this function will return authentication state of client session
+func (client *Client) IsAuthenticated() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.Authenticated
+}
+
+// Close client method, this function will close connection of client once,
+// so it is safe to be called by both CLIENT KILL and the connection handler
+func (client *Client) Close() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.closed {
+		return nil
+	}
+
+	client.closed = true
+	return client.Conn.Close()
+}
+
+// Quit client method, this function will mark client as quitting then close its connection
+func (client *Client) Quit() error {
+	client.mu.Lock()
+	client.quit = true
+	client.mu.Unlock()
+
+	return client.Close()
+}
+
+// FailAuth client method, this function will count failed AUTH and return the number of failures so far
+func (client *Client) FailAuth() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.authFailures++
+	return client.authFailures
+}
+
+// HasQuit client method, this function will return true once client send QUIT
+func (client *Client) HasQuit() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	return client.quit
+}
+
+// MarkReplica client method, this function will mark client as replica which only read commands streamed by server,
+// so its read deadline is cleared and it is never closed by idle timeout
+func (client *Client) MarkReplica() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.replica = true
+	return client.Conn.SetReadDeadline(time.Time{})
+}
+
+// IsReplica client method, this function will return true once client is marked as replica
+func (client *Client) IsReplica() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.replica
+}
+
+// setIdleDeadline will set read deadline of connection unless client is replica, it is checked under the same lock
+// as MarkReplica so deadline set by connection handler never outlive it
+func (client *Client) setIdleDeadline(deadline time.Time) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.replica {
+		return nil
+	}
+	return client.Conn.SetReadDeadline(deadline)
+}
+
+// Select client method, this function will switch database of client session to index
+func (client *Client) Select(index int) {
+	client.mu.Lock()
+	client.db = index
+	client.mu.Unlock()
+}
+
+// Database client method, this function will return index of database selected by client session
+func (client *Client) Database() int {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.db
+}
+
+// BeginTransaction client method, this function will start queuing commands until EXEC or DISCARD,
+// false is returned if transaction is already started
+func (client *Client) BeginTransaction() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.multi {
+		return false
+	}
+
+	client.multi = true
+	client.queued = nil
+	return true
+}
+
+// InTransaction client method, this function will return true between MULTI and EXEC or DISCARD
+func (client *Client) InTransaction() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.multi
+}
+
+// QueueCommand client method, this function will queue command to be run by EXEC
+func (client *Client) QueueCommand(cm *ClientMessage) {
+	client.mu.Lock()
+	client.queued = append(client.queued, cm)
+	client.mu.Unlock()
+}
+
+// EndTransaction client method, this function will stop queuing and return queued commands,
+// false is returned if transaction is not started
+func (client *Client) EndTransaction() ([]*ClientMessage, bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.multi {
+		return nil, false
+	}
+
+	queued := client.queued
+	client.multi = false
+	client.queued = nil
+	return queued, true
 }
 
-// Subscribe client method, this function will used by client to subscribe to specific topic
-//TODO
-func (client *Client) Subscribe(topic string) {
+// watchedKey is key of database db watched at version
+type watchedKey struct {
+	db      int
+	key     []byte
+	version uint64
+}
 
+// Watch client method, this function will remember version of key in database db until EXEC or DISCARD
+func (client *Client) Watch(db int, key []byte, version uint64) {
+	client.mu.Lock()
+	client.watched = append(client.watched, watchedKey{db: db, key: key, version: version})
+	client.mu.Unlock()
+}
+
+// Unwatch client method, this function will forget every watched key and return them
+func (client *Client) Unwatch() []watchedKey {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	watched := client.watched
+	client.watched = nil
+	return watched
+}
+
+// IsClosed client method, this function will return true once connection of client is closed by Close
+func (client *Client) IsClosed() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.closed
 }
 
 // ClientMessage struct
@@ -30,7 +236,23 @@ type ClientMessage struct {
 	Cmd     []byte
 	Key     []byte
 	Value   []byte
+	Args    [][]byte
 	Exp     time.Duration
+
+	// Pairs hold key and value pairs of MSET
+	Pairs []KeyValue
+
+	// Raw is the whole message in wire format without surrounding spaces
+	Raw []byte
+
+	// queued is true once message is queued by transaction, it is run by EXEC without validating again
+	queued bool
+
+	// keyValidator check every key command may create, nil means every key is accepted
+	keyValidator func([]byte) error
+
+	// deleted hold keys actually deleted by DEL, they are published as keyspace events
+	deleted [][]byte
 }
 
 func processingValue(val string) (value string, expiredValue int, err error) {
@@ -78,30 +300,215 @@ func processingValue(val string) (value string, expiredValue int, err error) {
 	return
 }
 
+// argumentValue will return the rest of message after n first tokens,
+// surrounding quote is removed => ex: SET k "test value" -> test value
+func argumentValue(message string, n int) string {
+	rest := strings.TrimSpace(message)
+	for i := 0; i < n; i++ {
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return ""
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+	}
+
+	if len(rest) >= 2 {
+		first, last := rest[0], rest[len(rest)-1]
+		if first == last && (first == '"' || first == '\'') {
+			rest = rest[1 : len(rest)-1]
+		}
+	}
+	return rest
+}
+
 // ValidateMessage function
+// message is either a kece line, a kece line followed by length prefixed value or a RESP array of bulk strings
 func (c *ClientMessage) ValidateMessage() error {
 	message := bytes.TrimSpace(c.Message)
-
 	messages := strings.Fields(string(message))
 
+	// elements of RESP array and length prefixed value are binary safe, they may contain spaces and new lines
+	var args [][]byte
+	resp := isFrame(c.Message)
+	if resp {
+		var err error
+		// message is already read, so it bounds the frame
+		_, args, err = readFrameLimit(bufio.NewReader(bytes.NewReader(c.Message)), len(c.Message))
+		if err != nil {
+			return errors.New(ErrorInvalidProtocol)
+		}
+		message = c.Message
+	} else if prefixed, ok := lengthPrefixedArgs(c.Message); ok {
+		// it is logged as RESP array, so the value is replayed intact
+		resp = true
+		args = prefixed
+		message = respProtocol{}.Array(args)
+	}
+
+	if resp {
+		messages = make([]string, 0, len(args))
+		for _, arg := range args {
+			messages = append(messages, string(arg))
+		}
+		messages[0] = strings.ToUpper(messages[0])
+	}
+
+	if len(messages) == 0 {
+		return errors.New(ErrorInvalidCommand)
+	}
+
+	// rest return the value after n first tokens
+	rest := func(n int) []byte {
+		if resp {
+			return []byte(strings.Join(messages[n:], " "))
+		}
+		return []byte(argumentValue(string(message), n))
+	}
+
 	command, ok := commands[messages[0]]
 	if !ok {
-		return errors.New(ErrorInvalidCommand)
+		return errorUnknownCommand(messages[0])
 	}
 
 	c.Cmd = []byte(messages[0])
-	c.Key = []byte(messages[1])
+	c.Key = nil
+	if len(messages) > 1 {
+		c.Key = []byte(messages[1])
+	}
+
+	c.Args = make([][]byte, 0, len(messages)-1)
+	for _, arg := range messages[1:] {
+		c.Args = append(c.Args, []byte(arg))
+	}
+
+	if a, ok := arities[command]; ok {
+		if len(messages) < a.min || (a.max >= 0 && len(messages) > a.max) {
+			return errorWrongArity(command)
+		}
+	}
+
+	if command == "PUBLISH" {
+		// message is the rest of line after channel, it may contain spaces
+		c.Value = rest(2)
+	}
+
+	if command == "ECHO" {
+		c.Value = rest(1)
+	}
+
+	if command == "APPEND" || command == "GETSET" || command == "SETNX" {
+		c.Value = rest(2)
+	}
 
-	if command == "GET" || command == "DEL" || command == "AUTH" {
-		if len(messages) < 2 || len(messages) > 2 {
+	if command == "HSET" || command == "SETRANGE" || command == "SETEX" || command == "PSETEX" {
+		c.Value = rest(3)
+	}
+
+	if command == "MSET" {
+		if len(c.Args)%2 != 0 {
+			return errorWrongArity(command)
+		}
+
+		c.Pairs = make([]KeyValue, 0, len(c.Args)/2)
+		for i := 0; i < len(c.Args); i += 2 {
+			c.Pairs = append(c.Pairs, KeyValue{Key: c.Args[i], Value: c.Args[i+1]})
+		}
+	}
+
+	if command == "RESTORE" {
+		if len(messages) == 5 && strings.ToUpper(messages[4]) != "REPLACE" {
 			return errors.New(ErrorInvalidOperation)
 		}
 	}
 
-	if command == "SET" {
-		if len(messages) < 3 {
+	if command == "COPY" {
+		if len(messages) == 4 && strings.ToUpper(messages[3]) != "REPLACE" {
+			return errors.New(ErrorInvalidOperation)
+		}
+	}
+
+	if command == "SCAN" {
+		if len(messages)%2 != 0 {
+			return errorWrongArity(command)
+		}
+	}
+
+	if command == "COMMAND" {
+		if len(messages) == 2 && strings.ToUpper(messages[1]) != "COUNT" {
+			return errors.New(ErrorInvalidOperation)
+		}
+	}
+
+	if command == "CLIENT" {
+		subcommand := ""
+		if len(messages) > 1 {
+			subcommand = strings.ToUpper(messages[1])
+		}
+
+		if (subcommand != "LIST" || len(messages) != 2) && (subcommand != "KILL" || len(messages) != 3) {
+			return errors.New(ErrorInvalidOperation)
+		}
+	}
+
+	if command == "CONFIG" {
+		subcommand := ""
+		if len(messages) > 1 {
+			subcommand = strings.ToUpper(messages[1])
+		}
+
+		if (subcommand != "SET" || len(messages) < 4) && (subcommand != "GET" || len(messages) != 3) {
+			return errors.New(ErrorInvalidOperation)
+		}
+
+		if subcommand == "SET" {
+			c.Value = rest(3)
+		}
+	}
+
+	if command == "OBJECT" {
+		if strings.ToUpper(messages[1]) != "IDLETIME" && strings.ToUpper(messages[1]) != "FREQ" {
+			return errors.New(ErrorInvalidOperation)
+		}
+	}
+
+	if command == "SLOWLOG" {
+		if strings.ToUpper(messages[1]) != "GET" {
+			return errors.New(ErrorInvalidOperation)
+		}
+	}
+
+	if command == "DEBUG" {
+		subcommand := strings.ToUpper(messages[1])
+		if subcommand != "SLEEP" && subcommand != "OBJECT" {
 			return errors.New(ErrorInvalidOperation)
 		}
+	}
+
+	if command == "PING" && len(messages) > 1 {
+		c.Value = rest(1)
+	}
+
+	if c.keyValidator != nil {
+		for _, key := range c.createdKeys() {
+			if err := c.keyValidator(key); err != nil {
+				return errors.New(replies["ERROR"])
+			}
+		}
+	}
+
+	if command == "SET" {
+		// RESP value is taken as is, lifetime can be set by EXPIRE
+		if resp {
+			if len(messages) != 3 {
+				return errorWrongArity(command)
+			}
+
+			c.Value = []byte(messages[2])
+			c.Exp = 0
+			c.Raw = message
+			c.Message = nil // garbage
+			return nil
+		}
 
 		mess := strings.TrimLeft(string(message), command)
 		idx := strings.Index(mess, messages[1])
@@ -117,10 +524,15 @@ func (c *ClientMessage) ValidateMessage() error {
 
 		c.Value = []byte(val)
 		if expired != 0 {
-			c.Exp = time.Second * time.Duration(expired)
+			exp, ok := lifetimeDuration(int64(expired), time.Second)
+			if !ok {
+				return errors.New(ErrorInvalidArgument)
+			}
+			c.Exp = exp
 		}
 	}
 
+	c.Raw = message
 	c.Message = nil // garbage
 	return nil
 }
@@ -20,12 +20,22 @@ func TestClient(t *testing.T) {
 		}
 	})
 
-	t.Run("should error with command GET, DEL, or AUTH with invalid message", func(t *testing.T) {
-		cm.Message = []byte("DEL 1 bla")
+	t.Run("should error with command GET or AUTH with invalid message", func(t *testing.T) {
+		cm.Message = []byte("GET 1 bla")
 
 		err := cm.ValidateMessage()
 
 		if err == nil {
+			t.Errorf("error validate client message with GET command")
+		}
+	})
+
+	t.Run("should success with command DEL of multiple keys", func(t *testing.T) {
+		cm.Message = []byte("DEL 1 2 3")
+
+		err := cm.ValidateMessage()
+
+		if err != nil || len(cm.Args) != 3 {
 			t.Errorf("error validate client message with DEL command")
 		}
 	})
@@ -94,6 +104,72 @@ func TestClient(t *testing.T) {
 		}
 	})
 
+	t.Run("should success with command MGET with many keys", func(t *testing.T) {
+		cm.Message = []byte("MGET 1 2   3")
+
+		err := cm.ValidateMessage()
+		if err != nil {
+			t.Errorf("error validate client message with MGET command %s", err.Error())
+		}
+
+		if len(cm.Args) != 3 || string(cm.Args[2]) != "3" {
+			t.Errorf("keys is not parsed")
+		}
+	})
+
+	t.Run("should success with command MSET with many pairs", func(t *testing.T) {
+		cm.Message = []byte("MSET 1 wuriyanto 2 agung 3 bxcodec")
+
+		err := cm.ValidateMessage()
+		if err != nil {
+			t.Errorf("error validate client message with MSET command %s", err.Error())
+		}
+
+		if len(cm.Pairs) != 3 || string(cm.Pairs[1].Key) != "2" || string(cm.Pairs[1].Value) != "agung" {
+			t.Errorf("pairs is not parsed")
+		}
+	})
+
+	t.Run("should error with command MSET with odd number of arguments", func(t *testing.T) {
+		cm.Message = []byte("MSET 1 wuriyanto 2")
+
+		err := cm.ValidateMessage()
+		if err == nil {
+			t.Errorf("error validate client message with MSET command without value")
+		}
+	})
+
+	t.Run("should success with command APPEND with a string", func(t *testing.T) {
+		cm.Message = []byte(`APPEND log " appended line"`)
+
+		err := cm.ValidateMessage()
+		if err != nil {
+			t.Errorf("error validate client message with APPEND command %s", err.Error())
+		}
+
+		if string(cm.Value) != ` appended line` {
+			t.Errorf("value is not equal")
+		}
+	})
+
+	t.Run("should success with command DBSIZE without argument", func(t *testing.T) {
+		cm.Message = []byte("DBSIZE")
+
+		err := cm.ValidateMessage()
+		if err != nil {
+			t.Errorf("error validate client message with DBSIZE command %s", err.Error())
+		}
+	})
+
+	t.Run("should error with empty message", func(t *testing.T) {
+		cm.Message = []byte("   ")
+
+		err := cm.ValidateMessage()
+		if err == nil {
+			t.Errorf("error validate empty client message")
+		}
+	})
+
 	t.Run("should error with command SET with invalid value", func(t *testing.T) {
 		cm.Message = []byte(`SET v "test'`)
 
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/wuriyanto48/kece"
 	"github.com/wuriyanto48/kece/storage"
@@ -11,6 +14,9 @@ import (
 
 func main() {
 
+	// RANDOMKEY pick different keys after restart
+	rand.Seed(time.Now().UnixNano())
+
 	args, err := kece.ParseArgs()
 
 	if err != nil {
@@ -31,17 +37,45 @@ func main() {
 		dataStorageType = storage.NewHashMap()
 	case kece.BinarySearchTree:
 		dataStorageType = storage.NewBST()
+	case kece.Disk:
+		dataStorageType, err = storage.NewDisk(args.DataFile)
+		if err != nil {
+			fmt.Printf("\033[31m%s\033[0m\n", err.Error())
+			os.Exit(1)
+		}
 	default:
 		fmt.Printf("\033[31minvalid data storage type\033[0m\n")
 		os.Exit(1)
 	}
 
-	commander := kece.NewCommander(dataStorageType)
+	commander := kece.NewCommanderMaxKeys(dataStorageType, args.MaxKeys)
+
+	// every shard has its own data storage of the same type
+	if args.Shards > 1 {
+		dataStorages := []kece.DataStructure{dataStorageType}
+		for len(dataStorages) < args.Shards {
+			if args.DataStorageType == kece.BinarySearchTree {
+				dataStorages = append(dataStorages, storage.NewBST())
+			} else {
+				dataStorages = append(dataStorages, storage.NewHashMap())
+			}
+		}
+		commander = kece.NewShardedCommander(dataStorages, args.MaxKeys)
+	}
 
 	// call kece constructor
 	server := kece.NewServer(args, commander)
 
-	if err := server.Start(); err != nil {
+	err = server.Start()
+
+	// data file of disk data storage is flushed once server stopped
+	if closer, ok := dataStorageType.(io.Closer); ok {
+		if errClose := closer.Close(); errClose != nil {
+			fmt.Printf("\033[31m%s\033[0m\n", errClose.Error())
+		}
+	}
+
+	if err != nil {
 		fmt.Printf("\033[31m%s\033[0m\n", err.Error())
 		os.Exit(1)
 	}
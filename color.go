@@ -0,0 +1,59 @@
+package kece
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorReset  = "\033[0m"
+)
+
+var (
+	// noColor is set by -no-color flag, when true every color helper emit plain text
+	noColor     bool
+	noColorLock sync.RWMutex
+)
+
+// disableColor will make every color helper emit plain text
+func disableColor() {
+	noColorLock.Lock()
+	noColor = true
+	noColorLock.Unlock()
+}
+
+// colorize will wrap s with ANSI color code, unless color is disabled or out is not a terminal
+func colorize(color, s string, out io.Writer) string {
+	noColorLock.RLock()
+	disabled := noColor
+	noColorLock.RUnlock()
+
+	if disabled || !isTerminal(out) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func printGreenColor(s string) {
+	fmt.Println(colorize(colorGreen, s, os.Stdout))
+}
+
+// isTerminal will check whether out is a character device (terminal)
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
@@ -2,68 +2,741 @@ package kece
 
 import (
 	"bytes"
+	"container/list"
+	"context"
 	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"path"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var (
 	commands = map[string]string{
-		"AUTH":    "\x41\x55\x54\x48",
-		"SET":     "\x53\x45\x54",
-		"GET":     "\x47\x45\x54",
-		"DEL":     "\x44\x45\x4C",
-		"PUBLISH": "\x50\x55\x42\x4C\x49\x53\x48",
+		"AUTH":        "\x41\x55\x54\x48",
+		"SET":         "\x53\x45\x54",
+		"GET":         "\x47\x45\x54",
+		"DEL":         "\x44\x45\x4C",
+		"EXISTS":      "\x45\x58\x49\x53\x54\x53",
+		"MGET":        "\x4D\x47\x45\x54",
+		"TTL":         "\x54\x54\x4C",
+		"EXPIRE":      "\x45\x58\x50\x49\x52\x45",
+		"PERSIST":     "\x50\x45\x52\x53\x49\x53\x54",
+		"INCR":        "\x49\x4E\x43\x52",
+		"DECR":        "\x44\x45\x43\x52",
+		"INCRBY":      "\x49\x4E\x43\x52\x42\x59",
+		"DECRBY":      "\x44\x45\x43\x52\x42\x59",
+		"APPEND":      "\x41\x50\x50\x45\x4E\x44",
+		"STRLEN":      "\x53\x54\x52\x4C\x45\x4E",
+		"GETSET":      "\x47\x45\x54\x53\x45\x54",
+		"SETNX":       "\x53\x45\x54\x4E\x58",
+		"KEYS":        "\x4B\x45\x59\x53",
+		"DBSIZE":      "\x44\x42\x53\x49\x5A\x45",
+		"FLUSHALL":    "\x46\x4C\x55\x53\x48\x41\x4C\x4C",
+		"SAVE":        "\x53\x41\x56\x45",
+		"PUBLISH":     "\x50\x55\x42\x4C\x49\x53\x48",
+		"SUBSCRIBE":   "\x53\x55\x42\x53\x43\x52\x49\x42\x45",
+		"UNSUBSCRIBE": "\x55\x4E\x53\x55\x42\x53\x43\x52\x49\x42\x45",
+		"PING":        "\x50\x49\x4E\x47",
+		"ECHO":        "\x45\x43\x48\x4F",
+		"COMMAND":     "\x43\x4F\x4D\x4D\x41\x4E\x44",
+		"RENAME":      "\x52\x45\x4E\x41\x4D\x45",
+		"RENAMENX":    "\x52\x45\x4E\x41\x4D\x45\x4E\x58",
+		"TYPE":        "\x54\x59\x50\x45",
+		"LPUSH":       "\x4C\x50\x55\x53\x48",
+		"RPUSH":       "\x52\x50\x55\x53\x48",
+		"LPOP":        "\x4C\x50\x4F\x50",
+		"RPOP":        "\x52\x50\x4F\x50",
+		"LRANGE":      "\x4C\x52\x41\x4E\x47\x45",
+		"LLEN":        "\x4C\x4C\x45\x4E",
+		"HSET":        "\x48\x53\x45\x54",
+		"HGET":        "\x48\x47\x45\x54",
+		"HDEL":        "\x48\x44\x45\x4C",
+		"HGETALL":     "\x48\x47\x45\x54\x41\x4C\x4C",
+		"MSET":        "\x4D\x53\x45\x54",
+		"INFO":        "\x49\x4E\x46\x4F",
+		"CLIENT":      "\x43\x4C\x49\x45\x4E\x54",
+		"TOUCH":       "\x54\x4F\x55\x43\x48",
+		"CONFIG":      "\x43\x4F\x4E\x46\x49\x47",
+		"DUMP":        "\x44\x55\x4D\x50",
+		"RESTORE":     "\x52\x45\x53\x54\x4F\x52\x45",
+		"SYNC":        "\x53\x59\x4E\x43",
+		"REPLICAOF":   "\x52\x45\x50\x4C\x49\x43\x41\x4F\x46",
+		"SCAN":        "\x53\x43\x41\x4E",
+		"SELECT":      "\x53\x45\x4C\x45\x43\x54",
+		"SWAPDB":      "\x53\x57\x41\x50\x44\x42",
+		"MOVE":        "\x4D\x4F\x56\x45",
+		"MULTI":       "\x4D\x55\x4C\x54\x49",
+		"EXEC":        "\x45\x58\x45\x43",
+		"DISCARD":     "\x44\x49\x53\x43\x41\x52\x44",
+		"WATCH":       "\x57\x41\x54\x43\x48",
+		"GETRANGE":    "\x47\x45\x54\x52\x41\x4E\x47\x45",
+		"SETRANGE":    "\x53\x45\x54\x52\x41\x4E\x47\x45",
+		"SETEX":       "\x53\x45\x54\x45\x58",
+		"PSETEX":      "\x50\x53\x45\x54\x45\x58",
+		"PEXPIRE":     "\x50\x45\x58\x50\x49\x52\x45",
+		"PTTL":        "\x50\x54\x54\x4C",
+		"DEBUG":       "\x44\x45\x42\x55\x47",
+		"SLOWLOG":     "\x53\x4C\x4F\x57\x4C\x4F\x47",
+		"RANDOMKEY":   "\x52\x41\x4E\x44\x4F\x4D\x4B\x45\x59",
+		"COPY":        "\x43\x4F\x50\x59",
+		"OBJECT":      "\x4F\x42\x4A\x45\x43\x54",
+		"QUIT":        "\x51\x55\x49\x54",
+		"PEXPIREAT":   "\x50\x45\x58\x50\x49\x52\x45\x41\x54",
 	}
 
 	replies = map[string]string{
 		"OK":    "+OK\x0D\x0A",
 		"ERROR": "-ERROR\x0D\x0A",
+		"PONG":  "+PONG\x0D\x0A",
+
+		// QUEUED is reply of command sent between MULTI and EXEC
+		"QUEUED": "+QUEUED\x0D\x0A",
+
+		// MESSAGE is prefix of message delivered to channel subscribers
+		"MESSAGE": "\x4D\x45\x53\x53\x41\x47\x45",
+	}
+
+	// writeCommands are commands which mutate db
+	writeCommands = map[string]bool{
+		commands["SET"]:       true,
+		commands["DEL"]:       true,
+		commands["EXPIRE"]:    true,
+		commands["PERSIST"]:   true,
+		commands["INCR"]:      true,
+		commands["DECR"]:      true,
+		commands["INCRBY"]:    true,
+		commands["DECRBY"]:    true,
+		commands["APPEND"]:    true,
+		commands["GETSET"]:    true,
+		commands["SETNX"]:     true,
+		commands["FLUSHALL"]:  true,
+		commands["RENAME"]:    true,
+		commands["RENAMENX"]:  true,
+		commands["LPUSH"]:     true,
+		commands["RPUSH"]:     true,
+		commands["LPOP"]:      true,
+		commands["RPOP"]:      true,
+		commands["HSET"]:      true,
+		commands["HDEL"]:      true,
+		commands["MSET"]:      true,
+		commands["RESTORE"]:   true,
+		commands["SWAPDB"]:    true,
+		commands["MOVE"]:      true,
+		commands["SETRANGE"]:  true,
+		commands["SETEX"]:     true,
+		commands["PSETEX"]:    true,
+		commands["PEXPIRE"]:   true,
+		commands["PEXPIREAT"]: true,
+		commands["COPY"]:      true,
+	}
+
+	// arities are number of tokens, including command itself, accepted by commands, max -1 means no limit
+	arities = map[string]arity{
+		commands["DBSIZE"]:      {min: 1, max: 1},
+		commands["RANDOMKEY"]:   {min: 1, max: 1},
+		commands["QUIT"]:        {min: 1, max: 1},
+		commands["FLUSHALL"]:    {min: 1, max: 1},
+		commands["SAVE"]:        {min: 1, max: 1},
+		commands["INFO"]:        {min: 1, max: 1},
+		commands["SYNC"]:        {min: 1, max: 1},
+		commands["MULTI"]:       {min: 1, max: 1},
+		commands["EXEC"]:        {min: 1, max: 1},
+		commands["DISCARD"]:     {min: 1, max: 1},
+		commands["COMMAND"]:     {min: 1, max: 2},
+		commands["PING"]:        {min: 1, max: -1},
+		commands["GET"]:         {min: 2, max: 2},
+		commands["EXISTS"]:      {min: 2, max: 2},
+		commands["TTL"]:         {min: 2, max: 2},
+		commands["PTTL"]:        {min: 2, max: 2},
+		commands["PERSIST"]:     {min: 2, max: 2},
+		commands["INCR"]:        {min: 2, max: 2},
+		commands["DECR"]:        {min: 2, max: 2},
+		commands["STRLEN"]:      {min: 2, max: 2},
+		commands["KEYS"]:        {min: 2, max: 2},
+		commands["TYPE"]:        {min: 2, max: 2},
+		commands["LPOP"]:        {min: 2, max: 2},
+		commands["RPOP"]:        {min: 2, max: 2},
+		commands["LLEN"]:        {min: 2, max: 2},
+		commands["HGETALL"]:     {min: 2, max: 2},
+		commands["DUMP"]:        {min: 2, max: 2},
+		commands["SELECT"]:      {min: 2, max: 2},
+		commands["SUBSCRIBE"]:   {min: 2, max: 2},
+		commands["UNSUBSCRIBE"]: {min: 2, max: 2},
+		commands["AUTH"]:        {min: 2, max: 3},
+		commands["CLIENT"]:      {min: 2, max: 3},
+		commands["SLOWLOG"]:     {min: 2, max: 3},
+		commands["ECHO"]:        {min: 2, max: -1},
+		commands["MGET"]:        {min: 2, max: -1},
+		commands["DEL"]:         {min: 2, max: -1},
+		commands["TOUCH"]:       {min: 2, max: -1},
+		commands["WATCH"]:       {min: 2, max: -1},
+		commands["SCAN"]:        {min: 2, max: -1},
+		commands["EXPIRE"]:      {min: 3, max: 3},
+		commands["PEXPIRE"]:     {min: 3, max: 3},
+		commands["PEXPIREAT"]:   {min: 3, max: 3},
+		commands["INCRBY"]:      {min: 3, max: 3},
+		commands["DECRBY"]:      {min: 3, max: 3},
+		commands["RENAME"]:      {min: 3, max: 3},
+		commands["RENAMENX"]:    {min: 3, max: 3},
+		commands["HGET"]:        {min: 3, max: 3},
+		commands["HDEL"]:        {min: 3, max: 3},
+		commands["REPLICAOF"]:   {min: 3, max: 3},
+		commands["SWAPDB"]:      {min: 3, max: 3},
+		commands["MOVE"]:        {min: 3, max: 3},
+		commands["OBJECT"]:      {min: 3, max: 3},
+		commands["DEBUG"]:       {min: 3, max: 3},
+		commands["COPY"]:        {min: 3, max: 4},
+		commands["SET"]:         {min: 3, max: -1},
+		commands["PUBLISH"]:     {min: 3, max: -1},
+		commands["APPEND"]:      {min: 3, max: -1},
+		commands["GETSET"]:      {min: 3, max: -1},
+		commands["SETNX"]:       {min: 3, max: -1},
+		commands["MSET"]:        {min: 3, max: -1},
+		commands["LPUSH"]:       {min: 3, max: -1},
+		commands["RPUSH"]:       {min: 3, max: -1},
+		commands["CONFIG"]:      {min: 3, max: -1},
+		commands["LRANGE"]:      {min: 4, max: 4},
+		commands["GETRANGE"]:    {min: 4, max: 4},
+		commands["RESTORE"]:     {min: 4, max: 5},
+		commands["HSET"]:        {min: 4, max: -1},
+		commands["SETRANGE"]:    {min: 4, max: -1},
+		commands["SETEX"]:       {min: 4, max: -1},
+		commands["PSETEX"]:      {min: 4, max: -1},
+	}
+
+	// publicCommands are commands which can be sent before AUTH
+	publicCommands = map[string]bool{
+		commands["AUTH"]: true,
+		commands["PING"]: true,
+		commands["ECHO"]: true,
+		commands["QUIT"]: true,
+	}
+
+	// transactionCommands are commands which control transaction, they are run right away instead of queued
+	transactionCommands = map[string]bool{
+		commands["MULTI"]:   true,
+		commands["EXEC"]:    true,
+		commands["DISCARD"]: true,
+		commands["WATCH"]:   true,
 	}
 
 	crlf = "\x0D\x0A"
-	lock = &sync.Mutex{}
 )
 
+// arity is range of number of tokens accepted by command
+type arity struct {
+	min, max int
+}
+
+// KeyValue is a key and value pair of batched write
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// BatchSetter is an optional interface of Commander, it apply many writes under a single lock
+type BatchSetter interface {
+	BatchSet(ctx context.Context, pairs []KeyValue) error
+}
+
+// batchSet will use BatchSet if commander implement it, otherwise every pair is written by Set one by one
+func batchSet(ctx context.Context, commander Commander, pairs []KeyValue) error {
+	if batch, ok := commander.(BatchSetter); ok {
+		return batch.BatchSet(ctx, pairs)
+	}
+
+	for _, pair := range pairs {
+		if _, err := commander.Set(ctx, []byte(commands["SET"]), pair.Key, pair.Value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Commander interface
+// ctx bound every command, implementation should return error of ctx once it is done
+// so the server can reply ERROR instead of waiting a slow backend
 type Commander interface {
-	Auth(command, key, value []byte) error
-	Set(command, key, value []byte) (*Schema, error)
-	Get(command, key []byte) (*Schema, error)
-	Delete(command, key []byte) error
-	Publish(topic string, command, value []byte) ([]byte, error)
+	Set(ctx context.Context, command, key, value []byte, exp time.Duration) (*Schema, error)
+	Get(ctx context.Context, command, key []byte) (*Schema, error)
+	Delete(ctx context.Context, command, key []byte) error
+	DeleteMany(ctx context.Context, keys [][]byte) ([][]byte, error)
+	Touch(ctx context.Context, keys [][]byte) (int, error)
+	Exists(ctx context.Context, command, key []byte) (bool, error)
+	TTL(ctx context.Context, command, key []byte) (int64, error)
+	PTTL(ctx context.Context, key []byte) (int64, error)
+	Expire(ctx context.Context, key []byte, seconds int) (bool, error)
+	PExpire(ctx context.Context, key []byte, milliseconds int) (bool, error)
+	PExpireAt(ctx context.Context, key []byte, milliseconds int64) (bool, error)
+	Persist(ctx context.Context, key []byte) (bool, error)
+	Incr(ctx context.Context, key []byte, delta int64) (int64, error)
+	Append(ctx context.Context, key, value []byte) (int, error)
+	Strlen(ctx context.Context, key []byte) (int, error)
+	GetRange(ctx context.Context, key []byte, start, end int) ([]byte, error)
+	SetRange(ctx context.Context, key []byte, offset int, value []byte) (int, error)
+	GetSet(ctx context.Context, key, value []byte) ([]byte, error)
+	SetNX(ctx context.Context, key, value []byte) (bool, error)
+	Rename(ctx context.Context, oldKey, newKey []byte) error
+	RenameNX(ctx context.Context, oldKey, newKey []byte) (bool, error)
+	Copy(ctx context.Context, source, destination []byte, replace bool) (bool, error)
+	Type(ctx context.Context, key []byte) (string, error)
+	Dump(ctx context.Context, key []byte) ([]byte, error)
+	Restore(ctx context.Context, key, blob []byte, ttl time.Duration, replace bool) error
+	Push(ctx context.Context, key []byte, values [][]byte, left bool) (int, error)
+	Pop(ctx context.Context, key []byte, left bool) ([]byte, error)
+	LRange(ctx context.Context, key []byte, start, stop int) ([][]byte, error)
+	LLen(ctx context.Context, key []byte) (int, error)
+	HSet(ctx context.Context, key, field, value []byte) (int, error)
+	HGet(ctx context.Context, key, field []byte) ([]byte, error)
+	HDel(ctx context.Context, key, field []byte) (int, error)
+	HGetAll(ctx context.Context, key []byte) ([][]byte, error)
+	Keys(ctx context.Context, pattern string) ([][]byte, error)
+	RandomKey(ctx context.Context) ([]byte, error)
+	Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, [][]byte, error)
+	Size(ctx context.Context) (int, error)
+	Flush(ctx context.Context) error
+	Snapshot() ([]SnapshotEntry, error)
+	Load(entries []SnapshotEntry) error
+	DeleteExpired() int
+	Evictions() int64
+	Inspect(key []byte) (ObjectInfo, error)
+}
+
+// ObjectInfo is internal metadata of key reported by DEBUG OBJECT
+type ObjectInfo struct {
+	Type string
+	// Length is number of bytes of string, elements of list or fields of hash
+	Length int
+	// Deadline is zero if key has no lifetime
+	Deadline time.Time
+	// Accessed is the last time key is read or written, Hits is the number of times it is read or written
+	Accessed time.Time
+	Hits     int64
+}
+
+// usage is access statistic of a key, it is reported by DEBUG OBJECT and OBJECT
+type usage struct {
+	accessed time.Time
+	hits     int64
 }
 
 // NewCommander function, Commander's constructor
 func NewCommander(dataStorage DataStructure) Commander {
-	return &commander{ds: dataStorage}
+	return NewCommanderMaxKeys(dataStorage, 0)
+}
+
+// NewCommanderMaxKeys function, Commander's constructor with limited number of keys.
+// Once maxKeys is exceeded, the least recently used key is evicted on write. Zero maxKeys means unlimited
+func NewCommanderMaxKeys(dataStorage DataStructure, maxKeys int) Commander {
+	return newCommander(dataStorage, maxKeys, &sync.Mutex{})
+}
+
+// newCommander will return commander of storage guarded by lock, commanders sharing storage must share lock too
+func newCommander(dataStorage DataStructure, maxKeys int, lock *sync.Mutex) *commander {
+	index := newScanIndex(dataStorage)
+	return &commander{
+		ds:       index,
+		index:    index,
+		expires:  make(map[string]time.Time),
+		maxKeys:  maxKeys,
+		recent:   list.New(),
+		elements: make(map[string]*list.Element),
+		usages:   make(map[string]*usage),
+		versions: make(map[string]uint64),
+		lock:     lock,
+	}
+}
+
+// shardsOf will return every shard of cmd, commander of NewCommander is a single shard.
+// nil is returned for Commander other than the one of NewCommander and NewShardedCommander
+func shardsOf(cmd Commander) []*commander {
+	switch c := cmd.(type) {
+	case *commander:
+		return []*commander{c}
+	case *shardedCommander:
+		return c.shards
+	}
+	return nil
+}
+
+// shardOf will return shard of cmd holding key, nil is returned like shardsOf
+func shardOf(cmd Commander, key []byte) *commander {
+	shards := shardsOf(cmd)
+	if shards == nil {
+		return nil
+	}
+	return shards[shardIndex(key, len(shards))]
+}
+
+// shardIndex will return index of shard holding key, key of the same SCAN position is always in the same shard
+func shardIndex(key []byte, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return int(scanPosition(key) % uint64(n))
+}
+
+// lockShards will lock every shard and return function unlocking them. Shards must be ordered by index,
+// so commands locking several shards never wait each other
+func lockShards(shards []*commander) func() {
+	for _, shard := range shards {
+		shard.lock.Lock()
+	}
+
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			shards[i].lock.Unlock()
+		}
+	}
+}
+
+// newDatabases will return n logical databases, cmd is database 0 and every other database share its storage.
+// Commander other than the one of NewCommander and NewShardedCommander has only database 0
+func newDatabases(cmd Commander, n int) []Commander {
+	databases := []Commander{cmd}
+	shards := shardsOf(cmd)
+	if shards == nil || n <= 1 {
+		return databases
+	}
+
+	_, sharded := cmd.(*shardedCommander)
+	for i := 1; i < n; i++ {
+		database := make([]*commander, 0, len(shards))
+		for _, shard := range shards {
+			database = append(database, shard.database(i))
+		}
+
+		if sharded {
+			databases = append(databases, &shardedCommander{shards: database})
+			continue
+		}
+		databases = append(databases, database[0])
+	}
+
+	// keys of other databases are hidden from database 0
+	for _, shard := range shards {
+		shard.index = newScanIndex(newNamespace(shard.storage(), 0))
+		shard.ds = shard.index
+	}
+	return databases
+}
+
+// swapDatabases will exchange keys of two databases created by newDatabases, keys are moved in storage
+// so they stay in the swapped database after restart. Every shard of both is swapped under the same lock,
+// so no command sees keys of one database but not the other
+func swapDatabases(ctx context.Context, a, b Commander) error {
+	first, second := shardsOf(a), shardsOf(b)
+	if first == nil || second == nil || len(first) != len(second) {
+		return errors.New(ErrorInvalidOperation)
+	}
+
+	// shard of every database share lock with shard of the same index of other databases
+	unlock := lockShards(first)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for i := range first {
+		if err := swapShards(first[i], second[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapShards must be called while holding lock of both
+func swapShards(first, second *commander) error {
+	if first == second {
+		return nil
+	}
+
+	firstSchemas, err := first.takeAll()
+	if err != nil {
+		return err
+	}
+
+	secondSchemas, err := second.takeAll()
+	if err != nil {
+		return err
+	}
+
+	for _, schema := range firstSchemas {
+		second.ds.InsertSchema(schema)
+	}
+
+	for _, schema := range secondSchemas {
+		first.ds.InsertSchema(schema)
+	}
+
+	first.expires, second.expires = second.expires, first.expires
+	first.recent, second.recent = second.recent, first.recent
+	first.elements, second.elements = second.elements, first.elements
+	first.usages, second.usages = second.usages, first.usages
+	first.forget()
+	second.forget()
+	return nil
+}
+
+// moveKey will move key with its lifetime from database src to dst, false is returned if key doesn't exist in src
+// or already exists in dst. Key is written to dst and deleted from src under the same lock
+func moveKey(ctx context.Context, src, dst Commander, key []byte) (bool, error) {
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	from := shardOf(src, key)
+	to := shardOf(dst, key)
+	if from == nil || to == nil {
+		return false, errors.New(ErrorInvalidOperation)
+	}
+
+	from.lock.Lock()
+	defer from.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	if from == to {
+		return false, nil
+	}
+
+	if _, err := from.search(key); err != nil {
+		return false, nil
+	}
+
+	if _, err := to.search(key); err == nil {
+		return false, nil
+	}
+	return true, renameKey(from, to, key, key)
+}
+
+// keyVersion will return version of key in cmd, it is changed every time key is written, deleted or its lifetime is changed.
+// Commander other than the one of NewCommander and NewShardedCommander has no version
+func keyVersion(ctx context.Context, cmd Commander, key []byte) (uint64, error) {
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	c := shardOf(cmd, key)
+	if c == nil {
+		return 0, errors.New(ErrorInvalidOperation)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if version, ok := c.versions[string(key)]; ok {
+		return version, nil
+	}
+	return c.deleted, nil
 }
 
 type commander struct {
 	ds DataStructure
+
+	// index is ds indexing keys by SCAN position
+	index *scanIndex
+
+	// expires hold expiration deadline of every key that has lifetime
+	expires map[string]time.Time
+
+	// recent order keys from the most recently used, elements index its elements by key
+	maxKeys   int
+	recent    *list.List
+	elements  map[string]*list.Element
+	evictions int64
+
+	// usages hold the last access and number of accesses of every key
+	usages map[string]*usage
+
+	// version is increased on every write, versions hold version of the last write of every key.
+	// Key without version, deleted or not, has version of the last delete, so WATCH of missing key
+	// notice it is created even if it is deleted again
+	version  uint64
+	deleted  uint64
+	versions map[string]uint64
+
+	// lock guard every command, it is shared by every logical database of the same storage
+	lock *sync.Mutex
+
+	// onExpired is called with key deleted once it passed its deadline, while lock is held
+	onExpired func(key []byte)
 }
 
-// Auth will set auth to kece server
-func (c *commander) Auth(command, key, value []byte) error {
-	lock.Lock()
-	defer lock.Unlock()
+// database will return commander of logical database index in the same storage, guarded by the same lock
+func (c *commander) database(index int) *commander {
+	return newCommander(newNamespace(c.storage(), index), c.maxKeys, c.lock)
+}
 
-	_, ok := commands[string(command)]
+// storage will return storage of c without namespace of database 0, it is already wrapped if c is shared by several servers
+func (c *commander) storage() DataStructure {
+	if wrapped, ok := c.index.ds.(*namespace); ok && len(wrapped.prefix) == 0 {
+		return wrapped.ds
+	}
+	return c.index.ds
+}
+
+// search will find key in db, key that already passed its deadline is deleted and treated as not found
+func (c *commander) search(key []byte) (*Schema, error) {
+	deadline, ok := c.expires[string(key)]
+	if ok && !time.Now().Before(deadline) {
+		delete(c.expires, string(key))
+		if err := c.delete(key); err != nil {
+			return nil, err
+		}
+		c.expired(key)
+		return nil, errors.New(ErrorEmptyValue)
+	}
+
+	result, err := c.ds.Search(key)
+	if err == nil {
+		c.touch(key)
+	}
+	return result, err
+}
+
+// expired will call onExpired of key deleted once it passed its deadline
+func (c *commander) expired(key []byte) {
+	if c.onExpired != nil {
+		c.onExpired(key)
+	}
+}
+
+// insert will store value of key, key is marked as the most recently used
+func (c *commander) insert(key, value []byte) *Schema {
+	newData := c.ds.Insert(key, value)
+	c.modified(key)
+	c.touch(key)
+	c.evict()
+	return newData
+}
+
+// insertSchema will store schema of any data type, key is marked as the most recently used
+func (c *commander) insertSchema(schema *Schema) *Schema {
+	newData := c.ds.InsertSchema(schema)
+	c.modified(schema.Key)
+	c.touch(schema.Key)
+	c.evict()
+	return newData
+}
+
+// delete will delete key from db and from access order
+func (c *commander) delete(key []byte) error {
+	if element, ok := c.elements[string(key)]; ok {
+		c.recent.Remove(element)
+		delete(c.elements, string(key))
+	}
+	delete(c.usages, string(key))
+
+	c.version++
+	c.deleted = c.version
+	delete(c.versions, string(key))
+	return c.ds.Delete(key)
+}
+
+// modified will increase version of key
+func (c *commander) modified(key []byte) {
+	c.version++
+	c.versions[string(key)] = c.version
+}
+
+// forget will drop version of every key once keys are changed without insert or delete,
+// so every key has version of the last delete which is increased here
+func (c *commander) forget() {
+	c.version++
+	c.deleted = c.version
+	c.versions = make(map[string]uint64)
+}
+
+// takeAll will remove every key from storage and return their schema, lifetime and recency are kept
+func (c *commander) takeAll() ([]*Schema, error) {
+	keys := c.ds.Keys()
+	schemas := make([]*Schema, 0, len(keys))
+	for _, key := range keys {
+		result, err := c.ds.Search(key)
+		if err != nil {
+			continue
+		}
+		schemas = append(schemas, result)
+	}
+
+	for _, schema := range schemas {
+		if err := c.ds.Delete(schema.Key); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// touch will mark key as the most recently used, access order is tracked only if maxKeys is set
+func (c *commander) touch(key []byte) {
+	u, ok := c.usages[string(key)]
 	if !ok {
-		return errors.New(ErrorInvalidCommand)
+		u = &usage{}
+		c.usages[string(key)] = u
 	}
+	u.accessed = time.Now()
+	u.hits++
 
-	// remove line feed and carriage return (13/10)/ CR/LF
-	key = bytes.Trim(key, crlf)
-	value = bytes.Trim(value, crlf)
+	if c.maxKeys <= 0 {
+		return
+	}
 
-	c.ds.Insert(key, value)
-	return nil
+	if element, ok := c.elements[string(key)]; ok {
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.elements[string(key)] = c.recent.PushFront(string(key))
+}
+
+// evict will delete the least recently used keys until number of keys is not greater than maxKeys
+func (c *commander) evict() {
+	if c.maxKeys <= 0 {
+		return
+	}
+
+	for c.recent.Len() > c.maxKeys {
+		oldest := c.recent.Back()
+		key := oldest.Value.(string)
+
+		delete(c.expires, key)
+		if err := c.delete([]byte(key)); err == nil {
+			c.evictions++
+		}
+	}
+}
+
+// searchType will find key holding value of dataType, missing key is returned as nil without error
+// and key holding value of other type return ErrorWrongType
+func (c *commander) searchType(key []byte, dataType string) (*Schema, error) {
+	result, err := c.search(key)
+	if err != nil {
+		return nil, nil
+	}
+
+	if result.DataType() != dataType {
+		return nil, errors.New(ErrorWrongType)
+	}
+	return result, nil
 }
 
-// Set will set value to db
-func (c *commander) Set(command, key, value []byte) (*Schema, error) {
-	lock.Lock()
-	defer lock.Unlock()
+// Set will set value to db, value will be deleted after exp if exp is greater than zero
+func (c *commander) Set(ctx context.Context, command, key, value []byte, exp time.Duration) (*Schema, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	_, ok := commands[string(command)]
 	if !ok {
@@ -72,16 +745,50 @@ func (c *commander) Set(command, key, value []byte) (*Schema, error) {
 
 	// remove line feed and carriage return (13/10)/ CR/LF
 	key = bytes.Trim(key, crlf)
-	value = bytes.Trim(value, crlf)
 
-	newData := c.ds.Insert(key, value)
+	newData := c.insert(key, value)
+
+	// overwrite always reset the old lifetime
+	delete(c.expires, string(key))
+	if exp > 0 {
+		c.expires[string(key)] = newData.Timestamp.Add(exp)
+	}
 	return newData, nil
 }
 
+// BatchSet will set every key and value pair under a single lock, so reader never see partial update.
+// Like SET, the old lifetime of every key is removed
+func (c *commander) BatchSet(ctx context.Context, pairs []KeyValue) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.setPairs(pairs)
+	return nil
+}
+
+// setPairs must be called while holding lock
+func (c *commander) setPairs(pairs []KeyValue) {
+	for _, pair := range pairs {
+		// remove line feed and carriage return (13/10)/ CR/LF
+		key := bytes.Trim(pair.Key, crlf)
+
+		c.insert(key, pair.Value)
+		delete(c.expires, string(key))
+	}
+}
+
 // Get will get value from db
-func (c *commander) Get(command, key []byte) (*Schema, error) {
-	lock.Lock()
-	defer lock.Unlock()
+func (c *commander) Get(ctx context.Context, command, key []byte) (*Schema, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	_, ok := commands[string(command)]
 	if !ok {
@@ -90,13 +797,26 @@ func (c *commander) Get(command, key []byte) (*Schema, error) {
 
 	// remove line feed and carriage return (13/10)/ CR/LF
 	key = bytes.Trim(key, crlf)
-	return c.ds.Search(key)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, errors.New(ErrorEmptyValue)
+	}
+	return result, nil
 }
 
 // Delete will get value from db
-func (c *commander) Delete(command, key []byte) error {
-	lock.Lock()
-	defer lock.Unlock()
+func (c *commander) Delete(ctx context.Context, command, key []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	_, ok := commands[string(command)]
 	if !ok {
@@ -106,11 +826,1109 @@ func (c *commander) Delete(command, key []byte) error {
 	// remove line feed and carriage return (13/10)/ CR/LF
 	key = bytes.Trim(key, crlf)
 
-	return c.ds.Delete(key)
+	delete(c.expires, string(key))
+	return c.delete(key)
+}
+
+// DeleteMany will delete every key at once and return keys actually deleted, missing key is not returned
+func (c *commander) DeleteMany(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var deleted [][]byte
+	for _, key := range keys {
+		// remove line feed and carriage return (13/10)/ CR/LF
+		key = bytes.Trim(key, crlf)
+
+		// expired key is already gone, so it is not counted
+		if _, err := c.search(key); err != nil {
+			continue
+		}
+
+		delete(c.expires, string(key))
+		if err := c.delete(key); err == nil {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
+
+// Touch will mark every key as the most recently used without reading its value,
+// it return number of keys which exist
+func (c *commander) Touch(ctx context.Context, keys [][]byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	touched := 0
+	for _, key := range keys {
+		// remove line feed and carriage return (13/10)/ CR/LF
+		key = bytes.Trim(key, crlf)
+
+		// search mark key as the most recently used
+		if _, err := c.search(key); err == nil {
+			touched++
+		}
+	}
+	return touched, nil
+}
+
+// Exists will check whether key is present in db without returning its value
+func (c *commander) Exists(ctx context.Context, command, key []byte) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	_, ok := commands[string(command)]
+	if !ok {
+		return false, errors.New(ErrorInvalidCommand)
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	_, err := c.search(key)
+	return err == nil, nil
+}
+
+// TTL will return remaining lifetime of key in seconds,
+// -1 if key has no lifetime and -2 if key is not exist (same as redis)
+func (c *commander) TTL(ctx context.Context, command, key []byte) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	_, ok := commands[string(command)]
+	if !ok {
+		return 0, errors.New(ErrorInvalidCommand)
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	remaining, status := c.lifetime(key)
+	if status < 0 {
+		return status, nil
+	}
+	return int64((remaining + time.Second/2) / time.Second), nil
+}
+
+// PTTL will return remaining lifetime of key in milliseconds, -1 and -2 like TTL
+func (c *commander) PTTL(ctx context.Context, key []byte) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	remaining, status := c.lifetime(key)
+	if status < 0 {
+		return status, nil
+	}
+	return int64((remaining + time.Millisecond/2) / time.Millisecond), nil
+}
+
+// lifetime will return remaining lifetime of key, status is -1 if key has no lifetime and -2 if key is not exist
+func (c *commander) lifetime(key []byte) (time.Duration, int64) {
+	if _, err := c.search(key); err != nil {
+		return 0, -2
+	}
+
+	deadline, ok := c.expires[string(key)]
+	if !ok {
+		return 0, -1
+	}
+	return time.Until(deadline), 0
+}
+
+// lifetimeDuration will convert lifetime of unit to time.Duration, false is returned if it overflows
+func lifetimeDuration(lifetime int64, unit time.Duration) (time.Duration, bool) {
+	max := int64(math.MaxInt64) / int64(unit)
+	if lifetime > max || lifetime < -max {
+		return 0, false
+	}
+	return time.Duration(lifetime) * unit, true
 }
 
-// Publish will publish message to specific topic
-//TODO
-func (c *commander) Publish(topic string, command, value []byte) ([]byte, error) {
-	return nil, nil
+// Expire will set lifetime of an existing key, return false if key is not exist
+func (c *commander) Expire(ctx context.Context, key []byte, seconds int) (bool, error) {
+	lifetime, ok := lifetimeDuration(int64(seconds), time.Second)
+	if !ok {
+		return false, errors.New(ErrorInvalidArgument)
+	}
+	return c.expire(ctx, key, time.Now().Add(lifetime))
+}
+
+// PExpire will set lifetime of an existing key in milliseconds, return false if key is not exist
+func (c *commander) PExpire(ctx context.Context, key []byte, milliseconds int) (bool, error) {
+	lifetime, ok := lifetimeDuration(int64(milliseconds), time.Millisecond)
+	if !ok {
+		return false, errors.New(ErrorInvalidArgument)
+	}
+	return c.expire(ctx, key, time.Now().Add(lifetime))
+}
+
+// PExpireAt will set deadline of an existing key as unix time in milliseconds, return false if key is not exist.
+// Key is treated as expired right away if deadline is already passed
+func (c *commander) PExpireAt(ctx context.Context, key []byte, milliseconds int64) (bool, error) {
+	return c.expire(ctx, key, time.Unix(milliseconds/1000, milliseconds%1000*int64(time.Millisecond)))
+}
+
+// expire will set deadline of an existing key, it is shared by Expire, PExpire and PExpireAt
+func (c *commander) expire(ctx context.Context, key []byte, deadline time.Time) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	if _, err := c.search(key); err != nil {
+		return false, nil
+	}
+
+	c.expires[string(key)] = deadline
+	c.modified(key)
+	return true, nil
+}
+
+// Persist will remove lifetime of key, return false if key is not exist or has no lifetime
+func (c *commander) Persist(ctx context.Context, key []byte) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	if _, err := c.search(key); err != nil {
+		return false, nil
+	}
+
+	if _, ok := c.expires[string(key)]; !ok {
+		return false, nil
+	}
+
+	delete(c.expires, string(key))
+	c.modified(key)
+	return true, nil
+}
+
+// Incr will add delta to integer value of key and return the new value, missing key is treated as 0
+func (c *commander) Incr(ctx context.Context, key []byte, delta int64) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if result != nil {
+		current, err = strconv.ParseInt(string(result.Value), 10, 64)
+		if err != nil {
+			return 0, errors.New(ErrorNotInteger)
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, errors.New(ErrorNotInteger)
+	}
+
+	current += delta
+	c.insert(key, []byte(strconv.FormatInt(current, 10)))
+	return current, nil
+}
+
+// Append will concatenate value to the end of value of key and return the new length, missing key is created
+func (c *commander) Append(ctx context.Context, key, value []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return 0, err
+	}
+
+	var newValue []byte
+	if result != nil {
+		newValue = append(newValue, result.Value...)
+	}
+	newValue = append(newValue, value...)
+
+	c.insert(key, newValue)
+	return len(newValue), nil
+}
+
+// Strlen will return length of value of key, 0 if key is not exist
+func (c *commander) Strlen(ctx context.Context, key []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil || result == nil {
+		return 0, err
+	}
+	return len(result.Value), nil
+}
+
+// GetRange will return bytes of value between start and end inclusive, negative index is counted from the end.
+// Out of range index is clamped, missing key is treated as empty value
+func (c *commander) GetRange(ctx context.Context, key []byte, start, end int) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return []byte{}, nil
+	}
+
+	length := len(result.Value)
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+
+	if start > end {
+		return []byte{}, nil
+	}
+
+	value := make([]byte, end-start+1)
+	copy(value, result.Value[start:end+1])
+	return value, nil
+}
+
+// SetRange will overwrite value of key from offset and return the new length, value is padded with zero bytes
+// if offset is past its end. Missing key is treated as empty value, lifetime of key is kept
+func (c *commander) SetRange(ctx context.Context, key []byte, offset int, value []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	if offset < 0 || offset+len(value) > maxBulkLength {
+		return 0, errors.New(ErrorInvalidArgument)
+	}
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return 0, err
+	}
+
+	var newValue []byte
+	if result != nil {
+		newValue = append(newValue, result.Value...)
+	}
+
+	// empty value doesn't create missing key
+	if len(value) == 0 {
+		return len(newValue), nil
+	}
+
+	if end := offset + len(value); end > len(newValue) {
+		newValue = append(newValue, make([]byte, end-len(newValue))...)
+	}
+	copy(newValue[offset:], value)
+
+	c.insert(key, newValue)
+	return len(newValue), nil
+}
+
+// GetSet will set value of key and return its old value, nil if key was not exist.
+// Like SET, the old lifetime of key is removed
+func (c *commander) GetSet(ctx context.Context, key, value []byte) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldValue []byte
+	if result != nil {
+		oldValue = result.Value
+	}
+
+	c.insert(key, value)
+	delete(c.expires, string(key))
+	return oldValue, nil
+}
+
+// SetNX will set value of key only if key is not exist, return false if key is already exist
+func (c *commander) SetNX(ctx context.Context, key, value []byte) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	if _, err := c.search(key); err == nil {
+		return false, nil
+	}
+
+	c.insert(key, value)
+	return true, nil
+}
+
+// Rename will move value and lifetime of oldKey to newKey, value of newKey is overwritten
+func (c *commander) Rename(ctx context.Context, oldKey, newKey []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	oldKey = bytes.Trim(oldKey, crlf)
+	newKey = bytes.Trim(newKey, crlf)
+
+	return renameKey(c, c, oldKey, newKey)
+}
+
+// RenameNX will rename oldKey only if newKey is not exist, return false if newKey is already exist
+func (c *commander) RenameNX(ctx context.Context, oldKey, newKey []byte) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	oldKey = bytes.Trim(oldKey, crlf)
+	newKey = bytes.Trim(newKey, crlf)
+
+	if _, err := c.search(oldKey); err != nil {
+		return false, err
+	}
+
+	if _, err := c.search(newKey); err == nil {
+		return false, nil
+	}
+	return true, renameKey(c, c, oldKey, newKey)
+}
+
+// Copy will duplicate value and lifetime of source to destination, false is returned if source is not exist
+// or destination already exists and replace is false
+func (c *commander) Copy(ctx context.Context, source, destination []byte, replace bool) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	source = bytes.Trim(source, crlf)
+	destination = bytes.Trim(destination, crlf)
+
+	return copyKey(c, c, source, destination, replace)
+}
+
+// copyKey will duplicate value and lifetime of source in from to destination in to, it must be called while holding lock of both
+func copyKey(from, to *commander, source, destination []byte, replace bool) (bool, error) {
+	if from == to && bytes.Equal(source, destination) {
+		return false, errors.New(ErrorInvalidOperation)
+	}
+
+	result, err := from.search(source)
+	if err != nil {
+		return false, nil
+	}
+
+	if _, err := to.search(destination); err == nil && !replace {
+		return false, nil
+	}
+
+	// list and hash are copied too, so writes to one key never change the other
+	copied := *result
+	copied.Key = destination
+	copied.Value = append([]byte(nil), result.Value...)
+	if result.List != nil {
+		copied.List = make([][]byte, 0, len(result.List))
+		for _, element := range result.List {
+			copied.List = append(copied.List, append([]byte(nil), element...))
+		}
+	}
+
+	if result.Hash != nil {
+		copied.Hash = make(map[string][]byte, len(result.Hash))
+		for field, value := range result.Hash {
+			copied.Hash[field] = append([]byte(nil), value...)
+		}
+	}
+
+	to.insertSchema(&copied)
+	delete(to.expires, string(destination))
+	if deadline, ok := from.expires[string(source)]; ok {
+		to.expires[string(destination)] = deadline
+	}
+	return true, nil
+}
+
+// renameKey will move value and lifetime of oldKey in from to newKey in to, it must be called while holding lock of both
+func renameKey(from, to *commander, oldKey, newKey []byte) error {
+	result, err := from.search(oldKey)
+	if err != nil {
+		return err
+	}
+
+	if from == to && bytes.Equal(oldKey, newKey) {
+		return nil
+	}
+
+	moved := *result
+	moved.Key = newKey
+	to.insertSchema(&moved)
+	delete(to.expires, string(newKey))
+	if deadline, ok := from.expires[string(oldKey)]; ok {
+		to.expires[string(newKey)] = deadline
+		delete(from.expires, string(oldKey))
+	}
+	return from.delete(oldKey)
+}
+
+// Type will return data type of value of key, TypeNone if key is not exist
+func (c *commander) Type(ctx context.Context, key []byte) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.search(key)
+	if err != nil {
+		return TypeNone, nil
+	}
+	return result.DataType(), nil
+}
+
+// Dump will serialize value of key, so it can be restored by Restore on another server
+func (c *commander) Dump(ctx context.Context, key []byte) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.search(key)
+	if err != nil {
+		return nil, err
+	}
+	return encodeDump(dumpValue{Type: result.Type, Value: result.Value, List: result.List, Hash: result.Hash})
+}
+
+// Restore will create key from blob of Dump with lifetime of ttl, zero ttl means no lifetime the same way as redis does.
+// It fails if key already exists unless replace is true
+func (c *commander) Restore(ctx context.Context, key, blob []byte, ttl time.Duration, replace bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ttl < 0 {
+		return errors.New(ErrorInvalidArgument)
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	value, err := decodeDump(bytes.Trim(blob, crlf))
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.search(key); err == nil && !replace {
+		return errors.New(ErrorKeyExists)
+	}
+
+	c.insertSchema(&Schema{Key: key, Value: value.Value, Type: value.Type, List: value.List, Hash: value.Hash})
+	delete(c.expires, string(key))
+	if ttl > 0 {
+		c.expires[string(key)] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// Push will insert values to the head of list if left is true, otherwise to the tail, and return the new length.
+// Missing key is created as empty list
+func (c *commander) Push(ctx context.Context, key []byte, values [][]byte, left bool) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeList)
+	if err != nil {
+		return 0, err
+	}
+
+	if result == nil {
+		result = &Schema{Key: key, Type: TypeList}
+	}
+
+	list := make([][]byte, 0, len(result.List)+len(values))
+	if left {
+		// every value is pushed to the head one by one => ex: LPUSH k a b c -> c b a
+		for i := len(values) - 1; i >= 0; i-- {
+			list = append(list, values[i])
+		}
+		list = append(list, result.List...)
+	} else {
+		list = append(list, result.List...)
+		list = append(list, values...)
+	}
+
+	result.List = list
+	c.insertSchema(result)
+	return len(list), nil
+}
+
+// Pop will remove and return the head of list if left is true, otherwise the tail.
+// nil is returned if key is not exist, list is deleted once its last element is popped
+func (c *commander) Pop(ctx context.Context, key []byte, left bool) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeList)
+	if err != nil || result == nil || len(result.List) == 0 {
+		return nil, err
+	}
+
+	var value []byte
+	if left {
+		value, result.List = result.List[0], result.List[1:]
+	} else {
+		last := len(result.List) - 1
+		value, result.List = result.List[last], result.List[:last]
+	}
+
+	if len(result.List) == 0 {
+		delete(c.expires, string(key))
+		return value, c.delete(key)
+	}
+
+	c.insertSchema(result)
+	return value, nil
+}
+
+// LRange will return elements of list between start and stop inclusive, negative index is counted from the end.
+// Out of range index is clamped, missing key is treated as empty list
+func (c *commander) LRange(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeList)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	length := len(result.List)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	if start > stop {
+		return nil, nil
+	}
+
+	elements := make([][]byte, stop-start+1)
+	copy(elements, result.List[start:stop+1])
+	return elements, nil
+}
+
+// LLen will return number of elements in list, 0 if key is not exist
+func (c *commander) LLen(ctx context.Context, key []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeList)
+	if err != nil || result == nil {
+		return 0, err
+	}
+	return len(result.List), nil
+}
+
+// HSet will set field of hash to value and return 1 if field is new, 0 if field is updated.
+// Missing key is created as empty hash
+func (c *commander) HSet(ctx context.Context, key, field, value []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeHash)
+	if err != nil {
+		return 0, err
+	}
+
+	if result == nil {
+		result = &Schema{Key: key, Type: TypeHash, Hash: make(map[string][]byte)}
+	}
+
+	added := 1
+	if _, ok := result.Hash[string(field)]; ok {
+		added = 0
+	}
+
+	result.Hash[string(field)] = value
+	c.insertSchema(result)
+	return added, nil
+}
+
+// HGet will return value of field of hash, nil if key or field is not exist
+func (c *commander) HGet(ctx context.Context, key, field []byte) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeHash)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return result.Hash[string(field)], nil
+}
+
+// HDel will delete field of hash and return number of deleted fields,
+// hash is deleted once its last field is deleted
+func (c *commander) HDel(ctx context.Context, key, field []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeHash)
+	if err != nil || result == nil {
+		return 0, err
+	}
+
+	if _, ok := result.Hash[string(field)]; !ok {
+		return 0, nil
+	}
+
+	delete(result.Hash, string(field))
+	if len(result.Hash) == 0 {
+		delete(c.expires, string(key))
+		return 1, c.delete(key)
+	}
+
+	c.insertSchema(result)
+	return 1, nil
+}
+
+// HGetAll will return every field and value of hash alternately, nil if key is not exist
+func (c *commander) HGetAll(ctx context.Context, key []byte) ([][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	result, err := c.searchType(key, TypeHash)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	pairs := make([][]byte, 0, 2*len(result.Hash))
+	for field, value := range result.Hash {
+		pairs = append(pairs, []byte(field), value)
+	}
+	return pairs, nil
+}
+
+// Keys will return every key matching the glob style pattern (path.Match semantics), "*" match all keys
+func (c *commander) Keys(ctx context.Context, pattern string) ([][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// validate pattern once, so bad pattern is reported even on empty db
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var keys [][]byte
+	for _, key := range c.ds.Keys() {
+		if deadline, ok := c.expires[string(key)]; ok && !now.Before(deadline) {
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, string(key)); matched {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RandomKey will return a live key picked uniformly, nil is returned if db is empty.
+// Every key is visited to skip expired ones, so it costs as much as KEYS
+func (c *commander) RandomKey(ctx context.Context) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var keys [][]byte
+	for _, key := range c.ds.Keys() {
+		if deadline, ok := c.expires[string(key)]; ok && !now.Before(deadline) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys[rand.Intn(len(keys))], nil
+}
+
+// defaultScanCount is the number of keys returned by SCAN without COUNT
+const defaultScanCount = 10
+
+// scanPosition return position of key in SCAN order, it depends only on the key so the order is stable
+// while other keys are written. Position is never zero, zero cursor start a new iteration
+func scanPosition(key []byte) uint64 {
+	h := fnv.New32a()
+	h.Write(key)
+	return uint64(h.Sum32()) + 1
+}
+
+// Scan will return about count keys from cursor in SCAN order and the cursor of the next call, zero cursor start
+// the iteration and zero next cursor means it is done. Only buckets of the batch are visited under the lock,
+// key which exists during the whole iteration is returned exactly once. Pattern is applied after the batch
+// is picked, so a call may return fewer keys than count
+func (c *commander) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, [][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, nil, err
+	}
+
+	next, batch := c.index.ScanKeys(cursor, count)
+
+	now := time.Now()
+	keys := make([][]byte, 0, len(batch))
+	for _, key := range batch {
+		if deadline, ok := c.expires[string(key)]; ok && !now.Before(deadline) {
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, string(key)); matched {
+			keys = append(keys, key)
+		}
+	}
+	return next, keys, nil
+}
+
+// Size will return number of live keys, key which already passed its deadline is not counted
+// even if it is not deleted yet
+func (c *commander) Size(ctx context.Context) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	size := c.ds.Len()
+	for _, deadline := range c.expires {
+		if !now.Before(deadline) {
+			size--
+		}
+	}
+	return size, nil
+}
+
+// Flush will delete every key and its lifetime from db
+func (c *commander) Flush(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range c.ds.Keys() {
+		if err := c.delete(key); err != nil {
+			return err
+		}
+	}
+
+	c.expires = make(map[string]time.Time)
+	return nil
+}
+
+// Snapshot will return every live key with its value and deadline
+func (c *commander) Snapshot() ([]SnapshotEntry, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	keys := c.ds.Keys()
+	entries := make([]SnapshotEntry, 0, len(keys))
+	for _, key := range keys {
+		deadline := c.expires[string(key)]
+		if !deadline.IsZero() && !now.Before(deadline) {
+			continue
+		}
+
+		result, err := c.ds.Search(key)
+		if err != nil {
+			continue
+		}
+		// hash is modified in place, so it is copied before snapshot is written outside the lock
+		var hash map[string][]byte
+		if result.Hash != nil {
+			hash = make(map[string][]byte, len(result.Hash))
+			for field, value := range result.Hash {
+				hash[field] = value
+			}
+		}
+
+		entries = append(entries, SnapshotEntry{Key: result.Key, Value: result.Value, ExpiredAt: deadline, Type: result.Type, List: result.List, Hash: hash})
+	}
+	return entries, nil
+}
+
+// Load will insert every entry to db, entry which already passed its deadline is skipped
+func (c *commander) Load(entries []SnapshotEntry) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.ExpiredAt.IsZero() && !now.Before(entry.ExpiredAt) {
+			continue
+		}
+
+		c.insertSchema(&Schema{Key: entry.Key, Value: entry.Value, Type: entry.Type, List: entry.List, Hash: entry.Hash})
+		delete(c.expires, string(entry.Key))
+		if !entry.ExpiredAt.IsZero() {
+			c.expires[string(entry.Key)] = entry.ExpiredAt
+		}
+	}
+	return nil
+}
+
+// Evictions will return total number of keys evicted because maxKeys is exceeded
+func (c *commander) Evictions() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.evictions
+}
+
+// DeleteExpired will delete every key that already passed its deadline and return the number of deleted keys
+func (c *commander) DeleteExpired() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	deleted := 0
+	for key, deadline := range c.expires {
+		if now.Before(deadline) {
+			continue
+		}
+
+		delete(c.expires, key)
+		if err := c.delete([]byte(key)); err == nil {
+			c.expired([]byte(key))
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Inspect will return internal metadata of key without marking it as accessed
+func (c *commander) Inspect(key []byte) (ObjectInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	key = bytes.Trim(key, crlf)
+
+	deadline, ok := c.expires[string(key)]
+	if ok && !time.Now().Before(deadline) {
+		return ObjectInfo{}, errors.New(ErrorEmptyValue)
+	}
+
+	result, err := c.ds.Search(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{Type: result.DataType(), Deadline: deadline}
+	if u, ok := c.usages[string(key)]; ok {
+		info.Accessed = u.accessed
+		info.Hits = u.hits
+	}
+
+	switch info.Type {
+	case TypeList:
+		info.Length = len(result.List)
+	case TypeHash:
+		info.Length = len(result.Hash)
+	default:
+		info.Length = len(result.Value)
+	}
+	return info, nil
 }
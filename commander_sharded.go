@@ -0,0 +1,467 @@
+package kece
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// shardedCommander split keyspace into shards by hash of key, every shard is a commander with its own lock,
+// so commands of keys in different shards don't wait each other. Command of several keys like MSET and RENAME
+// lock every shard of its keys, commands of the whole keyspace like KEYS and DBSIZE visit shards one by one
+type shardedCommander struct {
+	shards []*commander
+}
+
+// NewShardedCommander function, Commander's constructor with a shard per data storage.
+// maxKeys is divided between shards, so the least recently used key is evicted from the shard being written
+func NewShardedCommander(dataStorages []DataStructure, maxKeys int) Commander {
+	shardMaxKeys := 0
+	if maxKeys > 0 {
+		shardMaxKeys = (maxKeys + len(dataStorages) - 1) / len(dataStorages)
+	}
+
+	shards := make([]*commander, 0, len(dataStorages))
+	for _, dataStorage := range dataStorages {
+		shards = append(shards, newCommander(dataStorage, shardMaxKeys, &sync.Mutex{}))
+	}
+	return &shardedCommander{shards: shards}
+}
+
+// index will return index of shard holding key
+func (s *shardedCommander) index(key []byte) int {
+	// remove line feed and carriage return (13/10)/ CR/LF
+	return shardIndex(bytes.Trim(key, crlf), len(s.shards))
+}
+
+// shard will return shard holding key
+func (s *shardedCommander) shard(key []byte) *commander {
+	return s.shards[s.index(key)]
+}
+
+// group will split keys by shard holding them
+func (s *shardedCommander) group(keys [][]byte) [][][]byte {
+	groups := make([][][]byte, len(s.shards))
+	for _, key := range keys {
+		i := s.index(key)
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+// lockPair will lock shards holding both keys ordered by index and return them with function unlocking them
+func (s *shardedCommander) lockPair(first, second []byte) (*commander, *commander, func()) {
+	i, j := s.index(first), s.index(second)
+	switch {
+	case i == j:
+		return s.shards[i], s.shards[j], lockShards(s.shards[i : i+1])
+	case i < j:
+		return s.shards[i], s.shards[j], lockShards([]*commander{s.shards[i], s.shards[j]})
+	default:
+		return s.shards[i], s.shards[j], lockShards([]*commander{s.shards[j], s.shards[i]})
+	}
+}
+
+// Set will set value to shard of key
+func (s *shardedCommander) Set(ctx context.Context, command, key, value []byte, exp time.Duration) (*Schema, error) {
+	return s.shard(key).Set(ctx, command, key, value, exp)
+}
+
+// BatchSet will set every pair under lock of every shard of their keys, so reader never see partial update
+func (s *shardedCommander) BatchSet(ctx context.Context, pairs []KeyValue) error {
+	groups := make([][]KeyValue, len(s.shards))
+	for _, pair := range pairs {
+		i := s.index(pair.Key)
+		groups[i] = append(groups[i], pair)
+	}
+
+	var shards []*commander
+	for i, group := range groups {
+		if len(group) > 0 {
+			shards = append(shards, s.shards[i])
+		}
+	}
+
+	unlock := lockShards(shards)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for i, group := range groups {
+		s.shards[i].setPairs(group)
+	}
+	return nil
+}
+
+// Get will get value from shard of key
+func (s *shardedCommander) Get(ctx context.Context, command, key []byte) (*Schema, error) {
+	return s.shard(key).Get(ctx, command, key)
+}
+
+// Delete will delete key from its shard
+func (s *shardedCommander) Delete(ctx context.Context, command, key []byte) error {
+	return s.shard(key).Delete(ctx, command, key)
+}
+
+// DeleteMany will delete keys of every shard under its own lock and return the deleted keys
+func (s *shardedCommander) DeleteMany(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	var deleted [][]byte
+	for i, group := range s.group(keys) {
+		if len(group) == 0 {
+			continue
+		}
+
+		keys, err := s.shards[i].DeleteMany(ctx, group)
+		deleted = append(deleted, keys...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// Touch will touch keys of every shard under its own lock and return the number of existing keys
+func (s *shardedCommander) Touch(ctx context.Context, keys [][]byte) (int, error) {
+	touched := 0
+	for i, group := range s.group(keys) {
+		if len(group) == 0 {
+			continue
+		}
+
+		n, err := s.shards[i].Touch(ctx, group)
+		touched += n
+		if err != nil {
+			return touched, err
+		}
+	}
+	return touched, nil
+}
+
+// Exists will check key in its shard
+func (s *shardedCommander) Exists(ctx context.Context, command, key []byte) (bool, error) {
+	return s.shard(key).Exists(ctx, command, key)
+}
+
+// TTL will return remaining lifetime of key in seconds
+func (s *shardedCommander) TTL(ctx context.Context, command, key []byte) (int64, error) {
+	return s.shard(key).TTL(ctx, command, key)
+}
+
+// PTTL will return remaining lifetime of key in milliseconds
+func (s *shardedCommander) PTTL(ctx context.Context, key []byte) (int64, error) {
+	return s.shard(key).PTTL(ctx, key)
+}
+
+// Expire will set lifetime of key in seconds
+func (s *shardedCommander) Expire(ctx context.Context, key []byte, seconds int) (bool, error) {
+	return s.shard(key).Expire(ctx, key, seconds)
+}
+
+// PExpire will set lifetime of key in milliseconds
+func (s *shardedCommander) PExpire(ctx context.Context, key []byte, milliseconds int) (bool, error) {
+	return s.shard(key).PExpire(ctx, key, milliseconds)
+}
+
+// PExpireAt will set deadline of key as unix time in milliseconds
+func (s *shardedCommander) PExpireAt(ctx context.Context, key []byte, milliseconds int64) (bool, error) {
+	return s.shard(key).PExpireAt(ctx, key, milliseconds)
+}
+
+// Persist will remove lifetime of key
+func (s *shardedCommander) Persist(ctx context.Context, key []byte) (bool, error) {
+	return s.shard(key).Persist(ctx, key)
+}
+
+// Incr will add delta to integer value of key
+func (s *shardedCommander) Incr(ctx context.Context, key []byte, delta int64) (int64, error) {
+	return s.shard(key).Incr(ctx, key, delta)
+}
+
+// Append will append value to value of key
+func (s *shardedCommander) Append(ctx context.Context, key, value []byte) (int, error) {
+	return s.shard(key).Append(ctx, key, value)
+}
+
+// Strlen will return length of value of key
+func (s *shardedCommander) Strlen(ctx context.Context, key []byte) (int, error) {
+	return s.shard(key).Strlen(ctx, key)
+}
+
+// GetRange will return bytes of value of key between start and end
+func (s *shardedCommander) GetRange(ctx context.Context, key []byte, start, end int) ([]byte, error) {
+	return s.shard(key).GetRange(ctx, key, start, end)
+}
+
+// SetRange will overwrite value of key from offset
+func (s *shardedCommander) SetRange(ctx context.Context, key []byte, offset int, value []byte) (int, error) {
+	return s.shard(key).SetRange(ctx, key, offset, value)
+}
+
+// GetSet will set value of key and return its old value
+func (s *shardedCommander) GetSet(ctx context.Context, key, value []byte) ([]byte, error) {
+	return s.shard(key).GetSet(ctx, key, value)
+}
+
+// SetNX will set value of key only if it is not exist
+func (s *shardedCommander) SetNX(ctx context.Context, key, value []byte) (bool, error) {
+	return s.shard(key).SetNX(ctx, key, value)
+}
+
+// Rename will move value and lifetime of oldKey to newKey under lock of both shards
+func (s *shardedCommander) Rename(ctx context.Context, oldKey, newKey []byte) error {
+	from, to, unlock := s.lockPair(oldKey, newKey)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	oldKey = bytes.Trim(oldKey, crlf)
+	newKey = bytes.Trim(newKey, crlf)
+
+	return renameKey(from, to, oldKey, newKey)
+}
+
+// RenameNX will rename oldKey only if newKey is not exist, under lock of both shards
+func (s *shardedCommander) RenameNX(ctx context.Context, oldKey, newKey []byte) (bool, error) {
+	from, to, unlock := s.lockPair(oldKey, newKey)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	oldKey = bytes.Trim(oldKey, crlf)
+	newKey = bytes.Trim(newKey, crlf)
+
+	if _, err := from.search(oldKey); err != nil {
+		return false, err
+	}
+
+	if _, err := to.search(newKey); err == nil {
+		return false, nil
+	}
+	return true, renameKey(from, to, oldKey, newKey)
+}
+
+// Copy will duplicate value and lifetime of source to destination under lock of both shards
+func (s *shardedCommander) Copy(ctx context.Context, source, destination []byte, replace bool) (bool, error) {
+	from, to, unlock := s.lockPair(source, destination)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// remove line feed and carriage return (13/10)/ CR/LF
+	source = bytes.Trim(source, crlf)
+	destination = bytes.Trim(destination, crlf)
+
+	return copyKey(from, to, source, destination, replace)
+}
+
+// Type will return data type of value of key
+func (s *shardedCommander) Type(ctx context.Context, key []byte) (string, error) {
+	return s.shard(key).Type(ctx, key)
+}
+
+// Dump will serialize value and lifetime of key
+func (s *shardedCommander) Dump(ctx context.Context, key []byte) ([]byte, error) {
+	return s.shard(key).Dump(ctx, key)
+}
+
+// Restore will create key from blob of Dump
+func (s *shardedCommander) Restore(ctx context.Context, key, blob []byte, ttl time.Duration, replace bool) error {
+	return s.shard(key).Restore(ctx, key, blob, ttl, replace)
+}
+
+// Push will push values to list of key
+func (s *shardedCommander) Push(ctx context.Context, key []byte, values [][]byte, left bool) (int, error) {
+	return s.shard(key).Push(ctx, key, values, left)
+}
+
+// Pop will remove and return head or tail of list of key
+func (s *shardedCommander) Pop(ctx context.Context, key []byte, left bool) ([]byte, error) {
+	return s.shard(key).Pop(ctx, key, left)
+}
+
+// LRange will return elements of list of key between start and stop
+func (s *shardedCommander) LRange(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	return s.shard(key).LRange(ctx, key, start, stop)
+}
+
+// LLen will return number of elements in list of key
+func (s *shardedCommander) LLen(ctx context.Context, key []byte) (int, error) {
+	return s.shard(key).LLen(ctx, key)
+}
+
+// HSet will set field of hash of key
+func (s *shardedCommander) HSet(ctx context.Context, key, field, value []byte) (int, error) {
+	return s.shard(key).HSet(ctx, key, field, value)
+}
+
+// HGet will return value of field of hash of key
+func (s *shardedCommander) HGet(ctx context.Context, key, field []byte) ([]byte, error) {
+	return s.shard(key).HGet(ctx, key, field)
+}
+
+// HDel will delete field of hash of key
+func (s *shardedCommander) HDel(ctx context.Context, key, field []byte) (int, error) {
+	return s.shard(key).HDel(ctx, key, field)
+}
+
+// HGetAll will return every field and value of hash of key
+func (s *shardedCommander) HGetAll(ctx context.Context, key []byte) ([][]byte, error) {
+	return s.shard(key).HGetAll(ctx, key)
+}
+
+// Keys will return every key matching pattern of every shard
+func (s *shardedCommander) Keys(ctx context.Context, pattern string) ([][]byte, error) {
+	var keys [][]byte
+	for _, shard := range s.shards {
+		shardKeys, err := shard.Keys(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, shardKeys...)
+	}
+	return keys, nil
+}
+
+// RandomKey will pick shard weighted by its number of keys, then a key of that shard. Shards are not locked together,
+// so key written or deleted between both steps makes the distribution slightly uneven
+func (s *shardedCommander) RandomKey(ctx context.Context) ([]byte, error) {
+	sizes := make([]int, 0, len(s.shards))
+	total := 0
+	for _, shard := range s.shards {
+		size, err := shard.Size(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+		total += size
+	}
+
+	if total == 0 {
+		return nil, nil
+	}
+
+	n := rand.Intn(total)
+	for i, size := range sizes {
+		if n < size {
+			return s.shards[i].RandomKey(ctx)
+		}
+		n -= size
+	}
+	return nil, nil
+}
+
+// Scan will scan every shard from cursor, only keys before the nearest next cursor of all shards are returned
+// so keys of every shard are still returned in SCAN order. Key of a SCAN position is always in the same shard
+func (s *shardedCommander) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, [][]byte, error) {
+	var next uint64
+	batches := make([][][]byte, 0, len(s.shards))
+	for _, shard := range s.shards {
+		shardNext, keys, err := shard.Scan(ctx, cursor, pattern, count)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if shardNext != 0 && (next == 0 || shardNext < next) {
+			next = shardNext
+		}
+		batches = append(batches, keys)
+	}
+
+	var keys [][]byte
+	for _, batch := range batches {
+		for _, key := range batch {
+			// key after next is returned again by the next call
+			if next == 0 || scanPosition(key) < next {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return next, keys, nil
+}
+
+// Size will return number of live keys of every shard
+func (s *shardedCommander) Size(ctx context.Context) (int, error) {
+	size := 0
+	for _, shard := range s.shards {
+		n, err := shard.Size(ctx)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// Flush will delete every key of every shard
+func (s *shardedCommander) Flush(ctx context.Context) error {
+	for _, shard := range s.shards {
+		if err := shard.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot will return every live key of every shard
+func (s *shardedCommander) Snapshot() ([]SnapshotEntry, error) {
+	var entries []SnapshotEntry
+	for _, shard := range s.shards {
+		shardEntries, err := shard.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, shardEntries...)
+	}
+	return entries, nil
+}
+
+// Load will insert every entry to shard of its key
+func (s *shardedCommander) Load(entries []SnapshotEntry) error {
+	groups := make([][]SnapshotEntry, len(s.shards))
+	for _, entry := range entries {
+		i := s.index(entry.Key)
+		groups[i] = append(groups[i], entry)
+	}
+
+	for i, group := range groups {
+		if err := s.shards[i].Load(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteExpired will delete expired keys of every shard and return the number of deleted keys
+func (s *shardedCommander) DeleteExpired() int {
+	deleted := 0
+	for _, shard := range s.shards {
+		deleted += shard.DeleteExpired()
+	}
+	return deleted
+}
+
+// Evictions will return total number of keys evicted from every shard
+func (s *shardedCommander) Evictions() int64 {
+	var evictions int64
+	for _, shard := range s.shards {
+		evictions += shard.Evictions()
+	}
+	return evictions
+}
+
+// Inspect will return internal metadata of key from its shard
+func (s *shardedCommander) Inspect(key []byte) (ObjectInfo, error) {
+	return s.shard(key).Inspect(key)
+}
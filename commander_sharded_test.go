@@ -0,0 +1,213 @@
+package kece
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newShardedMock(n int) Commander {
+	dataStructures := make([]DataStructure, 0, n)
+	for i := 0; i < n; i++ {
+		dataStructures = append(dataStructures, newStructureMock())
+	}
+	return NewShardedCommander(dataStructures, 0)
+}
+
+func TestShardedCommander(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := newShardedMock(4)
+	pairs := benchmarkPairs(100)
+
+	if err := batchSet(ctx, cmd, pairs); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	t.Run("should spread keys over every shard", func(t *testing.T) {
+		for i, shard := range cmd.(*shardedCommander).shards {
+			if n, _ := shard.Size(ctx); n == 0 {
+				t.Errorf("shard %d should hold keys", i)
+			}
+		}
+
+		if n, _ := cmd.Size(ctx); n != len(pairs) {
+			t.Errorf("DBSIZE should be %d, got %d", len(pairs), n)
+		}
+
+		keys, err := cmd.Keys(ctx, "key:*")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(keys) != len(pairs) {
+			t.Errorf("KEYS should return %d keys, got %d", len(pairs), len(keys))
+		}
+	})
+
+	t.Run("should SCAN every key exactly once", func(t *testing.T) {
+		seen := make(map[string]int)
+		var cursor uint64
+		for {
+			next, keys, err := cmd.Scan(ctx, cursor, "*", 10)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			for _, key := range keys {
+				seen[string(key)]++
+			}
+
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+
+		if len(seen) != len(pairs) {
+			t.Errorf("SCAN should return %d keys, got %d", len(pairs), len(seen))
+		}
+
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("SCAN should return %s once, got %d", key, n)
+			}
+		}
+	})
+
+	t.Run("should RENAME key to other shard with its lifetime", func(t *testing.T) {
+		sharded := cmd.(*shardedCommander)
+
+		// find destination key held by other shard
+		newKey := []byte("renamed:0")
+		for i := 1; sharded.index(newKey) == sharded.index([]byte("key:0")); i++ {
+			newKey = []byte(fmt.Sprintf("renamed:%d", i))
+		}
+
+		if _, err := cmd.Expire(ctx, []byte("key:0"), 100); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := cmd.Rename(ctx, []byte("key:0"), newKey); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if ok, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("key:0")); ok {
+			t.Error("old key should be deleted")
+		}
+
+		if ttl, _ := cmd.TTL(ctx, []byte("TTL"), newKey); ttl <= 0 {
+			t.Errorf("new key should keep lifetime, got TTL %d", ttl)
+		}
+
+		if ok, _ := cmd.RenameNX(ctx, newKey, []byte("key:1")); ok {
+			t.Error("RENAMENX should not overwrite existing key")
+		}
+
+		if err := cmd.Rename(ctx, newKey, []byte("key:0")); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	t.Run("should COPY key to other shard", func(t *testing.T) {
+		sharded := cmd.(*shardedCommander)
+
+		destination := []byte("copied:0")
+		for i := 1; sharded.index(destination) == sharded.index([]byte("key:2")); i++ {
+			destination = []byte(fmt.Sprintf("copied:%d", i))
+		}
+
+		ok, err := cmd.Copy(ctx, []byte("key:2"), destination, false)
+		if err != nil || !ok {
+			t.Fatalf("COPY should success, got %v %v", ok, err)
+		}
+
+		for _, key := range [][]byte{[]byte("key:2"), destination} {
+			if result, err := cmd.Get(ctx, []byte("GET"), key); err != nil || string(result.Value) != "wuriyanto" {
+				t.Errorf("value of %s should be wuriyanto", key)
+			}
+		}
+
+		if err := cmd.Delete(ctx, []byte("DEL"), destination); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	t.Run("should DEL keys of several shards", func(t *testing.T) {
+		keys := [][]byte{[]byte("key:10"), []byte("key:11"), []byte("key:12"), []byte("key:13"), []byte("missing")}
+
+		deleted, err := cmd.DeleteMany(ctx, keys)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(deleted) != 4 {
+			t.Errorf("DEL should delete 4 keys, got %q", deleted)
+		}
+
+		if size, _ := cmd.Size(ctx); size != len(pairs)-4 {
+			t.Errorf("DBSIZE should be %d, got %d", len(pairs)-4, size)
+		}
+	})
+
+	t.Run("should SWAPDB and MOVE between sharded databases", func(t *testing.T) {
+		databases := newDatabases(newShardedMock(4), 2)
+
+		if _, err := databases[0].Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), time.Minute); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := swapDatabases(ctx, databases[0], databases[1]); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if ok, _ := databases[1].Exists(ctx, []byte("EXISTS"), []byte("1")); !ok {
+			t.Error("key should be swapped to database 1")
+		}
+
+		moved, err := moveKey(ctx, databases[1], databases[0], []byte("1"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if !moved {
+			t.Error("key should be moved to database 0")
+		}
+
+		if ttl, _ := databases[0].TTL(ctx, []byte("TTL"), []byte("1")); ttl <= 0 {
+			t.Errorf("moved key should keep lifetime, got TTL %d", ttl)
+		}
+	})
+}
+
+// BenchmarkCommanderParallel run SET and GET from every goroutine, with a single lock and a lock per shard
+func BenchmarkCommanderParallel(b *testing.B) {
+	ctx := context.Background()
+
+	commanders := map[string]Commander{
+		"single":  NewCommander(newStructureMock()),
+		"sharded": newShardedMock(16),
+	}
+
+	for name, cmd := range commanders {
+		pairs := benchmarkPairs(1000)
+
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					pair := pairs[i%len(pairs)]
+					if _, err := cmd.Set(ctx, []byte("SET"), pair.Key, pair.Value, 0); err != nil {
+						b.Fatal(err.Error())
+					}
+
+					if _, err := cmd.Get(ctx, []byte("GET"), pair.Key); err != nil {
+						b.Fatal(err.Error())
+					}
+					i++
+				}
+			})
+		})
+	}
+}
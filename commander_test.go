@@ -2,10 +2,18 @@ package kece
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCommander(t *testing.T) {
+	ctx := context.Background()
+
 	dataStructures := []DataStructure{newStructureMock()}
 
 	for _, ds := range dataStructures {
@@ -18,7 +26,7 @@ func TestCommander(t *testing.T) {
 
 			expectedValue := []byte("wuriyanto")
 
-			newValue, err := cmd.Set(command, key, value)
+			newValue, err := cmd.Set(ctx, command, key, value, 0)
 
 			if err != nil {
 				t.Error("command is not valid")
@@ -34,7 +42,7 @@ func TestCommander(t *testing.T) {
 			expectedValue := []byte("wuriyanto")
 			command := []byte("GET")
 
-			value, err := cmd.Get(command, key)
+			value, err := cmd.Get(ctx, command, key)
 
 			if err != nil {
 				t.Error(err.Error())
@@ -50,7 +58,7 @@ func TestCommander(t *testing.T) {
 			value := []byte("wuriyanto")
 			command := []byte("ET")
 
-			newValue, err := cmd.Set(command, key, value)
+			newValue, err := cmd.Set(ctx, command, key, value, 0)
 
 			if err == nil {
 				t.Error("command should invalid")
@@ -65,7 +73,7 @@ func TestCommander(t *testing.T) {
 			key := []byte("1")
 			command := []byte("ET")
 
-			value, err := cmd.Get(command, key)
+			value, err := cmd.Get(ctx, command, key)
 
 			if err == nil {
 				t.Error("command is not valid")
@@ -75,5 +83,1316 @@ func TestCommander(t *testing.T) {
 				t.Error("value should be nil")
 			}
 		})
-	}
+
+		t.Run("should success EXISTS with present key", func(t *testing.T) {
+			key := []byte("1")
+			command := []byte("EXISTS")
+
+			exist, err := cmd.Exists(ctx, command, key)
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if !exist {
+				t.Error("key should exist")
+			}
+		})
+
+		t.Run("should success EXISTS with missing key", func(t *testing.T) {
+			key := []byte("missing")
+			command := []byte("EXISTS")
+
+			exist, err := cmd.Exists(ctx, command, key)
+
+			if err != nil {
+				t.Error("missing key should not return error")
+			}
+
+			if exist {
+				t.Error("key should not exist")
+			}
+		})
+
+		t.Run("should success TTL with key without lifetime", func(t *testing.T) {
+			ttl, err := cmd.TTL(ctx, []byte("TTL"), []byte("1"))
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if ttl != -1 {
+				t.Errorf("ttl should be -1, got %d", ttl)
+			}
+		})
+
+		t.Run("should success TTL with missing key", func(t *testing.T) {
+			ttl, err := cmd.TTL(ctx, []byte("TTL"), []byte("missing"))
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if ttl != -2 {
+				t.Errorf("ttl should be -2, got %d", ttl)
+			}
+		})
+
+		t.Run("should success TTL with key with lifetime", func(t *testing.T) {
+			_, err := cmd.Set(ctx, []byte("SET"), []byte("exp"), []byte("wuriyanto"), 20*time.Second)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			ttl, err := cmd.TTL(ctx, []byte("TTL"), []byte("exp"))
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if ttl != 20 {
+				t.Errorf("ttl should be 20, got %d", ttl)
+			}
+		})
+
+		t.Run("should not GET value which lifetime is passed", func(t *testing.T) {
+			_, err := cmd.Set(ctx, []byte("SET"), []byte("exp"), []byte("wuriyanto"), time.Millisecond)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			value, err := cmd.Get(ctx, []byte("GET"), []byte("exp"))
+
+			if err == nil || value != nil {
+				t.Error("value should be expired")
+			}
+
+			ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("exp"))
+			if ttl != -2 {
+				t.Errorf("ttl should be -2, got %d", ttl)
+			}
+		})
+
+		t.Run("should success EXPIRE with existing key", func(t *testing.T) {
+			ok, err := cmd.Expire(ctx, []byte("1"), 30)
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if !ok {
+				t.Error("expire should success on existing key")
+			}
+
+			ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("1"))
+			if ttl != 30 {
+				t.Errorf("ttl should be 30, got %d", ttl)
+			}
+		})
+
+		t.Run("should clear lifetime set by EXPIRE when key is SET again", func(t *testing.T) {
+			_, err := cmd.Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), 0)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("1"))
+			if ttl != -1 {
+				t.Errorf("ttl should be -1, got %d", ttl)
+			}
+		})
+
+		t.Run("should keep key after PERSIST past its lifetime", func(t *testing.T) {
+			_, err := cmd.Set(ctx, []byte("SET"), []byte("persist"), []byte("wuriyanto"), 50*time.Millisecond)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			ok, err := cmd.Persist(ctx, []byte("persist"))
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if !ok {
+				t.Error("persist should remove lifetime")
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			cmd.DeleteExpired()
+
+			if _, err := cmd.Get(ctx, []byte("GET"), []byte("persist")); err != nil {
+				t.Error("key should survive past its original lifetime")
+			}
+
+			ok, _ = cmd.Persist(ctx, []byte("persist"))
+			if ok {
+				t.Error("persist should fail on key without lifetime")
+			}
+		})
+
+		t.Run("should success INCR and DECR with missing key", func(t *testing.T) {
+			result, err := cmd.Incr(ctx, []byte("counter"), 1)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if result != 1 {
+				t.Errorf("result should be 1, got %d", result)
+			}
+
+			result, err = cmd.Incr(ctx, []byte("counter-decr"), -1)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if result != -1 {
+				t.Errorf("result should be -1, got %d", result)
+			}
+		})
+
+		t.Run("should serialize concurrent INCR on the same key", func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := cmd.Incr(ctx, []byte("concurrent"), 1); err != nil {
+						t.Error(err.Error())
+					}
+				}()
+			}
+			wg.Wait()
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("concurrent"))
+			if string(value.Value) != "100" {
+				t.Errorf("value should be 100, got %s", value.Value)
+			}
+		})
+
+		t.Run("should error INCR when result overflow", func(t *testing.T) {
+			_, err := cmd.Set(ctx, []byte("SET"), []byte("overflow"), []byte("9223372036854775806"), 0)
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			result, err := cmd.Incr(ctx, []byte("overflow"), 1)
+			if err != nil || result != math.MaxInt64 {
+				t.Errorf("result should be %d, got %d", int64(math.MaxInt64), result)
+			}
+
+			_, err = cmd.Incr(ctx, []byte("overflow"), 1)
+			if err == nil {
+				t.Error("incr should fail when result overflow")
+			}
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("overflow"))
+			if string(value.Value) != "9223372036854775807" {
+				t.Errorf("overflow should not change value, got %s", value.Value)
+			}
+
+			_, err = cmd.Incr(ctx, []byte("overflow"), math.MinInt64)
+			if err != nil {
+				t.Error("incr with negative delta should not overflow")
+			}
+		})
+
+		t.Run("should error INCR with non integer value", func(t *testing.T) {
+			_, err := cmd.Incr(ctx, []byte("1"), 1)
+			if err == nil {
+				t.Error("incr should fail on non integer value")
+			}
+		})
+
+		t.Run("should success APPEND to missing key like SET", func(t *testing.T) {
+			length, err := cmd.Append(ctx, []byte("log"), []byte("hello"))
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if length != 5 {
+				t.Errorf("length should be 5, got %d", length)
+			}
+
+			length, _ = cmd.Append(ctx, []byte("log"), []byte(" kece"))
+			if length != 10 {
+				t.Errorf("length should be 10, got %d", length)
+			}
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("log"))
+			if string(value.Value) != "hello kece" {
+				t.Errorf("value should be appended, got %s", value.Value)
+			}
+		})
+
+		t.Run("should success STRLEN with existing and missing key", func(t *testing.T) {
+			length, err := cmd.Strlen(ctx, []byte("log"))
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if length != 10 {
+				t.Errorf("length should be 10, got %d", length)
+			}
+
+			length, err = cmd.Strlen(ctx, []byte("missing"))
+			if err != nil {
+				t.Error("missing key should not return error")
+			}
+
+			if length != 0 {
+				t.Errorf("length of missing key should be 0, got %d", length)
+			}
+		})
+
+		t.Run("should success GETRANGE with negative and out of range index", func(t *testing.T) {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("getrange"), []byte("wuriyanto"), 0); err != nil {
+				t.Error(err.Error())
+			}
+
+			ranges := []struct {
+				start, end int
+				expected   string
+			}{
+				{0, -1, "wuriyanto"},
+				{0, 3, "wuri"},
+				{-4, -1, "anto"},
+				{-100, 100, "wuriyanto"},
+				{5, 100, "anto"},
+				{3, 1, ""},
+				{20, 30, ""},
+			}
+
+			for _, r := range ranges {
+				value, err := cmd.GetRange(ctx, []byte("getrange"), r.start, r.end)
+				if err != nil {
+					t.Error(err.Error())
+				}
+
+				if string(value) != r.expected {
+					t.Errorf("range %d %d should be %q, got %q", r.start, r.end, r.expected, value)
+				}
+			}
+
+			value, err := cmd.GetRange(ctx, []byte("missing"), 0, -1)
+			if err != nil || value == nil || len(value) != 0 {
+				t.Error("range of missing key should be empty")
+			}
+		})
+
+		t.Run("should success SETRANGE and pad value written past its end", func(t *testing.T) {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("setrange"), []byte("wuriyanto"), 0); err != nil {
+				t.Error(err.Error())
+			}
+
+			length, err := cmd.SetRange(ctx, []byte("setrange"), 4, []byte("ANTO"))
+			if err != nil || length != 9 {
+				t.Errorf("length should be 9, got %d", length)
+			}
+
+			length, err = cmd.SetRange(ctx, []byte("setrange"), 11, []byte("48"))
+			if err != nil || length != 13 {
+				t.Errorf("length should be 13, got %d", length)
+			}
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("setrange"))
+			if string(value.Value) != "wuriANTOo\x00\x0048" {
+				t.Errorf("value should be overwritten and padded, got %q", value.Value)
+			}
+
+			length, err = cmd.SetRange(ctx, []byte("padded"), 2, []byte("kece"))
+			if err != nil || length != 6 {
+				t.Errorf("length of missing key should be 6, got %d", length)
+			}
+
+			value, _ = cmd.Get(ctx, []byte("GET"), []byte("padded"))
+			if string(value.Value) != "\x00\x00kece" {
+				t.Errorf("missing key should be padded, got %q", value.Value)
+			}
+
+			if _, err := cmd.SetRange(ctx, []byte("setrange"), -1, []byte("kece")); err == nil {
+				t.Error("negative offset should return error")
+			}
+		})
+
+		t.Run("should success BatchSet every pair", func(t *testing.T) {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("mset:1"), []byte("old"), time.Hour); err != nil {
+				t.Error(err.Error())
+			}
+
+			pairs := []KeyValue{
+				{Key: []byte("mset:1"), Value: []byte("wuriyanto")},
+				{Key: []byte("mset:2"), Value: []byte("agung")},
+				{Key: []byte("mset:3"), Value: []byte("bxcodec")},
+			}
+
+			if err := batchSet(ctx, cmd, pairs); err != nil {
+				t.Error(err.Error())
+			}
+
+			for _, pair := range pairs {
+				value, err := cmd.Get(ctx, []byte("GET"), pair.Key)
+				if err != nil || !bytes.Equal(value.Value, pair.Value) {
+					t.Errorf("value of %s should be %s", pair.Key, pair.Value)
+				}
+			}
+
+			if ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("mset:1")); ttl != -1 {
+				t.Errorf("BatchSet should remove lifetime, got ttl %d", ttl)
+			}
+		})
+
+		t.Run("should fall back to Set if BatchSet is not implemented", func(t *testing.T) {
+			// embedded interface hide BatchSet of the underlying commander
+			unbatched := struct{ Commander }{cmd}
+			if _, ok := Commander(unbatched).(BatchSetter); ok {
+				t.Fatal("commander should not implement BatchSetter")
+			}
+
+			pairs := []KeyValue{
+				{Key: []byte("batch:1"), Value: []byte("wuriyanto")},
+				{Key: []byte("batch:2"), Value: []byte("agung")},
+			}
+
+			if err := batchSet(ctx, unbatched, pairs); err != nil {
+				t.Error(err.Error())
+			}
+
+			for _, pair := range pairs {
+				value, err := cmd.Get(ctx, []byte("GET"), pair.Key)
+				if err != nil || !bytes.Equal(value.Value, pair.Value) {
+					t.Errorf("value of %s should be %s", pair.Key, pair.Value)
+				}
+			}
+		})
+
+		t.Run("should success GETSET and return the old value", func(t *testing.T) {
+			oldValue, err := cmd.GetSet(ctx, []byte("getset"), []byte("first"))
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if oldValue != nil {
+				t.Error("old value of missing key should be nil")
+			}
+
+			if _, err := cmd.Expire(ctx, []byte("getset"), 30); err != nil {
+				t.Error(err.Error())
+			}
+
+			oldValue, _ = cmd.GetSet(ctx, []byte("getset"), []byte("second"))
+			if string(oldValue) != "first" {
+				t.Errorf("old value should be first, got %s", oldValue)
+			}
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("getset"))
+			if string(value.Value) != "second" {
+				t.Errorf("value should be second, got %s", value.Value)
+			}
+
+			ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("getset"))
+			if ttl != -1 {
+				t.Errorf("GETSET should remove lifetime, got ttl %d", ttl)
+			}
+		})
+
+		t.Run("should success SETNX only once with concurrent clients", func(t *testing.T) {
+			var wg sync.WaitGroup
+			results := make(chan bool, 2)
+			for _, value := range []string{"client-1", "client-2"} {
+				wg.Add(1)
+				go func(value string) {
+					defer wg.Done()
+					ok, err := cmd.SetNX(ctx, []byte("lock"), []byte(value))
+					if err != nil {
+						t.Error(err.Error())
+					}
+					results <- ok
+				}(value)
+			}
+			wg.Wait()
+			close(results)
+
+			winners := 0
+			for ok := range results {
+				if ok {
+					winners++
+				}
+			}
+
+			if winners != 1 {
+				t.Errorf("exactly one SETNX should success, got %d", winners)
+			}
+		})
+
+		t.Run("should success RENAME and overwrite destination", func(t *testing.T) {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("draft:123"), []byte("draft"), time.Hour); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("final:123"), []byte("old"), 0); err != nil {
+				t.Error(err.Error())
+			}
+
+			if err := cmd.Rename(ctx, []byte("draft:123"), []byte("final:123")); err != nil {
+				t.Error(err.Error())
+			}
+
+			value, err := cmd.Get(ctx, []byte("GET"), []byte("final:123"))
+			if err != nil || string(value.Value) != "draft" {
+				t.Error("destination should be overwritten by value of source")
+			}
+
+			if ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("final:123")); ttl <= 0 {
+				t.Errorf("lifetime should be moved to destination, got ttl %d", ttl)
+			}
+
+			if exist, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("draft:123")); exist {
+				t.Error("source should be deleted")
+			}
+
+			if ttl, _ := cmd.TTL(ctx, []byte("TTL"), []byte("draft:123")); ttl != -2 {
+				t.Errorf("lifetime of source should be deleted, got ttl %d", ttl)
+			}
+		})
+
+		t.Run("should error RENAME with missing source", func(t *testing.T) {
+			if err := cmd.Rename(ctx, []byte("missing"), []byte("final:123")); err == nil {
+				t.Error("rename should fail on missing source")
+			}
+
+			if _, err := cmd.Get(ctx, []byte("GET"), []byte("final:123")); err != nil {
+				t.Error("destination should not be touched")
+			}
+		})
+
+		t.Run("should success RENAMENX only if destination is not exist", func(t *testing.T) {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("renamenx:src"), []byte("src"), 0); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("renamenx:dst"), []byte("dst"), 0); err != nil {
+				t.Error(err.Error())
+			}
+
+			ok, err := cmd.RenameNX(ctx, []byte("renamenx:src"), []byte("renamenx:dst"))
+			if err != nil || ok {
+				t.Error("renamenx should fail if destination exist")
+			}
+
+			value, _ := cmd.Get(ctx, []byte("GET"), []byte("renamenx:dst"))
+			if string(value.Value) != "dst" {
+				t.Errorf("destination should not be overwritten, got %s", value.Value)
+			}
+
+			ok, err = cmd.RenameNX(ctx, []byte("renamenx:src"), []byte("renamenx:new"))
+			if err != nil || !ok {
+				t.Error("renamenx should success if destination is not exist")
+			}
+
+			value, _ = cmd.Get(ctx, []byte("GET"), []byte("renamenx:new"))
+			if string(value.Value) != "src" {
+				t.Errorf("destination should hold value of source, got %s", value.Value)
+			}
+		})
+
+		t.Run("should success COPY list without sharing its elements", func(t *testing.T) {
+			if _, err := cmd.Push(ctx, []byte("original"), [][]byte{[]byte("a")}, true); err != nil {
+				t.Fatal(err.Error())
+			}
+
+			ok, err := cmd.Copy(ctx, []byte("original"), []byte("copied"), false)
+			if err != nil || !ok {
+				t.Fatalf("COPY should success, got %v %v", ok, err)
+			}
+
+			if ok, _ := cmd.Copy(ctx, []byte("original"), []byte("copied"), false); ok {
+				t.Error("COPY should not overwrite destination without REPLACE")
+			}
+
+			if ok, _ := cmd.Copy(ctx, []byte("missing"), []byte("copied"), true); ok {
+				t.Error("COPY of missing source should return false")
+			}
+
+			if _, err := cmd.Copy(ctx, []byte("original"), []byte("original"), true); err == nil {
+				t.Error("COPY to the same key should return error")
+			}
+
+			cmd.Push(ctx, []byte("copied"), [][]byte{[]byte("b")}, false)
+			if length, _ := cmd.LLen(ctx, []byte("original")); length != 1 {
+				t.Errorf("source should keep its elements, got length %d", length)
+			}
+		})
+
+		t.Run("should success TYPE with existing and missing key", func(t *testing.T) {
+			dataType, err := cmd.Type(ctx, []byte("1"))
+			if err != nil || dataType != TypeString {
+				t.Errorf("type of existing key should be %s, got %s", TypeString, dataType)
+			}
+
+			dataType, err = cmd.Type(ctx, []byte("missing"))
+			if err != nil || dataType != TypeNone {
+				t.Errorf("type of missing key should be %s, got %s", TypeNone, dataType)
+			}
+		})
+
+		t.Run("should success PUSH and POP list", func(t *testing.T) {
+			length, err := cmd.Push(ctx, []byte("queue"), [][]byte{[]byte("b"), []byte("a")}, true)
+			if err != nil || length != 2 {
+				t.Errorf("length should be 2, got %d", length)
+			}
+
+			length, _ = cmd.Push(ctx, []byte("queue"), [][]byte{[]byte("c")}, false)
+			if length != 3 {
+				t.Errorf("length should be 3, got %d", length)
+			}
+
+			if dataType, _ := cmd.Type(ctx, []byte("queue")); dataType != TypeList {
+				t.Errorf("type should be %s, got %s", TypeList, dataType)
+			}
+
+			for _, expected := range []struct {
+				left  bool
+				value string
+			}{{true, "a"}, {false, "c"}, {true, "b"}} {
+				value, err := cmd.Pop(ctx, []byte("queue"), expected.left)
+				if err != nil || string(value) != expected.value {
+					t.Errorf("popped value should be %s, got %s", expected.value, value)
+				}
+			}
+
+			value, err := cmd.Pop(ctx, []byte("queue"), true)
+			if err != nil || value != nil {
+				t.Error("pop of empty list should return nil")
+			}
+
+			if exist, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("queue")); exist {
+				t.Error("empty list should be deleted")
+			}
+		})
+
+		t.Run("should success LLEN after pushes and pops", func(t *testing.T) {
+			if _, err := cmd.Push(ctx, []byte("llen"), [][]byte{[]byte("a"), []byte("b"), []byte("c")}, false); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Pop(ctx, []byte("llen"), true); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Push(ctx, []byte("llen"), [][]byte{[]byte("d")}, true); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Pop(ctx, []byte("llen"), false); err != nil {
+				t.Error(err.Error())
+			}
+
+			if length, err := cmd.LLen(ctx, []byte("llen")); err != nil || length != 2 {
+				t.Errorf("length should be 2, got %d", length)
+			}
+
+			if length, err := cmd.LLen(ctx, []byte("missing")); err != nil || length != 0 {
+				t.Errorf("length of missing key should be 0, got %d", length)
+			}
+
+			if _, err := cmd.LLen(ctx, []byte("1")); err == nil {
+				t.Error("llen should fail on string key")
+			}
+		})
+
+		t.Run("should success LRANGE with negative and out of range index", func(t *testing.T) {
+			values := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+			if _, err := cmd.Push(ctx, []byte("lrange"), values, false); err != nil {
+				t.Error(err.Error())
+			}
+
+			ranges := []struct {
+				start, stop int
+				expected    string
+			}{
+				{0, -1, "abcd"},
+				{1, 2, "bc"},
+				{-2, -1, "cd"},
+				{-100, 100, "abcd"},
+				{2, 1, ""},
+				{10, 20, ""},
+			}
+
+			for _, r := range ranges {
+				elements, err := cmd.LRange(ctx, []byte("lrange"), r.start, r.stop)
+				if err != nil {
+					t.Error(err.Error())
+				}
+
+				if got := string(bytes.Join(elements, nil)); got != r.expected {
+					t.Errorf("range %d %d should be %q, got %q", r.start, r.stop, r.expected, got)
+				}
+			}
+
+			elements, err := cmd.LRange(ctx, []byte("missing"), 0, -1)
+			if err != nil || len(elements) != 0 {
+				t.Error("range of missing key should be empty")
+			}
+		})
+
+		t.Run("should success HSET, HGET and HDEL hash", func(t *testing.T) {
+			added, err := cmd.HSet(ctx, []byte("user:1"), []byte("name"), []byte("wuriyanto"))
+			if err != nil || added != 1 {
+				t.Errorf("new field should be added, got %d", added)
+			}
+
+			added, _ = cmd.HSet(ctx, []byte("user:1"), []byte("name"), []byte("wuriyanto musthafa"))
+			if added != 0 {
+				t.Errorf("existing field should be updated, got %d", added)
+			}
+
+			if _, err := cmd.HSet(ctx, []byte("user:1"), []byte("city"), []byte("jakarta")); err != nil {
+				t.Error(err.Error())
+			}
+
+			value, err := cmd.HGet(ctx, []byte("user:1"), []byte("name"))
+			if err != nil || string(value) != "wuriyanto musthafa" {
+				t.Errorf("value of field should be updated, got %s", value)
+			}
+
+			value, err = cmd.HGet(ctx, []byte("user:1"), []byte("missing"))
+			if err != nil || value != nil {
+				t.Error("value of missing field should be nil")
+			}
+
+			if deleted, _ := cmd.HDel(ctx, []byte("user:1"), []byte("missing")); deleted != 0 {
+				t.Errorf("missing field should not be deleted, got %d", deleted)
+			}
+
+			for _, field := range []string{"name", "city"} {
+				if deleted, err := cmd.HDel(ctx, []byte("user:1"), []byte(field)); err != nil || deleted != 1 {
+					t.Errorf("field %s should be deleted, got %d", field, deleted)
+				}
+			}
+
+			if exist, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("user:1")); exist {
+				t.Error("empty hash should be deleted")
+			}
+
+			if _, err := cmd.HSet(ctx, []byte("1"), []byte("name"), []byte("wuriyanto")); err == nil {
+				t.Error("hset should fail on string key")
+			}
+
+			if _, err := cmd.HGet(ctx, []byte("1"), []byte("name")); err == nil {
+				t.Error("hget should fail on string key")
+			}
+		})
+
+		t.Run("should success HGETALL every field and value", func(t *testing.T) {
+			fields := map[string]string{"name": "wuriyanto", "city": "jakarta", "role": "admin"}
+			for field, value := range fields {
+				if _, err := cmd.HSet(ctx, []byte("user:2"), []byte(field), []byte(value)); err != nil {
+					t.Error(err.Error())
+				}
+			}
+
+			pairs, err := cmd.HGetAll(ctx, []byte("user:2"))
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if len(pairs) != 2*len(fields) {
+				t.Fatalf("should return %d fields and values, got %d", 2*len(fields), len(pairs))
+			}
+
+			for i := 0; i < len(pairs); i += 2 {
+				if fields[string(pairs[i])] != string(pairs[i+1]) {
+					t.Errorf("value of %s should be %s, got %s", pairs[i], fields[string(pairs[i])], pairs[i+1])
+				}
+				delete(fields, string(pairs[i]))
+			}
+
+			if len(fields) != 0 {
+				t.Errorf("every field should be returned, missing %d", len(fields))
+			}
+
+			if pairs, err := cmd.HGetAll(ctx, []byte("missing")); err != nil || len(pairs) != 0 {
+				t.Error("missing key should return empty result")
+			}
+
+			if _, err := cmd.HGetAll(ctx, []byte("1")); err == nil {
+				t.Error("hgetall should fail on string key")
+			}
+		})
+
+		t.Run("should error list operation on string key", func(t *testing.T) {
+			if _, err := cmd.Push(ctx, []byte("1"), [][]byte{[]byte("a")}, true); err == nil || err.Error() != ErrorWrongType {
+				t.Errorf("push should fail on string key with %q, got %v", ErrorWrongType, err)
+			}
+
+			if _, err := cmd.Pop(ctx, []byte("1"), true); err == nil {
+				t.Error("pop should fail on string key")
+			}
+
+			if _, err := cmd.Push(ctx, []byte("list"), [][]byte{[]byte("a")}, true); err != nil {
+				t.Error(err.Error())
+			}
+
+			if _, err := cmd.Get(ctx, []byte("GET"), []byte("list")); err == nil || err.Error() != ErrorWrongType {
+				t.Errorf("get should fail on list key with %q, got %v", ErrorWrongType, err)
+			}
+
+			if _, err := cmd.Append(ctx, []byte("list"), []byte("a")); err == nil {
+				t.Error("append should fail on list key")
+			}
+		})
+
+		t.Run("should success KEYS with glob pattern", func(t *testing.T) {
+			for _, key := range []string{"user:1", "user:2", "session:1"} {
+				if _, err := cmd.Set(ctx, []byte("SET"), []byte(key), []byte("value"), 0); err != nil {
+					t.Error(err.Error())
+				}
+			}
+
+			keys, err := cmd.Keys(ctx, "user:*")
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if len(keys) != 2 {
+				t.Errorf("should match 2 keys, got %d", len(keys))
+			}
+
+			if _, err := cmd.Keys(ctx, "[user"); err == nil {
+				t.Error("bad pattern should return error")
+			}
+		})
+
+		t.Run("should error EXPIRE with missing key", func(t *testing.T) {
+			ok, err := cmd.Expire(ctx, []byte("missing"), 30)
+
+			if err != nil {
+				t.Error(err.Error())
+			}
+
+			if ok {
+				t.Error("expire should fail on missing key")
+			}
+		})
+
+		t.Run("should Inspect key without marking it as accessed", func(t *testing.T) {
+			key := []byte("inspected")
+			if _, err := cmd.Set(ctx, []byte("SET"), key, []byte("wuriyanto"), time.Minute); err != nil {
+				t.Fatal(err.Error())
+			}
+
+			info, err := cmd.Inspect(key)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if info.Type != TypeString || info.Length != len("wuriyanto") {
+				t.Errorf("info should be string of length %d, got %s of length %d", len("wuriyanto"), info.Type, info.Length)
+			}
+
+			if time.Until(info.Deadline) <= 0 || info.Accessed.IsZero() {
+				t.Errorf("info should have deadline and access time, got %+v", info)
+			}
+
+			again, err := cmd.Inspect(key)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if !again.Accessed.Equal(info.Accessed) {
+				t.Error("Inspect should not change access time")
+			}
+
+			if _, err := cmd.Inspect([]byte("missing")); err == nil {
+				t.Error("Inspect of missing key should return error")
+			}
+		})
+	}
+}
+
+func TestCommanderKeysLargeKeyspace(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+
+	total := 100000
+	for i := 0; i < total; i++ {
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte(fmt.Sprintf("key:%d", i)), []byte("value"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	start := time.Now()
+	keys, err := cmd.Keys(ctx, "*")
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if len(keys) != total {
+		t.Errorf("* should match all %d keys, got %d", total, len(keys))
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("KEYS should return within a second, took %v", elapsed)
+	}
+}
+
+func TestCommanderRandomKey(t *testing.T) {
+	ctx := context.Background()
+
+	for name, cmd := range map[string]Commander{"single": NewCommander(newStructureMock()), "sharded": newShardedMock(4)} {
+		key, err := cmd.RandomKey(ctx)
+		if err != nil || key != nil {
+			t.Errorf("%s RANDOMKEY of empty db should be nil, got %q %v", name, key, err)
+		}
+
+		known := map[string]bool{"1": true, "2": true, "3": true}
+		for key := range known {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte(key), []byte("wuriyanto"), 0); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("expired"), []byte("wuriyanto"), time.Millisecond); err != nil {
+			t.Fatal(err.Error())
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			key, err := cmd.RandomKey(ctx)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if !known[string(key)] {
+				t.Fatalf("%s RANDOMKEY should return one of known keys, got %q", name, key)
+			}
+			seen[string(key)] = true
+		}
+
+		if len(seen) != len(known) {
+			t.Errorf("%s RANDOMKEY should return every key eventually, got %v", name, seen)
+		}
+	}
+}
+
+func TestCommanderSize(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+
+	total := 10
+	for i := 0; i < total; i++ {
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte(fmt.Sprintf("key:%d", i)), []byte("value"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	if _, err := cmd.Set(ctx, []byte("SET"), []byte("expired"), []byte("value"), time.Millisecond); err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	size, err := cmd.Size(ctx)
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if size != total {
+		t.Errorf("size should be %d, got %d", total, size)
+	}
+}
+
+func TestCommanderListConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+
+	total := 100
+	var wg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := cmd.Push(ctx, []byte("jobs"), [][]byte{[]byte(fmt.Sprintf("job:%d", i))}, i%2 == 0); err != nil {
+				t.Error(err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	popped := make(chan string, total)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := cmd.Pop(ctx, []byte("jobs"), i%2 == 0)
+			if err != nil {
+				t.Error(err.Error())
+			}
+			popped <- string(value)
+		}(i)
+	}
+	wg.Wait()
+	close(popped)
+
+	seen := make(map[string]bool)
+	for value := range popped {
+		if seen[value] {
+			t.Errorf("%s is popped twice", value)
+		}
+		seen[value] = true
+	}
+
+	if len(seen) != total {
+		t.Errorf("every pushed job should be popped once, got %d", len(seen))
+	}
+}
+
+func TestCommanderMaxKeys(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommanderMaxKeys(newStructureMock(), 3)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte(key), []byte("value"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// access a, so b becomes the least recently used key
+	if _, err := cmd.Get(ctx, []byte("GET"), []byte("a")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := cmd.Set(ctx, []byte("SET"), []byte("d"), []byte("value"), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := cmd.Get(ctx, []byte("GET"), []byte("b")); err == nil {
+		t.Error("least recently used key should be evicted")
+	}
+
+	for _, key := range []string{"a", "c", "d"} {
+		if _, err := cmd.Get(ctx, []byte("GET"), []byte(key)); err != nil {
+			t.Errorf("key %s should not be evicted", key)
+		}
+	}
+
+	if size, _ := cmd.Size(ctx); size != 3 {
+		t.Errorf("size should be 3, got %d", size)
+	}
+}
+
+func TestCommanderTouch(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommanderMaxKeys(newStructureMock(), 2)
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte(key), []byte("value"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// touch a without reading it, so b becomes the least recently used key
+	touched, err := cmd.Touch(ctx, [][]byte{[]byte("a"), []byte("missing")})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if touched != 1 {
+		t.Errorf("only existing key should be counted, got %d", touched)
+	}
+
+	if _, err := cmd.Set(ctx, []byte("SET"), []byte("c"), []byte("value"), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if exist, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("a")); !exist {
+		t.Error("touched key should not be evicted")
+	}
+
+	if exist, _ := cmd.Exists(ctx, []byte("EXISTS"), []byte("b")); exist {
+		t.Error("stale key should be evicted")
+	}
+}
+
+func benchmarkPairs(n int) []KeyValue {
+	pairs := make([]KeyValue, 0, n)
+	for i := 0; i < n; i++ {
+		pairs = append(pairs, KeyValue{Key: []byte(fmt.Sprintf("key:%d", i)), Value: []byte("wuriyanto")})
+	}
+	return pairs
+}
+
+func BenchmarkCommanderSet(b *testing.B) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+	pairs := benchmarkPairs(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pair := range pairs {
+			if _, err := cmd.Set(ctx, []byte("SET"), pair.Key, pair.Value, 0); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	}
+}
+
+func BenchmarkCommanderBatchSet(b *testing.B) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+	pairs := benchmarkPairs(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := batchSet(ctx, cmd, pairs); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func TestCommanderContext(t *testing.T) {
+	cmd := NewCommander(newStructureMock())
+
+	t.Run("should return error of done context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), 0); err != context.Canceled {
+			t.Errorf("SET should return context.Canceled, got %v", err)
+		}
+
+		if _, err := cmd.Get(context.Background(), []byte("GET"), []byte("1")); err == nil {
+			t.Error("cancelled SET should not store key")
+		}
+	})
+}
+
+func TestCommanderDumpRestore(t *testing.T) {
+	ctx := context.Background()
+
+	source := NewCommander(newStructureMock())
+	if _, err := source.Set(ctx, []byte("SET"), []byte("name"), []byte("wuriyanto"), time.Minute); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := source.Push(ctx, []byte("jobs"), [][]byte{[]byte("a"), []byte("b")}, false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	target := NewCommander(newStructureMock())
+	for _, key := range []string{"name", "jobs"} {
+		blob, err := source.Dump(ctx, []byte(key))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := target.Restore(ctx, []byte(key), blob, 0, false); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	if value, err := target.Get(ctx, []byte("GET"), []byte("name")); err != nil || string(value.Value) != "wuriyanto" {
+		t.Error("restored string should have the dumped value")
+	}
+
+	if ttl, _ := target.TTL(ctx, []byte("TTL"), []byte("name")); ttl != -1 {
+		t.Errorf("zero ttl should restore string without lifetime, got %d", ttl)
+	}
+
+	if values, _ := target.LRange(ctx, []byte("jobs"), 0, -1); len(values) != 2 || string(values[1]) != "b" {
+		t.Errorf("restored list should have the dumped elements, got %q", values)
+	}
+
+	if ttl, _ := target.TTL(ctx, []byte("TTL"), []byte("jobs")); ttl != -1 {
+		t.Errorf("restored list should have no lifetime, got %d", ttl)
+	}
+
+	blob, _ := source.Dump(ctx, []byte("jobs"))
+	if err := target.Restore(ctx, []byte("name"), blob, 0, false); err == nil {
+		t.Error("restore onto existing key should fail without replace")
+	}
+
+	if err := target.Restore(ctx, []byte("name"), blob, 10*time.Second, true); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := target.Restore(ctx, []byte("name"), blob, -time.Second, true); err == nil || err.Error() != ErrorInvalidArgument {
+		t.Errorf("negative ttl should be invalid, got %v", err)
+	}
+
+	if dataType, _ := target.Type(ctx, []byte("name")); dataType != TypeList {
+		t.Errorf("replaced key should be a list, got %s", dataType)
+	}
+
+	if ttl, _ := target.TTL(ctx, []byte("TTL"), []byte("name")); ttl != 10 {
+		t.Errorf("ttl argument should replace lifetime of dump, got %d", ttl)
+	}
+
+	if _, err := source.Dump(ctx, []byte("missing")); err == nil {
+		t.Error("missing key should not be dumped")
+	}
+
+	corrupted := append([]byte{}, blob...)
+	corrupted[len(corrupted)/2] ^= 'A' ^ 'B'
+	if err := target.Restore(ctx, []byte("other"), corrupted, 0, false); err == nil {
+		t.Error("corrupted dump should not be restored")
+	}
+
+	for _, value := range []dumpValue{{Type: TypeHash}, {Type: TypeList}, {Type: "bogus", Value: []byte("wuriyanto")}} {
+		crafted, err := encodeDump(value)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := target.Restore(ctx, []byte("crafted"), crafted, 0, false); err == nil || err.Error() != ErrorInvalidArgument {
+			t.Errorf("dump of %s type without value should not be restored, got %v", value.Type, err)
+		}
+	}
+
+	if dataType, _ := target.Type(ctx, []byte("crafted")); dataType != TypeNone {
+		t.Errorf("crafted dump should not create key, got %s", dataType)
+	}
+}
+
+func TestCommanderScan(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+	for i := 0; i < 50; i++ {
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("key:"+strconv.Itoa(i)), []byte("value"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	t.Run("should return every key exactly once across calls", func(t *testing.T) {
+		seen := make(map[string]int)
+		var cursor uint64
+		calls := 0
+		for {
+			next, keys, err := cmd.Scan(ctx, cursor, "*", 7)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			calls++
+
+			for _, key := range keys {
+				seen[string(key)]++
+			}
+
+			if next == 0 {
+				break
+			}
+
+			if next <= cursor {
+				t.Fatalf("cursor should move forward, got %d after %d", next, cursor)
+			}
+			cursor = next
+		}
+
+		if calls < 50/7 {
+			t.Errorf("scan should be done in batches, got %d calls", calls)
+		}
+
+		if len(seen) != 50 {
+			t.Errorf("every key should be returned, got %d keys", len(seen))
+		}
+
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("key %s should be returned once, got %d", key, n)
+			}
+		}
+	})
+
+	t.Run("should filter keys by pattern", func(t *testing.T) {
+		var matched [][]byte
+		var cursor uint64
+		for {
+			next, keys, err := cmd.Scan(ctx, cursor, "key:1?", 10)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			matched = append(matched, keys...)
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+
+		if len(matched) != 10 {
+			t.Errorf("pattern should match key:10 to key:19, got %q", matched)
+		}
+	})
+
+	t.Run("should return every key existing during the whole iteration once while index is resized", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		for i := 0; i < 100; i++ {
+			if _, err := cmd.Set(ctx, []byte("SET"), []byte("stable:"+strconv.Itoa(i)), []byte("value"), 0); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+
+		seen := make(map[string]int)
+		var cursor uint64
+		for round := 0; ; round++ {
+			next, keys, err := cmd.Scan(ctx, cursor, "stable:*", 5)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			for _, key := range keys {
+				seen[string(key)]++
+			}
+
+			if next == 0 {
+				break
+			}
+			cursor = next
+
+			// grow index in the first half of iteration then shrink it
+			if round < 10 {
+				for i := 0; i < 100; i++ {
+					key := []byte("temp:" + strconv.Itoa(round) + ":" + strconv.Itoa(i))
+					if _, err := cmd.Set(ctx, []byte("SET"), key, []byte("value"), 0); err != nil {
+						t.Fatal(err.Error())
+					}
+				}
+			} else if round == 10 {
+				temp, err := cmd.Keys(ctx, "temp:*")
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+
+				if _, err := cmd.DeleteMany(ctx, temp); err != nil {
+					t.Fatal(err.Error())
+				}
+			}
+		}
+
+		if len(seen) != 100 {
+			t.Errorf("every stable key should be returned, got %d keys", len(seen))
+		}
+
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("key %s should be returned once, got %d", key, n)
+			}
+		}
+	})
+
+	t.Run("should fail on bad pattern", func(t *testing.T) {
+		if _, _, err := cmd.Scan(ctx, 0, "[", 10); err == nil {
+			t.Error("bad pattern should fail")
+		}
+	})
 }
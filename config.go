@@ -0,0 +1,107 @@
+package kece
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configSet will change setting of running server, it is applied to the next command and connection.
+// Changing requirepass doesn't disconnect clients which are already authenticated
+func (server *Server) configSet(param, value string) error {
+	switch strings.ToLower(param) {
+	case "requirepass":
+		// hashing is slow, so it is done before taking the lock
+		cred := newCredential(value, server.hashIterations())
+
+		server.Lock()
+		server.args.Auth = value
+		if len(value) > 0 {
+			server.credentials[DefaultUser] = cred
+		} else {
+			delete(server.credentials, DefaultUser)
+		}
+		server.Unlock()
+	case "maxclients":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return errors.New(ErrorInvalidArgument)
+		}
+
+		server.Lock()
+		server.args.MaxClients = n
+		server.Unlock()
+	case "idle-timeout", "write-timeout", "command-timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return errors.New(ErrorInvalidArgument)
+		}
+
+		server.Lock()
+		switch strings.ToLower(param) {
+		case "idle-timeout":
+			server.args.IdleTimeout = d
+		case "write-timeout":
+			server.args.WriteTimeout = d
+		default:
+			server.args.CommandTimeout = d
+		}
+		server.Unlock()
+	default:
+		return errors.New(ErrorInvalidArgument)
+	}
+	return nil
+}
+
+// configParams are names reported by CONFIG GET *, in the order they are reported
+var configParams = []string{
+	"port", "protocol", "requirepass", "auth-enabled", "maxclients", "maxkeys",
+	"idle-timeout", "write-timeout", "command-timeout",
+}
+
+// configGet will return name and value pairs of every param matching pattern, * match every param.
+// Password is masked, only whether it is set is reported
+func (server *Server) configGet(pattern string) [][]byte {
+	server.RLock()
+	defer server.RUnlock()
+
+	masked := ""
+	if len(server.args.Auth) > 0 {
+		masked = "********"
+	}
+
+	authEnabled := "no"
+	if len(server.args.Auth) > 0 || len(server.args.Users) > 0 {
+		authEnabled = "yes"
+	}
+
+	values := map[string]string{
+		"port":            server.args.Port,
+		"protocol":        server.args.Protocol,
+		"requirepass":     masked,
+		"auth-enabled":    authEnabled,
+		"maxclients":      strconv.Itoa(server.args.MaxClients),
+		"maxkeys":         strconv.Itoa(server.args.MaxKeys),
+		"idle-timeout":    server.args.IdleTimeout.String(),
+		"write-timeout":   server.args.WriteTimeout.String(),
+		"command-timeout": server.args.CommandTimeout.String(),
+	}
+
+	pattern = strings.ToLower(pattern)
+	pairs := make([][]byte, 0, len(configParams)*2)
+	for _, param := range configParams {
+		if pattern != "*" && pattern != param {
+			continue
+		}
+		pairs = append(pairs, []byte(param), []byte(values[param]))
+	}
+	return pairs
+}
+
+// timeouts return IdleTimeout, WriteTimeout and CommandTimeout, they may be changed by CONFIG SET at any time
+func (server *Server) timeouts() (idle, write, command time.Duration) {
+	server.RLock()
+	defer server.RUnlock()
+	return server.args.IdleTimeout, server.args.WriteTimeout, server.args.CommandTimeout
+}
@@ -0,0 +1,146 @@
+package kece
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigSet(t *testing.T) {
+	t.Run("should apply new max clients to the next connection", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", MaxClients: 1}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["PONG"] {
+			t.Fatalf("reply should be PONG, got %q", reply)
+		}
+
+		rejected := dialServer(t, server)
+		if reply, _ := bufio.NewReader(rejected).ReadString('\n'); reply != ErrorMaxClients {
+			t.Errorf("client over the limit should be rejected, got %q", reply)
+		}
+		rejected.Close()
+
+		if _, err := conn.Write([]byte("CONFIG SET maxclients 2\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["OK"] {
+			t.Fatalf("reply should be OK, got %q", reply)
+		}
+
+		accepted := dialServer(t, server)
+		defer accepted.Close()
+
+		if _, err := accepted.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := bufio.NewReader(accepted).ReadString('\n'); reply != replies["PONG"] {
+			t.Errorf("client within the new limit should be accepted, got %q", reply)
+		}
+	})
+
+	t.Run("should keep authenticated client once password is changed", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		other := &Client{ID: "002", Conn: serverConn}
+
+		expectations := []struct {
+			client  *Client
+			message string
+			reply   string
+		}{
+			{client: client, message: "AUTH my-secret", reply: replies["OK"]},
+			{client: client, message: "CONFIG SET requirepass new-secret", reply: replies["OK"]},
+			{client: client, message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{client: other, message: "AUTH my-secret", reply: ErrorInvalidAuth},
+			{client: other, message: "AUTH new-secret", reply: replies["OK"]},
+			{client: client, message: "CONFIG SET maxclients -1", reply: ErrorInvalidArgument},
+			{client: client, message: "CONFIG SET unknown 1", reply: ErrorInvalidArgument},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: e.client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+}
+
+func TestConfigGet(t *testing.T) {
+	t.Run("should report current settings and mask password", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret", MaxClients: 100, IdleTimeout: time.Minute}, NewCommander(newStructureMock()))
+
+		if pairs := server.configGet("MAXCLIENTS"); len(pairs) != 2 || string(pairs[0]) != "maxclients" || string(pairs[1]) != "100" {
+			t.Errorf("maxclients should be 100, got %q", pairs)
+		}
+
+		if err := server.configSet("idle-timeout", "5m"); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		values := make(map[string]string)
+		pairs := server.configGet("*")
+		for i := 0; i+1 < len(pairs); i += 2 {
+			values[string(pairs[i])] = string(pairs[i+1])
+		}
+
+		if len(values) != len(configParams) {
+			t.Errorf("every param should be reported, got %q", pairs)
+		}
+
+		if values["idle-timeout"] != "5m0s" {
+			t.Errorf("idle-timeout should be the live value, got %q", values["idle-timeout"])
+		}
+
+		if values["auth-enabled"] != "yes" || strings.Contains(values["requirepass"], "my-secret") {
+			t.Errorf("password should be masked, got %q", values["requirepass"])
+		}
+
+		if pairs := server.configGet("unknown"); len(pairs) != 0 {
+			t.Errorf("unknown param should not be reported, got %q", pairs)
+		}
+	})
+
+	t.Run("should require auth", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("CONFIG GET maxclients")}); reply != ErrorInvalidAuth {
+			t.Errorf("reply should be %q, got %q", ErrorInvalidAuth, reply)
+		}
+
+		processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("AUTH my-secret")})
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("CONFIG GET maxclients")}); reply != "maxclients"+crlf {
+			t.Errorf("reply should start with maxclients, got %q", reply)
+		}
+	})
+}
@@ -1,10 +1,38 @@
 package kece
 
+import "time"
+
 const (
 	// HashMap constanta
 	HashMap = "hashmap"
 	// BinarySearchTree constanta
 	BinarySearchTree = "bt"
+	// Disk constanta, keys are kept in memory and every write is appended to data file
+	Disk = "disk"
+	// DefaultDataFile , default data file of disk data storage
+	DefaultDataFile = "kece.data"
+
+	// DefaultDatabases , default number of logical databases
+	DefaultDatabases = 1
+
+	// NetworkUnix constanta, server listen on unix socket in SocketPath instead of port
+	NetworkUnix = "unix"
+
+	// DefaultSweepInterval , default interval of deleting expired keys
+	DefaultSweepInterval = time.Second
+	// DefaultSnapshotInterval , default interval of writing snapshot
+	DefaultSnapshotInterval = 5 * time.Minute
+	// DefaultShutdownTimeout , default maximum time of waiting running messages on shutdown
+	DefaultShutdownTimeout = 5 * time.Second
+	// DefaultMaxCommandSize , default maximum size of a single command in bytes
+	DefaultMaxCommandSize = 512 * 1024 * 1024
+	// DefaultSlowLogMaxLen , default number of the last slow commands kept by server
+	DefaultSlowLogMaxLen = 128
+	// DefaultHashIterations , default number of PBKDF2-HMAC-SHA256 iterations of hashing password
+	DefaultHashIterations = 600000
+
+	// ReplyShutdown , notice sent to every connected client before server close its connection
+	ReplyShutdown = "-SHUTDOWN\x0D\x0A"
 
 	// Version ,  the version of Kece
 	Version = "0.0.0"
@@ -3,6 +3,10 @@ package kece
 // DataStructure abstract interface
 type DataStructure interface {
 	Insert(key, value []byte) *Schema
+	// InsertSchema will store schema of any data type under schema.Key
+	InsertSchema(schema *Schema) *Schema
 	Search(key []byte) (*Schema, error)
 	Delete(key []byte) error
+	Keys() [][]byte
+	Len() int
 }
@@ -23,6 +23,14 @@ func (h *dataStructureMock) Insert(key, value []byte) *Schema {
 	return newData
 }
 
+// InsertSchema store schema of any data type
+func (h *dataStructureMock) InsertSchema(schema *Schema) *Schema {
+	newData := *schema
+	newData.Timestamp = time.Now()
+	h.db[string(newData.Key)] = &newData
+	return &newData
+}
+
 // Search data based on key
 func (h *dataStructureMock) Search(key []byte) (*Schema, error) {
 	value, ok := h.db[string(key)]
@@ -41,3 +49,17 @@ func (h *dataStructureMock) Delete(key []byte) error {
 	delete(h.db, string(key))
 	return nil
 }
+
+// Keys return all keys in storage
+func (h *dataStructureMock) Keys() [][]byte {
+	keys := make([][]byte, 0, len(h.db))
+	for _, value := range h.db {
+		keys = append(keys, value.Key)
+	}
+	return keys
+}
+
+// Len return number of keys in storage
+func (h *dataStructureMock) Len() int {
+	return len(h.db)
+}
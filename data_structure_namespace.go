@@ -0,0 +1,106 @@
+package kece
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// namespacePrefix start key of every logical database except database 0, keys of database 0 starting with it are reserved
+const namespacePrefix = "\x00db"
+
+// namespace is DataStructure of a logical database, every database share the same storage
+// and keys of database other than 0 are stored with prefix of its index => ex: \x00db1\x00key
+type namespace struct {
+	ds     DataStructure
+	prefix []byte
+}
+
+func newNamespace(ds DataStructure, index int) DataStructure {
+	n := &namespace{ds: ds}
+	if index > 0 {
+		n.prefix = []byte(namespacePrefix + strconv.Itoa(index) + "\x00")
+	}
+	return n
+}
+
+// own return true if stored key belongs to this database
+func (n *namespace) own(stored []byte) bool {
+	if len(n.prefix) == 0 {
+		return !bytes.HasPrefix(stored, []byte(namespacePrefix))
+	}
+	return bytes.HasPrefix(stored, n.prefix)
+}
+
+func (n *namespace) storedKey(key []byte) []byte {
+	if len(n.prefix) == 0 {
+		return key
+	}
+	return append(append(make([]byte, 0, len(n.prefix)+len(key)), n.prefix...), key...)
+}
+
+// strip return copy of stored schema with key of this database
+func (n *namespace) strip(schema *Schema, key []byte) *Schema {
+	if schema == nil || len(n.prefix) == 0 {
+		return schema
+	}
+
+	stripped := *schema
+	stripped.Key = key
+	return &stripped
+}
+
+// Insert new data to storage with new key and value
+func (n *namespace) Insert(key, value []byte) *Schema {
+	return n.strip(n.ds.Insert(n.storedKey(key), value), key)
+}
+
+// InsertSchema store schema of any data type
+func (n *namespace) InsertSchema(schema *Schema) *Schema {
+	stored := *schema
+	stored.Key = n.storedKey(schema.Key)
+	return n.strip(n.ds.InsertSchema(&stored), schema.Key)
+}
+
+// Search data based on key
+func (n *namespace) Search(key []byte) (*Schema, error) {
+	if len(n.prefix) == 0 && !n.own(key) {
+		return nil, errors.New(ErrorEmptyValue)
+	}
+
+	result, err := n.ds.Search(n.storedKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return n.strip(result, key), nil
+}
+
+// Delete data based on key
+func (n *namespace) Delete(key []byte) error {
+	if len(n.prefix) == 0 && !n.own(key) {
+		return errors.New(ErrorEmptyValue)
+	}
+	return n.ds.Delete(n.storedKey(key))
+}
+
+// Keys return all keys of this database
+func (n *namespace) Keys() [][]byte {
+	var keys [][]byte
+	for _, stored := range n.ds.Keys() {
+		if n.own(stored) {
+			keys = append(keys, stored[len(n.prefix):])
+		}
+	}
+	return keys
+}
+
+// Len return number of keys of this database, every stored key is checked so it is O(n)
+func (n *namespace) Len() int {
+	length := 0
+	for _, stored := range n.ds.Keys() {
+		if n.own(stored) {
+			length++
+		}
+	}
+	return length
+}
@@ -0,0 +1,174 @@
+package kece
+
+import (
+	"sort"
+)
+
+const (
+	// scanMinBits and scanMaxBits bound number of buckets of scanIndex, 1<<bits buckets are used
+	scanMinBits = 4
+	scanMaxBits = 24
+
+	// scanEmptyVisits is number of empty buckets visited for every requested key before a call returns
+	scanEmptyVisits = 10
+)
+
+// scanIndex is DataStructure which index keys of its storage by SCAN position, so a SCAN call only visits
+// buckets from its cursor instead of sorting every key. Bucket of key is the high bits of its position,
+// number of buckets follows number of keys and cursor is a position, so it survives resizing
+type scanIndex struct {
+	ds      DataStructure
+	bits    uint
+	size    int
+	buckets []map[string]struct{}
+}
+
+func newScanIndex(ds DataStructure) *scanIndex {
+	s := &scanIndex{ds: ds, bits: scanMinBits}
+	s.buckets = make([]map[string]struct{}, 1<<s.bits)
+	for _, key := range ds.Keys() {
+		s.add(key)
+	}
+	return s
+}
+
+// bucket return index of bucket holding SCAN position
+func (s *scanIndex) bucket(position uint64) uint64 {
+	return (position - 1) >> (32 - s.bits)
+}
+
+func (s *scanIndex) add(key []byte) {
+	b := s.bucket(scanPosition(key))
+	if s.buckets[b] == nil {
+		s.buckets[b] = make(map[string]struct{})
+	}
+
+	if _, ok := s.buckets[b][string(key)]; ok {
+		return
+	}
+	s.buckets[b][string(key)] = struct{}{}
+	s.size++
+
+	if s.size > len(s.buckets) && s.bits < scanMaxBits {
+		s.resize(s.bits + 1)
+	}
+}
+
+func (s *scanIndex) remove(key []byte) {
+	b := s.bucket(scanPosition(key))
+	if _, ok := s.buckets[b][string(key)]; !ok {
+		return
+	}
+	delete(s.buckets[b], string(key))
+	s.size--
+
+	if s.size < len(s.buckets)/4 && s.bits > scanMinBits {
+		s.resize(s.bits - 1)
+	}
+}
+
+// resize will move every key to 1<<bits buckets, it is amortized by the number of keys added or removed since
+func (s *scanIndex) resize(bits uint) {
+	buckets := s.buckets
+	s.bits = bits
+	s.buckets = make([]map[string]struct{}, 1<<bits)
+	for _, bucket := range buckets {
+		for key := range bucket {
+			b := s.bucket(scanPosition([]byte(key)))
+			if s.buckets[b] == nil {
+				s.buckets[b] = make(map[string]struct{})
+			}
+			s.buckets[b][key] = struct{}{}
+		}
+	}
+}
+
+// Insert new data to storage with new key and value
+func (s *scanIndex) Insert(key, value []byte) *Schema {
+	newData := s.ds.Insert(key, value)
+	if newData != nil {
+		s.add(key)
+	}
+	return newData
+}
+
+// InsertSchema store schema of any data type
+func (s *scanIndex) InsertSchema(schema *Schema) *Schema {
+	newData := s.ds.InsertSchema(schema)
+	if newData != nil {
+		s.add(schema.Key)
+	}
+	return newData
+}
+
+// Search data based on key
+func (s *scanIndex) Search(key []byte) (*Schema, error) {
+	return s.ds.Search(key)
+}
+
+// Delete data based on key
+func (s *scanIndex) Delete(key []byte) error {
+	if err := s.ds.Delete(key); err != nil {
+		return err
+	}
+	s.remove(key)
+	return nil
+}
+
+// Keys return all keys in storage
+func (s *scanIndex) Keys() [][]byte {
+	return s.ds.Keys()
+}
+
+// Len return number of keys in storage
+func (s *scanIndex) Len() int {
+	return s.ds.Len()
+}
+
+// ScanKeys will return up to count keys from cursor in SCAN order and the cursor of the next call, zero next cursor
+// means it is done. Only buckets from cursor are visited and sorted, a call stops once count keys are collected or
+// scanEmptyVisits empty buckets are visited for every requested key, so it never visits every bucket
+func (s *scanIndex) ScanKeys(cursor uint64, count int) (uint64, [][]byte) {
+	if cursor == 0 {
+		cursor = 1
+	}
+
+	type candidate struct {
+		position uint64
+		key      []byte
+	}
+
+	var keys [][]byte
+	empty := 0
+	for b := s.bucket(cursor); b < uint64(len(s.buckets)); b++ {
+		if len(keys) >= count || empty >= scanEmptyVisits*count {
+			return b<<(32-s.bits) + 1, keys
+		}
+
+		if len(s.buckets[b]) == 0 {
+			empty++
+			continue
+		}
+
+		// cursor may point inside the bucket once buckets are merged or a call stopped inside it
+		candidates := make([]candidate, 0, len(s.buckets[b]))
+		for key := range s.buckets[b] {
+			if position := scanPosition([]byte(key)); position >= cursor {
+				candidates = append(candidates, candidate{position: position, key: []byte(key)})
+			}
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].position < candidates[j].position
+		})
+
+		for i, candidate := range candidates {
+			// keys of the same position are returned together, cursor can't resume between them
+			if len(keys) >= count && candidate.position != candidates[i-1].position {
+				return candidate.position, keys
+			}
+			keys = append(keys, candidate.key)
+		}
+	}
+	return 0, keys
+}
@@ -0,0 +1,81 @@
+package kece
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+)
+
+// dumpVersion is the first byte of every dump, it is increased once dumpValue is changed incompatibly
+const dumpVersion = 1
+
+// dumpValue is the value of a single key in dump, Key and lifetime are not included so it can be restored to any key
+type dumpValue struct {
+	Type  string
+	Value []byte
+	List  [][]byte
+	Hash  map[string][]byte
+}
+
+// encodeDump will serialize value to base64 of version, gob encoded value and crc32 checksum of both,
+// it is text so dump can be sent as a single token of kece protocol
+func encodeDump(value dumpValue) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(dumpVersion)
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(checksum)
+
+	blob := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
+	base64.StdEncoding.Encode(blob, buf.Bytes())
+	return blob, nil
+}
+
+// decodeDump will deserialize blob written by encodeDump, blob with unknown version, wrong checksum,
+// unknown type or empty list or hash is invalid
+func decodeDump(blob []byte) (dumpValue, error) {
+	var value dumpValue
+
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(blob)))
+	n, err := base64.StdEncoding.Decode(raw, blob)
+	if err != nil || n < 5 {
+		return value, errors.New(ErrorInvalidArgument)
+	}
+	raw = raw[:n]
+
+	payload, checksum := raw[:n-4], raw[n-4:]
+	if payload[0] != dumpVersion || binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(payload) {
+		return value, errors.New(ErrorInvalidArgument)
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(payload[1:])).Decode(&value); err != nil {
+		return value, errors.New(ErrorInvalidArgument)
+	}
+
+	// checksum doesn't prove blob is written by encodeDump, so value must be one a key can hold
+	switch value.Type {
+	// string is stored without type
+	case "", TypeString:
+		value.List, value.Hash = nil, nil
+	case TypeList:
+		if len(value.List) == 0 {
+			return value, errors.New(ErrorInvalidArgument)
+		}
+		value.Value, value.Hash = nil, nil
+	case TypeHash:
+		if len(value.Hash) == 0 {
+			return value, errors.New(ErrorInvalidArgument)
+		}
+		value.Value, value.List = nil, nil
+	default:
+		return value, errors.New(ErrorInvalidArgument)
+	}
+	return value, nil
+}
@@ -1,5 +1,10 @@
 package kece
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	// ErrorInvalidAuth error
 	ErrorInvalidAuth = "-INVALID AUTH\x0D\x0A"
@@ -11,4 +16,45 @@ const (
 	ErrorInvalidOperation = "-INVALID OPERATION\x0D\x0A"
 	// ErrorInvalidArgument error
 	ErrorInvalidArgument = "-INVALID ARGUMENT(S)\x0D\x0A"
+	// ErrorNotInteger error
+	ErrorNotInteger = "-VALUE IS NOT AN INTEGER OR OUT OF RANGE\x0D\x0A"
+	// ErrorMaxClients error
+	ErrorMaxClients = "-MAX CLIENTS REACHED\x0D\x0A"
+	// ErrorInvalidProtocol error
+	ErrorInvalidProtocol = "-INVALID PROTOCOL\x0D\x0A"
+	// ErrorNoPermission error
+	ErrorNoPermission = "-NO PERMISSION\x0D\x0A"
+	// ErrorReadOnly error
+	ErrorReadOnly = "-READ ONLY\x0D\x0A"
+	// ErrorKeyExists error
+	ErrorKeyExists = "-KEY ALREADY EXISTS\x0D\x0A"
+	// ErrorWrongType error
+	ErrorWrongType = "-WRONGTYPE OPERATION AGAINST A KEY HOLDING THE WRONG KIND OF VALUE\x0D\x0A"
+	// ErrorCommandTooLarge error
+	ErrorCommandTooLarge = "-COMMAND TOO LARGE\x0D\x0A"
 )
+
+// maxUnknownCommandLen is max length of unknown command echoed in its error
+const maxUnknownCommandLen = 64
+
+// errorUnknownCommand return error of unknown command echoing the command,
+// control and non ASCII characters are replaced so command can't break the reply
+func errorUnknownCommand(command string) error {
+	if len(command) > maxUnknownCommandLen {
+		command = command[:maxUnknownCommandLen]
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E {
+			return '?'
+		}
+		return r
+	}, command)
+
+	return fmt.Errorf("-ERR unknown command '%s'%s", sanitized, crlf)
+}
+
+// errorWrongArity return error of command sent with wrong number of arguments
+func errorWrongArity(command string) error {
+	return fmt.Errorf("-ERR wrong number of arguments for '%s'%s", command, crlf)
+}
@@ -0,0 +1,77 @@
+package kece
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// info will return server statistics sectioned the same way as redis INFO, every line is terminated by CR/LF
+func (server *Server) info(ctx context.Context) []byte {
+	server.RLock()
+	var uptime time.Duration
+	if !server.startTime.IsZero() {
+		uptime = time.Since(server.startTime)
+	}
+	clients := len(server.clients)
+	server.RUnlock()
+
+	keys, err := server.size(ctx)
+	if err != nil {
+		server.logger.Error("Failed to read keyspace size. Err: %v", err)
+	}
+
+	enabled := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# Server%s", crlf)
+	fmt.Fprintf(&out, "kece_version:%s%s", Version, crlf)
+	fmt.Fprintf(&out, "go_version:%s%s", runtime.Version(), crlf)
+	fmt.Fprintf(&out, "protocol:%s%s", server.args.Protocol, crlf)
+	fmt.Fprintf(&out, "uptime_in_seconds:%d%s", int64(uptime.Seconds()), crlf)
+	fmt.Fprintf(&out, "auth_enabled:%d%s", enabled(server.authRequired()), crlf)
+	fmt.Fprintf(&out, "tls_enabled:%d%s", enabled(len(server.args.TLSCertFile) > 0 && len(server.args.TLSKeyFile) > 0), crlf)
+	fmt.Fprint(&out, crlf)
+
+	fmt.Fprintf(&out, "# Clients%s", crlf)
+	fmt.Fprintf(&out, "connected_clients:%d%s", clients, crlf)
+	fmt.Fprint(&out, crlf)
+
+	fmt.Fprintf(&out, "# Stats%s", crlf)
+	fmt.Fprintf(&out, "total_commands_processed:%d%s", atomic.LoadInt64(&server.metrics.commandsTotal), crlf)
+	fmt.Fprintf(&out, "evicted_keys:%d%s", server.evictions(), crlf)
+	fmt.Fprint(&out, crlf)
+
+	fmt.Fprintf(&out, "# Persistence%s", crlf)
+	fmt.Fprintf(&out, "snapshot_enabled:%d%s", enabled(len(server.args.SnapshotPath) > 0), crlf)
+	fmt.Fprintf(&out, "aof_enabled:%d%s", enabled(len(server.args.AOFPath) > 0), crlf)
+	fmt.Fprint(&out, crlf)
+
+	fmt.Fprintf(&out, "# Keyspace%s", crlf)
+	fmt.Fprintf(&out, "keys:%d%s", keys, crlf)
+	return out.Bytes()
+}
+
+// objectLine will return metadata of key reported by DEBUG OBJECT in a single line, times are unix milliseconds
+// and deadline is -1 if key has no lifetime
+func objectLine(info ObjectInfo) []byte {
+	deadline := int64(-1)
+	if !info.Deadline.IsZero() {
+		deadline = info.Deadline.UnixNano() / int64(time.Millisecond)
+	}
+
+	var accessed, idle int64
+	if !info.Accessed.IsZero() {
+		accessed = info.Accessed.UnixNano() / int64(time.Millisecond)
+		idle = int64(time.Since(info.Accessed).Seconds())
+	}
+	return []byte(fmt.Sprintf("type:%s length:%d deadline:%d accessed:%d idle:%d", info.Type, info.Length, deadline, accessed, idle))
+}
@@ -0,0 +1,57 @@
+package kece
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyValidators are built in validators selected by -key-validator
+var keyValidators = map[string]func([]byte) error{
+	"no-spaces": NoSpacesKey,
+	"printable": PrintableKey,
+}
+
+// NoSpacesKey function, KeyValidator rejecting key containing space, tab or new line
+func NoSpacesKey(key []byte) error {
+	for _, r := range string(key) {
+		if unicode.IsSpace(r) {
+			return errors.New("key contains space")
+		}
+	}
+	return nil
+}
+
+// PrintableKey function, KeyValidator rejecting key which is not valid UTF-8 or contains control character
+func PrintableKey(key []byte) error {
+	if !utf8.Valid(key) {
+		return errors.New("key is not valid UTF-8")
+	}
+
+	for _, r := range string(key) {
+		if !unicode.IsPrint(r) {
+			return errors.New("key contains non printable character")
+		}
+	}
+	return nil
+}
+
+// createdKeys will return keys which command may create, they are checked by KeyValidator.
+// Existing keys are still readable and deletable, so keys stored before validator is set can be cleaned up
+func (c *ClientMessage) createdKeys() [][]byte {
+	switch string(c.Cmd) {
+	case commands["MSET"]:
+		keys := make([][]byte, 0, len(c.Pairs))
+		for _, pair := range c.Pairs {
+			keys = append(keys, pair.Key)
+		}
+		return keys
+	case commands["RENAME"], commands["RENAMENX"], commands["COPY"]:
+		return c.Args[1:2]
+	case commands["SET"], commands["SETNX"], commands["SETEX"], commands["PSETEX"], commands["GETSET"], commands["APPEND"],
+		commands["SETRANGE"], commands["INCR"], commands["DECR"], commands["INCRBY"], commands["DECRBY"],
+		commands["LPUSH"], commands["RPUSH"], commands["HSET"], commands["RESTORE"]:
+		return [][]byte{c.Key}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package kece
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestKeyValidator(t *testing.T) {
+	t.Run("should check key by built in validators", func(t *testing.T) {
+		expectations := []struct {
+			validator func([]byte) error
+			key       string
+			valid     bool
+		}{
+			{validator: NoSpacesKey, key: "user:1", valid: true},
+			{validator: NoSpacesKey, key: "user 1", valid: false},
+			{validator: NoSpacesKey, key: "user\n1", valid: false},
+			{validator: PrintableKey, key: "pengguna:ñ", valid: true},
+			{validator: PrintableKey, key: "user\x001", valid: false},
+			{validator: PrintableKey, key: "\xff\xfe", valid: false},
+		}
+
+		for _, e := range expectations {
+			if err := e.validator([]byte(e.key)); (err == nil) != e.valid {
+				t.Errorf("key %q should be valid: %v, got %v", e.key, e.valid, err)
+			}
+		}
+	})
+
+	t.Run("should check only keys created by command", func(t *testing.T) {
+		rejectAll := func(key []byte) error {
+			return errors.New("rejected")
+		}
+
+		expectations := []struct {
+			message string
+			valid   bool
+		}{
+			{message: "SET 1 wuriyanto", valid: false},
+			{message: "MSET 1 wuriyanto 2 agung", valid: false},
+			{message: "RENAME 1 2", valid: false},
+			{message: "HSET 1 name wuriyanto", valid: false},
+			{message: "GET 1", valid: true},
+			{message: "DEL 1 2", valid: true},
+			{message: "PING", valid: true},
+		}
+
+		for _, e := range expectations {
+			cm := &ClientMessage{Message: []byte(e.message), keyValidator: rejectAll}
+			if err := cm.ValidateMessage(); (err == nil) != e.valid {
+				t.Errorf("%s should be valid: %v, got %v", e.message, e.valid, err)
+			}
+		}
+	})
+
+	t.Run("should reply ERROR for key rejected by server validator", func(t *testing.T) {
+		server := NewServer(&Arguments{KeyValidator: NoSpacesKey}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "*3\r\n$3\r\nSET\r\n$6\r\nuser 1\r\n$9\r\nwuriyanto\r\n", reply: replies["ERROR"]},
+			{message: "*3\r\n$3\r\nSET\r\n$6\r\nuser:1\r\n$9\r\nwuriyanto\r\n", reply: replies["OK"]},
+			{message: "GET user:1", reply: "wuriyanto" + crlf},
+			{message: "EXISTS user", reply: "0" + crlf},
+		}
+
+		for _, e := range expectations {
+			if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package kece
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// KeyspaceChannel is pub/sub channel of keyspace events, every message is formatted as "<event> <db> <key>"
+	KeyspaceChannel = "__keyspace__"
+
+	// keyspaceExpired is event of key deleted by sweeper once it passed its deadline,
+	// other events are lower case name of mutating command eg: set, del, expire
+	keyspaceExpired = "expired"
+
+	// keyspaceEventsBuffer is number of events queued before new events are dropped
+	keyspaceEventsBuffer = 1024
+)
+
+// keyspaceEvent is a change of key, key is empty for event of the whole database eg: flushall
+type keyspaceEvent struct {
+	name string
+	db   int
+	key  []byte
+}
+
+// message will format event as message published to KeyspaceChannel
+func (e keyspaceEvent) message() []byte {
+	message := e.name + " " + strconv.Itoa(e.db)
+	if len(e.key) > 0 {
+		message += " " + string(e.key)
+	}
+	return []byte(message)
+}
+
+// changedKeys will return keys changed by mutating command, nil if command change the whole database
+func (c *ClientMessage) changedKeys() [][]byte {
+	switch string(c.Cmd) {
+	case commands["DEL"]:
+		return c.deleted
+	case commands["RENAME"], commands["RENAMENX"]:
+		return c.Args[:2]
+	case commands["MSET"], commands["COPY"]:
+		return c.createdKeys()
+	case commands["FLUSHALL"], commands["SWAPDB"]:
+		return nil
+	}
+	return [][]byte{c.Key}
+}
+
+// notifyCommand will queue keyspace event of every key changed by successful mutating command
+func (server *Server) notifyCommand(db int, cm *ClientMessage) {
+	name := strings.ToLower(string(cm.Cmd))
+
+	keys := cm.changedKeys()
+	if len(keys) == 0 {
+		server.notifyKeyspace(name, db, nil)
+		return
+	}
+
+	for _, key := range keys {
+		server.notifyKeyspace(name, db, key)
+	}
+}
+
+// hookExpired will publish expired event of every key deleted once it passed its deadline, either by sweeper
+// or by command reaching it. Commander shared by several servers publish to the last one
+func (server *Server) hookExpired() {
+	for index, db := range server.databases {
+		index := index
+		for _, shard := range shardsOf(db) {
+			shard.lock.Lock()
+			shard.onExpired = func(key []byte) {
+				server.notifyKeyspace(keyspaceExpired, index, key)
+			}
+			shard.lock.Unlock()
+		}
+	}
+}
+
+// countKeyspaceSubscribers must be called while holding lock of server, once subscribers of channels are changed
+func (server *Server) countKeyspaceSubscribers() {
+	atomic.StoreInt32(&server.keyspaceSubscribers, int32(len(server.channels[KeyspaceChannel])))
+}
+
+// notifyKeyspace will queue keyspace event if KeyspaceChannel has subscribers, event is dropped rather than
+// blocking the command once queue is full. It doesn't take lock of server, commander may call it under its lock
+func (server *Server) notifyKeyspace(name string, db int, key []byte) {
+	if atomic.LoadInt32(&server.keyspaceSubscribers) == 0 {
+		return
+	}
+
+	select {
+	case server.events <- keyspaceEvent{name: name, db: db, key: key}:
+	default:
+		server.logger.Warn("Keyspace events queue is full, event %s of key %s is dropped", name, key)
+	}
+}
+
+// publishKeyspace will publish queued keyspace events to subscribers of KeyspaceChannel until server is shutting down
+func (server *Server) publishKeyspace() {
+	for {
+		select {
+		case event := <-server.events:
+			server.publish(KeyspaceChannel, event.message())
+		case <-server.quit:
+			return
+		}
+	}
+}
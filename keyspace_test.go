@@ -0,0 +1,116 @@
+package kece
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceEvents(t *testing.T) {
+	server := NewServer(&Arguments{Databases: 2}, NewCommander(newStructureMock()))
+	go server.publishKeyspace()
+	defer close(server.quit)
+
+	subscriberConn, subscriberClientConn := net.Pipe()
+	defer subscriberClientConn.Close()
+	subscriber := &Client{ID: "001", Conn: subscriberConn}
+	subscriberReader := bufio.NewReader(subscriberClientConn)
+
+	if reply := processAndRead(t, server, subscriberReader, &ClientMessage{Client: subscriber, Message: []byte("SUBSCRIBE " + KeyspaceChannel)}); reply != replies["OK"] {
+		t.Fatalf("reply of SUBSCRIBE should be OK, got %q", reply)
+	}
+
+	received := make(chan string, 16)
+	go func() {
+		for {
+			message, err := subscriberReader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			received <- message
+		}
+	}()
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	client := &Client{ID: "002", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expect := func(event string) {
+		t.Helper()
+
+		select {
+		case message := <-received:
+			if message != "MESSAGE "+KeyspaceChannel+" "+event+crlf {
+				t.Errorf("subscriber should receive event %q, got %q", event, message)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("subscriber should receive event %q", event)
+		}
+	}
+
+	expectations := []struct {
+		message string
+		reply   string
+		events  []string
+	}{
+		{message: "SET 1 wuriyanto", reply: replies["OK"], events: []string{"set 0 1"}},
+		{message: "MSET 2 a 3 b", reply: replies["OK"], events: []string{"mset 0 2", "mset 0 3"}},
+		{message: "RENAME 2 4", reply: replies["OK"], events: []string{"rename 0 2", "rename 0 4"}},
+		{message: "DEL 1 missing", reply: "1" + crlf, events: []string{"del 0 1"}},
+		{message: "DEL missing", reply: "0" + crlf},
+		{message: "SELECT 1", reply: replies["OK"]},
+		{message: "PSETEX 5 10 kece", reply: replies["OK"], events: []string{"psetex 1 5"}},
+		{message: "FLUSHALL", reply: replies["OK"], events: []string{"flushall 1"}},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+		}
+
+		for _, event := range e.events {
+			expect(event)
+		}
+	}
+
+	for _, key := range []string{"6", "7"} {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("PSETEX " + key + " 10 kece")}); reply != replies["OK"] {
+			t.Fatalf("reply of PSETEX should be OK, got %q", reply)
+		}
+		expect("psetex 1 " + key)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// key reached by command is deleted before sweeper, it is published the same way
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("GET 7")}); reply != "(nil)"+crlf {
+		t.Fatalf("reply of GET of expired key should be nil, got %q", reply)
+	}
+	expect("expired 1 7")
+
+	server.deleteExpired()
+	expect("expired 1 6")
+
+	select {
+	case message := <-received:
+		t.Errorf("subscriber should not receive more events, got %q", message)
+	default:
+	}
+}
+
+func TestKeyspaceEventsWithoutSubscriber(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	client := &Client{ID: "001", Conn: serverConn}
+
+	if reply := processAndRead(t, server, bufio.NewReader(clientConn), &ClientMessage{Client: client, Message: []byte("SET 1 wuriyanto")}); reply != replies["OK"] {
+		t.Fatalf("reply of SET should be OK, got %q", reply)
+	}
+
+	if len(server.events) != 0 {
+		t.Errorf("event should not be queued without subscriber, got %d queued", len(server.events))
+	}
+}
@@ -0,0 +1,102 @@
+package kece
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+const (
+	// LogLevelDebug constanta
+	LogLevelDebug = "debug"
+	// LogLevelInfo constanta
+	LogLevelInfo = "info"
+	// LogLevelWarn constanta
+	LogLevelWarn = "warn"
+	// LogLevelError constanta
+	LogLevelError = "error"
+)
+
+var (
+	logLevels = map[string]int{
+		LogLevelDebug: 0,
+		LogLevelInfo:  1,
+		LogLevelWarn:  2,
+		LogLevelError: 3,
+	}
+
+	logColors = map[string]string{
+		LogLevelDebug: colorCyan,
+		LogLevelInfo:  colorGreen,
+		LogLevelWarn:  colorYellow,
+		LogLevelError: colorRed,
+	}
+)
+
+// Logger interface, implement this interface to inject your own logger to kece server
+type Logger interface {
+	Debug(format string, v ...interface{})
+	Info(format string, v ...interface{})
+	Warn(format string, v ...interface{})
+	Error(format string, v ...interface{})
+}
+
+// NewLogger function, default Logger's constructor.
+// Message below level is discarded, unknown level is treated as info.
+// Output is colored only if out is a terminal and color is not disabled
+func NewLogger(out io.Writer, level string) Logger {
+	return newLogger(out, level, true)
+}
+
+func newLogger(out io.Writer, level string, color bool) Logger {
+	minLevel, ok := logLevels[level]
+	if !ok {
+		minLevel = logLevels[LogLevelInfo]
+	}
+
+	return &logger{
+		out:   out,
+		log:   log.New(out, "", log.LstdFlags),
+		level: minLevel,
+		color: color,
+	}
+}
+
+type logger struct {
+	out   io.Writer
+	log   *log.Logger
+	level int
+	color bool
+}
+
+func (l *logger) print(level, format string, v ...interface{}) {
+	if logLevels[level] < l.level {
+		return
+	}
+
+	message := fmt.Sprintf("[%s] %s", level, fmt.Sprintf(format, v...))
+	if l.color {
+		message = colorize(logColors[level], message, l.out)
+	}
+	l.log.Println(message)
+}
+
+// Debug will print message with debug level
+func (l *logger) Debug(format string, v ...interface{}) {
+	l.print(LogLevelDebug, format, v...)
+}
+
+// Info will print message with info level
+func (l *logger) Info(format string, v ...interface{}) {
+	l.print(LogLevelInfo, format, v...)
+}
+
+// Warn will print message with warn level
+func (l *logger) Warn(format string, v ...interface{}) {
+	l.print(LogLevelWarn, format, v...)
+}
+
+// Error will print message with error level
+func (l *logger) Error(format string, v ...interface{}) {
+	l.print(LogLevelError, format, v...)
+}
@@ -0,0 +1,68 @@
+package kece
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+
+	t.Run("should discard message below level", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := NewLogger(&out, LogLevelWarn)
+
+		logger.Debug("debug message")
+		logger.Info("info message")
+		logger.Warn("warn message")
+		logger.Error("error message %d", 1)
+
+		if strings.Contains(out.String(), "debug message") || strings.Contains(out.String(), "info message") {
+			t.Errorf("message below level should be discarded, got %q", out.String())
+		}
+
+		if !strings.Contains(out.String(), "[warn] warn message") || !strings.Contains(out.String(), "[error] error message 1") {
+			t.Errorf("message with level should be printed, got %q", out.String())
+		}
+	})
+
+	t.Run("should print plain text when output is not a terminal", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := NewLogger(&out, LogLevelDebug)
+
+		logger.Debug("debug message")
+
+		if strings.Contains(out.String(), "\033[") {
+			t.Errorf("output should not contain color code, got %q", out.String())
+		}
+	})
+
+	t.Run("should use info level when level is unknown", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := NewLogger(&out, "verbose")
+
+		logger.Debug("debug message")
+		logger.Info("info message")
+
+		if strings.Contains(out.String(), "debug message") || !strings.Contains(out.String(), "info message") {
+			t.Errorf("unknown level should be treated as info, got %q", out.String())
+		}
+	})
+
+	t.Run("should print plain text when color is disabled", func(t *testing.T) {
+		disableColor()
+
+		if colored := colorize(colorGreen, "kece", os.Stdout); colored != "kece" {
+			t.Errorf("color helper should emit plain text, got %q", colored)
+		}
+
+		var out bytes.Buffer
+		logger := newLogger(&out, LogLevelInfo, false)
+		logger.Info("info message")
+
+		if strings.Contains(out.String(), "\033[") {
+			t.Errorf("output should not contain color code, got %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package kece
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metrics hold operational counters of server, exposed in prometheus text format
+type metrics struct {
+	commandsTotal    int64
+	connectedClients int64
+
+	// calls count processed commands by name, name is taken from commands map so its cardinality is bounded
+	calls map[string]int64
+	sync.Mutex
+}
+
+func newMetrics() *metrics {
+	return &metrics{calls: make(map[string]int64)}
+}
+
+// command will count a processed command
+func (m *metrics) command(name string) {
+	atomic.AddInt64(&m.commandsTotal, 1)
+
+	m.Lock()
+	m.calls[name]++
+	m.Unlock()
+}
+
+// connected will add delta to number of connected clients
+func (m *metrics) connected(delta int64) {
+	atomic.AddInt64(&m.connectedClients, delta)
+}
+
+// write will encode every counter in prometheus text format
+func (m *metrics) write(keys int, evictions int64) []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintln(&out, "# HELP kece_commands_processed_total Total number of processed commands.")
+	fmt.Fprintln(&out, "# TYPE kece_commands_processed_total counter")
+	fmt.Fprintf(&out, "kece_commands_processed_total %d\n", atomic.LoadInt64(&m.commandsTotal))
+
+	m.Lock()
+	names := make([]string, 0, len(m.calls))
+	for name := range m.calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(&out, "# HELP kece_command_calls_total Number of processed commands by name.")
+	fmt.Fprintln(&out, "# TYPE kece_command_calls_total counter")
+	for _, name := range names {
+		fmt.Fprintf(&out, "kece_command_calls_total{command=%q} %d\n", name, m.calls[name])
+	}
+	m.Unlock()
+
+	fmt.Fprintln(&out, "# HELP kece_connected_clients Number of connected clients.")
+	fmt.Fprintln(&out, "# TYPE kece_connected_clients gauge")
+	fmt.Fprintf(&out, "kece_connected_clients %d\n", atomic.LoadInt64(&m.connectedClients))
+
+	fmt.Fprintln(&out, "# HELP kece_keys Number of keys in keyspace.")
+	fmt.Fprintln(&out, "# TYPE kece_keys gauge")
+	fmt.Fprintf(&out, "kece_keys %d\n", keys)
+
+	fmt.Fprintln(&out, "# HELP kece_evicted_keys_total Total number of keys evicted by MaxKeys.")
+	fmt.Fprintln(&out, "# TYPE kece_evicted_keys_total counter")
+	fmt.Fprintf(&out, "kece_evicted_keys_total %d\n", evictions)
+
+	return out.Bytes()
+}
+
+// serveMetrics will start http server of metrics on MetricsAddr, it is separated from the main listener
+func (server *Server) serveMetrics() error {
+	if len(server.args.MetricsAddr) <= 0 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", server.args.MetricsAddr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		keys, err := server.size(r.Context())
+		if err != nil {
+			server.logger.Error("Failed to read keyspace size. Err: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if _, err := w.Write(server.metrics.write(keys, server.evictions())); err != nil {
+			server.logger.Error("Failed to write metrics. Err: %v", err)
+		}
+	})
+
+	metricsServer := &http.Server{Handler: mux}
+
+	server.Lock()
+	server.metricsServer = metricsServer
+	server.metricsListener = listener
+	server.Unlock()
+
+	server.logger.Info("kece metrics listen on : %s", listener.Addr())
+	go func() {
+		if err := metricsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			server.logger.Error("Metrics server stopped. Err: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,96 @@
+package kece
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitMetrics will wait until server is ready, metrics server is already listening by then
+func waitMetrics(t *testing.T, server *Server) net.Addr {
+	waitServer(t, server)
+
+	server.RLock()
+	defer server.RUnlock()
+	return server.metricsListener.Addr()
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("should expose counters in prometheus text format", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", MetricsAddr: "127.0.0.1:0", ShutdownTimeout: time.Second},
+			NewCommander(newStructureMock()))
+
+		started := make(chan error, 1)
+		go func() {
+			started <- server.Start()
+		}()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for _, message := range []string{"SET 1 wuriyanto\r\n", "SET 2 agung\r\n", "GET 1\r\n"} {
+			if _, err := conn.Write([]byte(message)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if _, err := reader.ReadString('\n'); err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+		}
+
+		addr := waitMetrics(t, server)
+		res, err := http.Get("http://" + addr.String() + "/metrics")
+		if err != nil {
+			t.Fatalf("error get metrics %s", err.Error())
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("error read metrics %s", err.Error())
+		}
+
+		for _, expected := range []string{
+			"kece_commands_processed_total 3",
+			`kece_command_calls_total{command="SET"} 2`,
+			`kece_command_calls_total{command="GET"} 1`,
+			"kece_connected_clients 1",
+			"kece_keys 2",
+			"kece_evicted_keys_total 0",
+		} {
+			if !strings.Contains(string(body), expected+"\n") {
+				t.Errorf("metrics should contain %q, got %s", expected, body)
+			}
+		}
+
+		server.Stop()
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Start should return after Stop")
+		}
+
+		if _, err := http.Get("http://" + addr.String() + "/metrics"); err == nil {
+			t.Error("metrics server should be closed after Stop")
+		}
+	})
+
+	t.Run("should not start metrics server if MetricsAddr is empty", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		if err := server.serveMetrics(); err != nil {
+			t.Fatalf("error serve metrics %s", err.Error())
+		}
+
+		if server.metricsServer != nil {
+			t.Error("metrics server should not be started")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package kece
+
+import (
+	"sync/atomic"
+)
+
+// workerPool process messages of every client by a fixed number of goroutines instead of a goroutine per client.
+// Every client is bound to a single worker, so its messages are still processed in the order they are sent
+type workerPool struct {
+	queues []chan *ClientMessage
+	next   uint32
+}
+
+func newWorkerPool(size int) *workerPool {
+	queues := make([]chan *ClientMessage, size)
+	for i := range queues {
+		queues[i] = make(chan *ClientMessage, clientQueueSize)
+	}
+	return &workerPool{queues: queues}
+}
+
+// assign will return queue of the next worker, clients are bound to workers round robin
+func (p *workerPool) assign() chan<- *ClientMessage {
+	next := atomic.AddUint32(&p.next, 1)
+	return p.queues[(next-1)%uint32(len(p.queues))]
+}
+
+// run will start every worker, message which is still queued once done is closed is dropped
+func (p *workerPool) run(server *Server, done <-chan struct{}) {
+	for _, queue := range p.queues {
+		go func(queue <-chan *ClientMessage) {
+			for {
+				select {
+				case cm := <-queue:
+					server.processQueued(cm)
+				case <-done:
+					return
+				}
+			}
+		}(queue)
+	}
+}
@@ -0,0 +1,135 @@
+package kece
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Workers: 2, ShutdownTimeout: time.Second},
+		NewCommander(newStructureMock()))
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start()
+	}()
+
+	var wg sync.WaitGroup
+	for c := 0; c < 5; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+
+			conn := dialServer(t, server)
+			defer conn.Close()
+
+			// every message is pipelined, replies should come back in the same order
+			var messages strings.Builder
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(&messages, "ECHO %d-%d\r\nINCR counter\r\n", c, i)
+			}
+
+			if _, err := conn.Write([]byte(messages.String())); err != nil {
+				t.Errorf("error write message %s", err.Error())
+				return
+			}
+
+			reader := bufio.NewReader(conn)
+			for i := 0; i < 100; i++ {
+				reply, err := reader.ReadString('\n')
+				if err != nil {
+					t.Errorf("error read reply %s", err.Error())
+					return
+				}
+
+				if expected := fmt.Sprintf("%d-%d", c, i) + crlf; reply != expected {
+					t.Errorf("reply should be %q, got %q", expected, reply)
+					return
+				}
+
+				if _, err := reader.ReadString('\n'); err != nil {
+					t.Errorf("error read reply %s", err.Error())
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("GET counter\r\n")); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("error read reply %s", err.Error())
+	}
+
+	if counter, _ := strconv.Atoi(strings.TrimSpace(reply)); counter != 500 {
+		t.Errorf("every INCR should be applied, got %q", reply)
+	}
+
+	server.Stop()
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Start should return after Stop")
+	}
+}
+
+func TestWorkerPoolAssign(t *testing.T) {
+	pool := newWorkerPool(3)
+
+	// the counter wraps around, int of it is negative on 32 bit platforms
+	pool.next = math.MaxUint32 - 1
+	expected := []int{(math.MaxUint32 - 1) % 3, math.MaxUint32 % 3, 0, 1}
+	for _, e := range expected {
+		if queue := pool.assign(); queue != pool.queues[e] {
+			t.Errorf("client should be assigned to worker %d", e)
+		}
+	}
+}
+
+// BenchmarkWorkerPool connect a short lived client per PING, with and without worker pool
+func BenchmarkWorkerPool(b *testing.B) {
+	for _, workers := range []int{0, 8} {
+		b.Run(fmt.Sprintf("workers %d", workers), func(b *testing.B) {
+			server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Workers: workers, LogLevel: LogLevelError},
+				NewCommander(newStructureMock()))
+			go server.Start()
+			defer server.Stop()
+
+			<-server.Ready()
+			addr := server.Addr()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := net.Dial(addr.Network(), addr.String())
+					if err != nil {
+						b.Fatal(err.Error())
+					}
+
+					if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+						b.Fatal(err.Error())
+					}
+
+					if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+						b.Fatal(err.Error())
+					}
+					conn.Close()
+				}
+			})
+		})
+	}
+}
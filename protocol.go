@@ -0,0 +1,340 @@
+package kece
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	// ProtocolKece constanta, newline delimited protocol
+	ProtocolKece = "kece"
+	// ProtocolRESP constanta, Redis serialization protocol
+	ProtocolRESP = "resp"
+
+	// maxBulkLength is the maximum length of a single RESP bulk string
+	maxBulkLength = 512 * 1024 * 1024
+
+	// minBulkSize is the size of the smallest RESP bulk string => $0\r\n\r\n
+	minBulkSize = 6
+	// maxArrayLength is the maximum number of elements of a RESP array
+	maxArrayLength = maxBulkLength / minBulkSize
+)
+
+var protocols = map[string]bool{
+	ProtocolKece: true,
+	ProtocolRESP: true,
+}
+
+// protocol is the framing layer between connection and command dispatch,
+// simple string and error replies are the same in both protocols so they are written as is
+type protocol interface {
+	// ReadMessage will read a single command from reader
+	ReadMessage(reader *bufio.Reader) ([]byte, error)
+	Bulk(value []byte) []byte
+	Integer(n int64) []byte
+	// Array will encode multiple values, nil value means missing
+	Array(values [][]byte) []byte
+	// Message will encode message delivered to channel subscribers
+	Message(channel string, payload []byte) []byte
+	// ArrayLength will encode header of array whose values are written after it
+	ArrayLength(n int) []byte
+	// Cursor will encode cursor to resume iteration from followed by values
+	Cursor(cursor uint64, values [][]byte) []byte
+	// Nil will encode missing value, it is distinct from empty value
+	Nil() []byte
+}
+
+// newProtocol will return protocol of name, message read by it is at most maxSize bytes, zero maxSize means unlimited
+func newProtocol(name string, lengthPrefixed bool, maxSize int) protocol {
+	if name == ProtocolRESP {
+		return respProtocol{maxSize: maxSize}
+	}
+	return keceProtocol{lengthPrefixed: lengthPrefixed, maxSize: maxSize}
+}
+
+// readLine will read until '\n' like ReadBytes, ErrorCommandTooLarge is returned once line exceeds max bytes
+// so the rest of line is never buffered. Zero max means unlimited
+func readLine(reader *bufio.Reader, max int) ([]byte, error) {
+	if max <= 0 {
+		return reader.ReadBytes('\n')
+	}
+
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return nil, errors.New(ErrorCommandTooLarge)
+		}
+
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// keceProtocol read a message per line, if lengthPrefixed is true a line ending with $<length> token
+// is followed by value of exactly length bytes and CR/LF => ex: SET k $11\r\nhello\nworld\r\n
+type keceProtocol struct {
+	lengthPrefixed bool
+	maxSize        int
+}
+
+func (p keceProtocol) ReadMessage(reader *bufio.Reader) ([]byte, error) {
+	line, err := readLine(reader, p.maxSize)
+	if err != nil || !p.lengthPrefixed {
+		return line, err
+	}
+
+	length, ok := valueLength(line)
+	if !ok {
+		return line, nil
+	}
+
+	// value is rejected before it is read
+	if p.maxSize > 0 && len(line)+length+2 > p.maxSize {
+		return nil, errors.New(ErrorCommandTooLarge)
+	}
+
+	data, err := readValue(reader, length)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, data...), nil
+}
+
+// readValue will read value of length bytes followed by CR/LF, it is read in chunks
+// so memory grows with bytes actually received instead of the claimed length
+func readValue(reader io.Reader, length int) ([]byte, error) {
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, reader, int64(length)+2); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if !bytes.HasSuffix(data.Bytes(), []byte(crlf)) {
+		return nil, errors.New(ErrorInvalidProtocol)
+	}
+	return data.Bytes(), nil
+}
+
+func (keceProtocol) Bulk(value []byte) []byte {
+	return append(append([]byte(nil), value...), crlf...)
+}
+
+func (keceProtocol) Integer(n int64) []byte {
+	return []byte(strconv.FormatInt(n, 10) + crlf)
+}
+
+// Array write every value in its own line, missing value and empty array are written as empty line
+func (keceProtocol) Array(values [][]byte) []byte {
+	var reply bytes.Buffer
+	for _, v := range values {
+		reply.Write(v)
+		reply.WriteString(crlf)
+	}
+
+	if len(values) == 0 {
+		reply.WriteString(crlf)
+	}
+	return reply.Bytes()
+}
+
+func (keceProtocol) Message(channel string, payload []byte) []byte {
+	var reply bytes.Buffer
+	reply.WriteString(replies["MESSAGE"])
+	reply.WriteString(" " + channel + " ")
+	reply.Write(payload)
+	reply.WriteString(crlf)
+	return reply.Bytes()
+}
+
+// ArrayLength is empty, every value is written in its own line
+func (keceProtocol) ArrayLength(n int) []byte {
+	return nil
+}
+
+// Nil is written as (nil), empty value is written as empty line
+func (keceProtocol) Nil() []byte {
+	return []byte("(nil)" + crlf)
+}
+
+// Cursor write cursor in the first line followed by a line per value
+func (p keceProtocol) Cursor(cursor uint64, values [][]byte) []byte {
+	return append([]byte(strconv.FormatUint(cursor, 10)+crlf), p.Array(values)...)
+}
+
+type respProtocol struct {
+	maxSize int
+}
+
+func (p respProtocol) ReadMessage(reader *bufio.Reader) ([]byte, error) {
+	frame, _, err := readFrameLimit(reader, p.maxSize)
+	return frame, err
+}
+
+func (respProtocol) Bulk(value []byte) []byte {
+	if value == nil {
+		return []byte("$-1" + crlf)
+	}
+
+	var reply bytes.Buffer
+	reply.WriteString("$" + strconv.Itoa(len(value)) + crlf)
+	reply.Write(value)
+	reply.WriteString(crlf)
+	return reply.Bytes()
+}
+
+func (respProtocol) Integer(n int64) []byte {
+	return []byte(":" + strconv.FormatInt(n, 10) + crlf)
+}
+
+func (p respProtocol) Array(values [][]byte) []byte {
+	var reply bytes.Buffer
+	reply.WriteString("*" + strconv.Itoa(len(values)) + crlf)
+	for _, v := range values {
+		reply.Write(p.Bulk(v))
+	}
+	return reply.Bytes()
+}
+
+// Message is encoded as array the same way as redis does, so redis clients can consume it
+func (p respProtocol) Message(channel string, payload []byte) []byte {
+	return p.Array([][]byte{[]byte("message"), []byte(channel), payload})
+}
+
+// readFrame will read a RESP array of bulk strings and return the whole frame and its elements,
+// a message not starting with '*' is an inline command, it is returned as a single line without elements
+func readFrame(reader *bufio.Reader) ([]byte, [][]byte, error) {
+	return readFrameLimit(reader, 0)
+}
+
+// readFrameLimit will read frame like readFrame, ErrorCommandTooLarge is returned once frame exceeds max bytes
+// before the rest of it is read. Zero max means unlimited
+func readFrameLimit(reader *bufio.Reader, max int) ([]byte, [][]byte, error) {
+	line, err := readLine(reader, max)
+	if err != nil || len(line) == 0 || line[0] != '*' {
+		return line, nil, err
+	}
+
+	n, err := strconv.Atoi(string(bytes.TrimSpace(line[1:])))
+	if err != nil || n <= 0 || n > maxArrayLength {
+		return nil, nil, errors.New(ErrorInvalidProtocol)
+	}
+
+	// every element takes at least minBulkSize bytes, so array which can't fit is rejected before it is read
+	if max > 0 && n > (max-len(line))/minBulkSize {
+		return nil, nil, errors.New(ErrorCommandTooLarge)
+	}
+
+	var frame bytes.Buffer
+	frame.Write(line)
+
+	// args grow with elements actually read instead of the claimed length
+	var args [][]byte
+	for i := 0; i < n; i++ {
+		remaining := 0
+		if max > 0 {
+			remaining = max - frame.Len()
+			if remaining <= 0 {
+				return nil, nil, errors.New(ErrorCommandTooLarge)
+			}
+		}
+
+		header, err := readLine(reader, remaining)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(header) == 0 || header[0] != '$' {
+			return nil, nil, errors.New(ErrorInvalidProtocol)
+		}
+
+		length, err := strconv.Atoi(string(bytes.TrimSpace(header[1:])))
+		if err != nil || length < 0 || length > maxBulkLength {
+			return nil, nil, errors.New(ErrorInvalidProtocol)
+		}
+
+		if max > 0 && frame.Len()+len(header)+length+2 > max {
+			return nil, nil, errors.New(ErrorCommandTooLarge)
+		}
+
+		// bulk string is followed by CR/LF
+		data, err := readValue(reader, length)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		frame.Write(header)
+		frame.Write(data)
+		args = append(args, data[:length])
+	}
+	return frame.Bytes(), args, nil
+}
+
+// isFrame return true if message is a RESP array
+func isFrame(message []byte) bool {
+	return len(message) > 0 && message[0] == '*'
+}
+
+// valueLength return length of value if the last token of line is $<length>
+func valueLength(line []byte) (int, bool) {
+	fields := bytes.Fields(line)
+	if len(fields) < 2 {
+		return 0, false
+	}
+
+	last := fields[len(fields)-1]
+	if last[0] != '$' {
+		return 0, false
+	}
+
+	length, err := strconv.Atoi(string(last[1:]))
+	if err != nil || length < 0 || length > maxBulkLength {
+		return 0, false
+	}
+	return length, true
+}
+
+// lengthPrefixedArgs will split message of a line followed by length prefixed value,
+// the $<length> token is replaced by the value
+func lengthPrefixedArgs(message []byte) ([][]byte, bool) {
+	idx := bytes.IndexByte(message, '\n')
+	if idx < 0 || idx == len(message)-1 {
+		return nil, false
+	}
+
+	line, data := message[:idx+1], message[idx+1:]
+	length, ok := valueLength(line)
+	if !ok || len(data) != length+2 {
+		return nil, false
+	}
+
+	fields := bytes.Fields(line)
+	args := make([][]byte, 0, len(fields))
+	args = append(args, fields[:len(fields)-1]...)
+	return append(args, data[:length]), true
+}
+
+// Cursor is encoded as array of cursor and array of values the same way as redis SCAN does
+func (p respProtocol) Cursor(cursor uint64, values [][]byte) []byte {
+	var reply bytes.Buffer
+	reply.WriteString("*2" + crlf)
+	reply.Write(p.Bulk([]byte(strconv.FormatUint(cursor, 10))))
+	reply.Write(p.Array(values))
+	return reply.Bytes()
+}
+
+func (respProtocol) ArrayLength(n int) []byte {
+	return []byte("*" + strconv.Itoa(n) + crlf)
+}
+
+// Nil is null bulk string, empty value is bulk string of zero length
+func (respProtocol) Nil() []byte {
+	return []byte("$-1" + crlf)
+}
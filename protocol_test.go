@@ -0,0 +1,204 @@
+package kece
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProtocol(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should serve redis client using RESP protocol", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", Protocol: ProtocolRESP}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "*3\r\n$3\r\nSET\r\n$1\r\n1\r\n$10\r\nhello kece\r\n", reply: replies["OK"]},
+			{message: "*2\r\n$3\r\nget\r\n$1\r\n1\r\n", reply: "$10\r\nhello kece\r\n"},
+			{message: "*2\r\n$6\r\nEXISTS\r\n$1\r\n1\r\n", reply: ":1\r\n"},
+			{message: "*3\r\n$4\r\nMGET\r\n$1\r\n1\r\n$1\r\n2\r\n", reply: "*2\r\n$10\r\nhello kece\r\n$-1\r\n"},
+			{message: "*2\r\n$3\r\nDEL\r\n$1\r\n1\r\n", reply: ":1\r\n"},
+			{message: "*1\r\n$6\r\nDBSIZE\r\n", reply: ":0\r\n"},
+			{message: "DBSIZE\r\n", reply: ":0\r\n"},
+			{message: "*2\r\n$4\r\nSCAN\r\n$1\r\n0\r\n", reply: "*2\r\n$1\r\n0\r\n*0\r\n"},
+			{message: "*1\r\n$7\r\nUNKNOWN\r\n", reply: errorUnknownCommand("UNKNOWN").Error()},
+		}
+
+		for _, e := range expectations {
+			if _, err := conn.Write([]byte(e.message)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			reply := make([]byte, len(e.reply))
+			if _, err := io.ReadFull(reader, reply); err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+
+			if string(reply) != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should store length prefixed value containing new lines", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", LengthPrefixed: true}, cmd)
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+
+		value := "{\n  \"name\": \"kece\"\n}\n"
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET 1 $" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n", reply: replies["OK"]},
+			{message: "GET 1\r\n", reply: value + crlf},
+			{message: "SET 2 wuriyanto\r\n", reply: replies["OK"]},
+			{message: "GET 2\r\n", reply: "wuriyanto" + crlf},
+		}
+
+		for _, e := range expectations {
+			if _, err := conn.Write([]byte(e.message)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			reply := make([]byte, len(e.reply))
+			if _, err := io.ReadFull(reader, reply); err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+
+			if string(reply) != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+
+		result, err := cmd.Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(result.Value) != value {
+			t.Error("value should be stored intact")
+		}
+	})
+
+	t.Run("should echo binary safe payload", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret", Protocol: ProtocolRESP}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		payload := "hello kece\r\n\x00\x01\xff"
+		message := "*2\r\n$4\r\nECHO\r\n$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n"
+		expected := "$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n"
+
+		go server.processMessage(&ClientMessage{Client: client, Message: []byte(message)})
+
+		reply := make([]byte, len(expected))
+		if _, err := io.ReadFull(reader, reply); err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+
+		if string(reply) != expected {
+			t.Errorf("reply should be %q, got %q", expected, reply)
+		}
+	})
+
+	t.Run("should reject malformed RESP frame", func(t *testing.T) {
+		frames := []string{
+			"*x\r\n",
+			"*1\r\n+SET\r\n",
+			"*1\r\n$-3\r\n",
+			"*1\r\n$3\r\nSETX\r\n",
+		}
+
+		for _, frame := range frames {
+			_, _, err := readFrame(bufio.NewReader(strings.NewReader(frame)))
+			if err == nil || err.Error() != ErrorInvalidProtocol {
+				t.Errorf("frame %q should be invalid", frame)
+			}
+		}
+	})
+
+	t.Run("should read kece line as inline command", func(t *testing.T) {
+		frame, args, err := readFrame(bufio.NewReader(strings.NewReader("SET 1 wuriyanto\r\nGET 1\r\n")))
+		if err != nil || string(frame) != "SET 1 wuriyanto\r\n" || args != nil {
+			t.Errorf("inline command should be read as single line, got %q", frame)
+		}
+	})
+
+	t.Run("should reject message larger than max size", func(t *testing.T) {
+		value := strings.Repeat("a", 8192)
+		protocols := map[string]protocol{
+			"kece line":           keceProtocol{maxSize: 1024},
+			"kece length prefix":  keceProtocol{lengthPrefixed: true, maxSize: 1024},
+			"resp bulk string":    respProtocol{maxSize: 1024},
+			"resp inline command": respProtocol{maxSize: 1024},
+		}
+
+		messages := map[string]string{
+			"kece line":           "SET 1 " + value + "\r\n",
+			"kece length prefix":  "SET 1 $8192\r\n" + value + "\r\n",
+			"resp bulk string":    "*3\r\n$3\r\nSET\r\n$1\r\n1\r\n$8192\r\n" + value + "\r\n",
+			"resp inline command": "SET 1 " + value + "\r\n",
+		}
+
+		for name, p := range protocols {
+			_, err := p.ReadMessage(bufio.NewReader(strings.NewReader(messages[name])))
+			if err == nil || err.Error() != ErrorCommandTooLarge {
+				t.Errorf("%s should be too large, got %v", name, err)
+			}
+		}
+
+		message, err := keceProtocol{maxSize: 1024}.ReadMessage(bufio.NewReader(strings.NewReader("SET 1 wuriyanto\r\n")))
+		if err != nil || string(message) != "SET 1 wuriyanto\r\n" {
+			t.Errorf("message within max size should be read, got %q", message)
+		}
+	})
+
+	t.Run("should reject array longer than any frame", func(t *testing.T) {
+		header := "*999999999999\r\n"
+		if _, _, err := readFrame(bufio.NewReader(strings.NewReader(header))); err == nil || err.Error() != ErrorInvalidProtocol {
+			t.Errorf("unlimited frame should be invalid, got %v", err)
+		}
+
+		if _, err := (respProtocol{maxSize: 1024}).ReadMessage(bufio.NewReader(strings.NewReader("*1000\r\n"))); err == nil || err.Error() != ErrorCommandTooLarge {
+			t.Errorf("array which can't fit max size should be too large, got %v", err)
+		}
+
+		message, err := keceProtocol{maxSize: 1024}.ReadMessage(bufio.NewReader(strings.NewReader(header)))
+		if err != nil {
+			t.Fatalf("kece line should be read, got %v", err)
+		}
+
+		if err := (&ClientMessage{Message: message}).ValidateMessage(); err == nil || err.Error() != ErrorInvalidProtocol {
+			t.Errorf("kece array should be invalid, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package kece
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// replicaQueueSize is the number of commands buffered for every replica, replica which falls behind it is disconnected
+	replicaQueueSize = 1024
+
+	// replicaRetryInterval is the interval of reconnecting to primary once replication is broken
+	replicaRetryInterval = time.Second
+)
+
+// replica is a client which sent SYNC, its commands are queued so they are written by its own goroutine
+type replica struct {
+	queue chan []byte
+
+	// db is database of the last queued command, command of other database is preceded by SELECT
+	db int
+	mu sync.Mutex
+}
+
+// syncReplica will register client as replica, then its stream is started by sending the whole keyspace.
+// Mutating commands are paused until then, so every write is either in the keyspace sent or streamed after it
+func (server *Server) syncReplica(client *Client) error {
+	server.replication.Lock()
+	defer server.replication.Unlock()
+
+	entries, err := server.snapshot()
+	if err != nil {
+		return err
+	}
+
+	// replica only read from primary after SYNC, so it must not be closed by idle timeout
+	if err := client.MarkReplica(); err != nil {
+		return err
+	}
+
+	r := &replica{queue: make(chan []byte, replicaQueueSize)}
+	server.Lock()
+	server.replicas[client] = r
+	server.Unlock()
+
+	server.logger.Info("client %s is a replica, sending %d keys", client.ID, len(entries))
+	go server.streamReplica(client, entries, r.queue)
+	return nil
+}
+
+// streamReplica will write keyspace as FLUSHALL followed by RESTORE and PEXPIREAT of every key, then every queued command.
+// Keyspace end with database 0 selected, the same database queue start with.
+// Replica is closed if any write fails, then its connection handler unregister it
+func (server *Server) streamReplica(client *Client, entries []SnapshotEntry, queue <-chan []byte) {
+	defer client.Close()
+
+	if err := server.write(client, respProtocol{}.Array([][]byte{[]byte("FLUSHALL")})); err != nil {
+		server.logger.Error("Failed to send keyspace to replica %s. Err: %v", client.ID, err)
+		return
+	}
+
+	db := 0
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.ExpiredAt.IsZero() && !entry.ExpiredAt.After(now) {
+			continue
+		}
+
+		blob, err := encodeDump(dumpValue{Type: entry.Type, Value: entry.Value, List: entry.List, Hash: entry.Hash})
+		if err != nil {
+			server.logger.Error("Failed to dump key %s for replica %s. Err: %v", entry.Key, client.ID, err)
+			continue
+		}
+
+		if entry.DB != db {
+			if err := server.write(client, selectCommand(entry.DB)); err != nil {
+				server.logger.Error("Failed to send keyspace to replica %s. Err: %v", client.ID, err)
+				return
+			}
+			db = entry.DB
+		}
+
+		restore := respProtocol{}.Array([][]byte{[]byte("RESTORE"), entry.Key, []byte("0"), blob, []byte("REPLACE")})
+		if err := server.write(client, restore); err != nil {
+			server.logger.Error("Failed to send keyspace to replica %s. Err: %v", client.ID, err)
+			return
+		}
+
+		// zero ttl of RESTORE means no lifetime, so lifetime is sent as its deadline
+		if !entry.ExpiredAt.IsZero() {
+			if err := server.write(client, expireAtCommand(entry.Key, entry.ExpiredAt)); err != nil {
+				server.logger.Error("Failed to send keyspace to replica %s. Err: %v", client.ID, err)
+				return
+			}
+		}
+	}
+
+	if db != 0 {
+		if err := server.write(client, selectCommand(0)); err != nil {
+			server.logger.Error("Failed to send keyspace to replica %s. Err: %v", client.ID, err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-queue:
+			if !ok {
+				return
+			}
+
+			if err := server.write(client, line); err != nil {
+				server.logger.Error("Failed to stream command to replica %s. Err: %v", client.ID, err)
+				return
+			}
+		case <-server.quit:
+			return
+		}
+	}
+}
+
+// propagate will queue mutating command of database db to every replica, replica whose queue is full is disconnected
+// so a slow replica never blocks writers
+func (server *Server) propagate(db int, raw []byte) {
+	server.RLock()
+	defer server.RUnlock()
+
+	if len(server.replicas) == 0 {
+		return
+	}
+
+	line := commandLine(raw)
+	for client, r := range server.replicas {
+		if client.IsClosed() {
+			continue
+		}
+
+		if !r.enqueue(db, line) {
+			server.logger.Warn("replica %s falls behind, closing its connection", client.ID)
+			if err := client.Close(); err != nil {
+				server.logger.Error("Error when closing the client. Err: %v", err)
+			}
+		}
+	}
+}
+
+// enqueue will queue line of database db without blocking, false is returned if queue is full
+func (r *replica) enqueue(db int, line []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if db != r.db {
+		select {
+		case r.queue <- selectCommand(db):
+			r.db = db
+		default:
+			return false
+		}
+	}
+
+	select {
+	case r.queue <- line:
+		return true
+	default:
+		return false
+	}
+}
+
+// replicaOf will stop replicating from the current primary if any, then start replicating from addr.
+// Empty addr promote server to primary
+func (server *Server) replicaOf(addr string) {
+	server.Lock()
+	defer server.Unlock()
+
+	if server.replicaStop != nil {
+		close(server.replicaStop)
+		server.replicaStop = nil
+		server.logger.Info("stop replicating from primary %s", server.args.ReplicaOf)
+	}
+
+	server.args.ReplicaOf = addr
+	if len(addr) <= 0 {
+		return
+	}
+
+	server.replicaStop = make(chan struct{})
+	go server.replicate(addr, server.replicaStop)
+}
+
+// replicate will copy keyspace of primary in addr and apply every command it streams,
+// it reconnects until stop is closed or server is stopped
+func (server *Server) replicate(addr string, stop <-chan struct{}) {
+	for {
+		err := server.syncFrom(addr, stop)
+		select {
+		case <-stop:
+			return
+		case <-server.quit:
+			return
+		default:
+		}
+
+		server.logger.Error("Replication from primary %s is broken, retrying in %v. Err: %v", addr, replicaRetryInterval, err)
+		select {
+		case <-time.After(replicaRetryInterval):
+		case <-stop:
+			return
+		case <-server.quit:
+			return
+		}
+	}
+}
+
+// authPrimary will send AUTH of PrimaryAuth to primary and wait for its reply, it does nothing if PrimaryAuth is empty.
+// AUTH is sent inline like SYNC, so it is read by primary of either protocol
+func (server *Server) authPrimary(conn net.Conn, reader *bufio.Reader) error {
+	server.RLock()
+	password := server.args.PrimaryAuth
+	server.RUnlock()
+
+	if len(password) <= 0 {
+		return nil
+	}
+
+	if _, err := conn.Write([]byte("AUTH " + password + crlf)); err != nil {
+		return err
+	}
+
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if reply != replies["OK"] {
+		return errors.New(strconv.Quote(reply))
+	}
+	return nil
+}
+
+// syncFrom will send SYNC to primary in addr, after AUTH if PrimaryAuth is set, then apply its stream until connection is closed
+func (server *Server) syncFrom(addr string, stop <-chan struct{}) error {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// close connection once replication or server is stopped, so reading the stream returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-server.quit:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	if err := server.authPrimary(conn, reader); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte("SYNC" + crlf)); err != nil {
+		return err
+	}
+	server.logger.Info("replicating from primary %s", addr)
+
+	client := discardClient("primary")
+	defer client.Conn.Close()
+
+	for {
+		line, _, err := readFrame(reader)
+		if err != nil {
+			return err
+		}
+
+		if !isFrame(line) {
+			line = bytes.TrimSpace(line)
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		// primary reply error instead of streaming if it refuse SYNC, ex: auth is required
+		if line[0] == '-' {
+			return errors.New(strconv.Quote(string(line)))
+		}
+
+		// stream read before replication is stopped is not applied
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		server.processMessage(&ClientMessage{Client: client, Message: line})
+	}
+}
@@ -0,0 +1,302 @@
+package kece
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// waitKey will poll commander until key has value, or fail after a few seconds
+func waitKey(t *testing.T, cmd Commander, key, value string) {
+	ctx := context.Background()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if result, err := cmd.Get(ctx, []byte("GET"), []byte(key)); err == nil && string(result.Value) == value {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("key %s should be replicated with value %s", key, value)
+}
+
+func TestReplication(t *testing.T) {
+	ctx := context.Background()
+
+	primary := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0"}, NewCommander(newStructureMock()))
+	go func() {
+		if err := primary.Start(); err != nil {
+			t.Errorf("error start primary %s", err.Error())
+		}
+	}()
+	defer primary.Stop()
+
+	conn := dialServer(t, primary)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	send := func(message string) string {
+		if _, err := conn.Write([]byte(message + crlf)); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+		return reply
+	}
+
+	// written before replica connect, so it is sent with keyspace
+	send("SET before wuriyanto")
+	send("RPUSH jobs a b")
+	send("SETEX session 100 token")
+
+	replicaCommander := NewCommander(newStructureMock())
+	replicaCommander.Set(ctx, []byte("SET"), []byte("stale"), []byte("value"), 0)
+
+	replica := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", ReplicaOf: primary.Addr().String(), ReadOnly: true},
+		replicaCommander)
+	go func() {
+		if err := replica.Start(); err != nil {
+			t.Errorf("error start replica %s", err.Error())
+		}
+	}()
+	defer replica.Stop()
+
+	waitKey(t, replicaCommander, "before", "wuriyanto")
+	if values, _ := replicaCommander.LRange(ctx, []byte("jobs"), 0, -1); len(values) != 2 {
+		t.Errorf("list should be replicated, got %q", values)
+	}
+
+	if exist, _ := replicaCommander.Exists(ctx, []byte("EXISTS"), []byte("stale")); exist {
+		t.Error("key which is not in primary should be removed from replica")
+	}
+
+	// written after replica connect, so it is streamed
+	if reply := send("SET after agung"); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+	waitKey(t, replicaCommander, "after", "agung")
+
+	// keyspace is sent before streamed commands
+	if ttl, _ := replicaCommander.TTL(ctx, []byte("TTL"), []byte("session")); ttl <= 0 || ttl > 100 {
+		t.Errorf("lifetime should be replicated, got %d", ttl)
+	}
+
+	send("DEL before")
+	send("SET done yes")
+	waitKey(t, replicaCommander, "done", "yes")
+	if exist, _ := replicaCommander.Exists(ctx, []byte("EXISTS"), []byte("before")); exist {
+		t.Error("deleted key should be deleted from replica")
+	}
+
+	if reply := send("INFO"); reply == replies["ERROR"] {
+		t.Error("primary should keep serving clients")
+	}
+}
+
+func TestReplicationPrimaryAuth(t *testing.T) {
+	ctx := context.Background()
+
+	for _, protocol := range []string{ProtocolKece, ProtocolRESP} {
+		primaryCommander := NewCommander(newStructureMock())
+		primaryCommander.Set(ctx, []byte("SET"), []byte("before"), []byte("wuriyanto"), 0)
+
+		primary := NewServer(&Arguments{HashIterations: testHashIterations, Network: "tcp", Host: "127.0.0.1", Port: "0", Protocol: protocol,
+			Auth: "my-secret"}, primaryCommander)
+		go func() {
+			if err := primary.Start(); err != nil {
+				t.Errorf("error start primary %s", err.Error())
+			}
+		}()
+
+		replicaCommander := NewCommander(newStructureMock())
+		replica := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", ReplicaOf: waitServer(t, primary).String(),
+			PrimaryAuth: "my-secret", ReadOnly: true}, replicaCommander)
+		go func() {
+			if err := replica.Start(); err != nil {
+				t.Errorf("error start replica %s", err.Error())
+			}
+		}()
+
+		waitKey(t, replicaCommander, "before", "wuriyanto")
+		replica.Stop()
+		primary.Stop()
+	}
+}
+
+func TestReplicationIdleTimeout(t *testing.T) {
+	primary := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", IdleTimeout: 100 * time.Millisecond},
+		NewCommander(newStructureMock()))
+	go func() {
+		if err := primary.Start(); err != nil {
+			t.Errorf("error start primary %s", err.Error())
+		}
+	}()
+	defer primary.Stop()
+
+	conn := dialServer(t, primary)
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("SYNC" + crlf)); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	reader := bufio.NewReader(conn)
+	if _, _, err := readFrame(reader); err != nil {
+		t.Fatalf("error read keyspace %s", err.Error())
+	}
+
+	// replica doesn't send anything after SYNC, it must outlive idle timeout
+	time.Sleep(300 * time.Millisecond)
+
+	writer, err := net.Dial("tcp", primary.Addr().String())
+	if err != nil {
+		t.Fatalf("error dial primary %s", err.Error())
+	}
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte("SET k v" + crlf)); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, _, err := readFrame(reader)
+	if err != nil {
+		t.Fatalf("replica should still receive writes, got %s", err.Error())
+	}
+
+	if string(line) != "SET k v"+crlf {
+		t.Errorf("write should be streamed, got %q", line)
+	}
+}
+
+func TestReplicaOf(t *testing.T) {
+	ctx := context.Background()
+
+	primaryCommander := NewCommander(newStructureMock())
+	primary := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0"}, primaryCommander)
+	go func() {
+		if err := primary.Start(); err != nil {
+			t.Errorf("error start primary %s", err.Error())
+		}
+	}()
+	defer primary.Stop()
+
+	replicaCommander := NewCommander(newStructureMock())
+	replica := NewServer(&Arguments{HashIterations: testHashIterations, Network: "tcp", Host: "127.0.0.1", Port: "0", Auth: "my-secret"}, replicaCommander)
+	go func() {
+		if err := replica.Start(); err != nil {
+			t.Errorf("error start replica %s", err.Error())
+		}
+	}()
+	defer replica.Stop()
+
+	conn := dialServer(t, replica)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	send := func(message string) string {
+		if _, err := conn.Write([]byte(message + crlf)); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+		return reply
+	}
+
+	host, port, _ := net.SplitHostPort(waitServer(t, primary).String())
+	if reply := send("REPLICAOF " + host + " " + port); reply != ErrorInvalidAuth {
+		t.Errorf("REPLICAOF should require auth, got %q", reply)
+	}
+
+	send("AUTH my-secret")
+	if reply := send("REPLICAOF " + host + " not-a-port"); reply != ErrorInvalidArgument {
+		t.Errorf("invalid port should be rejected, got %q", reply)
+	}
+
+	// written before REPLICAOF, so it is sent with keyspace
+	primaryCommander.Set(ctx, []byte("SET"), []byte("copied"), []byte("value"), 0)
+
+	if reply := send("REPLICAOF " + host + " " + port); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+	waitKey(t, replicaCommander, "copied", "value")
+
+	if reply := send("REPLICAOF no one"); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+
+	if reply := send("SET local value"); reply != replies["OK"] {
+		t.Errorf("promoted replica should accept writes, got %q", reply)
+	}
+	waitKey(t, replicaCommander, "local", "value")
+
+	// writes of old primary are no longer applied, SYNC is not sent again so the local write is kept
+	primaryConn := dialServer(t, primary)
+	defer primaryConn.Close()
+	if _, err := primaryConn.Write([]byte("SET ignored value" + crlf)); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+	bufio.NewReader(primaryConn).ReadString('\n')
+
+	time.Sleep(100 * time.Millisecond)
+	if exist, _ := replicaCommander.Exists(ctx, []byte("EXISTS"), []byte("ignored")); exist {
+		t.Error("promoted replica should not apply writes of old primary")
+	}
+
+	replica.RLock()
+	replicaOf := replica.args.ReplicaOf
+	replica.RUnlock()
+	if replicaOf != "" {
+		t.Errorf("promoted replica should have no primary, got %s", replicaOf)
+	}
+}
+
+func TestReplicationDatabases(t *testing.T) {
+	primary := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Databases: 2}, NewCommander(newStructureMock()))
+	go func() {
+		if err := primary.Start(); err != nil {
+			t.Errorf("error start primary %s", err.Error())
+		}
+	}()
+	defer primary.Stop()
+
+	conn := dialServer(t, primary)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for _, message := range []string{"SELECT 1", "SET before wuriyanto"} {
+		if _, err := conn.Write([]byte(message + crlf)); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+		reader.ReadString('\n')
+	}
+
+	replica := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Databases: 2, ReplicaOf: primary.Addr().String()},
+		NewCommander(newStructureMock()))
+	go func() {
+		if err := replica.Start(); err != nil {
+			t.Errorf("error start replica %s", err.Error())
+		}
+	}()
+	defer replica.Stop()
+
+	waitKey(t, replica.databases[1], "before", "wuriyanto")
+
+	if _, err := conn.Write([]byte("SET after agung" + crlf)); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+	reader.ReadString('\n')
+
+	waitKey(t, replica.databases[1], "after", "agung")
+	if size, _ := replica.databases[0].Size(context.Background()); size != 0 {
+		t.Errorf("keys of database 1 should not be replicated into database 0, got %d keys", size)
+	}
+}
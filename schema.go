@@ -4,9 +4,35 @@ import (
 	"time"
 )
 
+const (
+	// TypeNone constanta, type of missing key
+	TypeNone = "none"
+	// TypeString constanta
+	TypeString = "string"
+	// TypeList constanta
+	TypeList = "list"
+	// TypeHash constanta
+	TypeHash = "hash"
+)
+
 // Schema database
 type Schema struct {
 	Key       []byte
 	Value     []byte
 	Timestamp time.Time
+
+	// Type of value, empty Type is string so backend doesn't need to set it on Insert
+	Type string
+	// List hold elements of list type
+	List [][]byte
+	// Hash hold fields of hash type
+	Hash map[string][]byte
+}
+
+// DataType return type of value stored in schema
+func (s *Schema) DataType() string {
+	if len(s.Type) <= 0 {
+		return TypeString
+	}
+	return s.Type
 }
@@ -4,101 +4,457 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"errors"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// clientQueueSize is the number of pipelined messages buffered per client before reading is blocked
+const clientQueueSize = 64
+
 // Server struct
 type Server struct {
-	clients       map[*Client]bool
-	args          *Arguments
-	register      chan *Client
-	unregister    chan *Client
-	publish       chan []byte
-	clientMessage chan *ClientMessage
-	commander     Commander
-	done          chan bool
+	clients    map[*Client]bool
+	args       *Arguments
+	register   chan *Client
+	unregister chan *Client
+	commander  Commander
+	logger     Logger
+	done       chan bool
+	listener   net.Listener
+	stopOnce   sync.Once
+
+	// startTime is set once server is listening, it is used to report uptime
+	startTime time.Time
+
+	// connections count accepted unix socket connections, it is used to number their ID
+	connections uint64
+
+	// protocol encode replies and read commands, selected by args.Protocol
+	protocol protocol
+
+	// snapshotLock serialize periodic and on demand snapshot, both write the same temp file
+	snapshotLock sync.Mutex
+
+	// metrics count processed commands and connected clients, metricsServer is nil if MetricsAddr is not configured
+	metrics         *metrics
+	metricsServer   *http.Server
+	metricsListener net.Listener
+
+	// slowLog keep the last commands exceeding SlowLogThreshold
+	slowLog *slowLog
+
+	// aof log every mutating command, nil if AOFPath is not configured
+	aof *appendOnlyFile
+
+	// channels hold subscribers of every pub/sub channel
+	channels map[string]map[*Client]bool
+
+	// events queue keyspace events until they are published to KeyspaceChannel,
+	// keyspaceSubscribers is number of subscribers of KeyspaceChannel read without lock
+	events              chan keyspaceEvent
+	keyspaceSubscribers int32
+
+	// quit is closed when server start shutting down, stopped is closed once serveClient loop returned
+	quit    chan struct{}
+	stopped chan struct{}
+
+	// ready is closed once server is listening and accepting clients
+	ready chan struct{}
+
+	// pool process messages of every client if Workers is set, workers stop once drained is closed by shutdown
+	pool    *workerPool
+	drained chan struct{}
+
+	// databases are logical databases selected by SELECT, database 0 is commander
+	databases []Commander
+
+	// replicas hold queue of commands streamed to every client which sent SYNC
+	replicas map[*Client]*replica
+
+	// replicaStop is closed to stop replicating from primary, nil if server is a primary
+	replicaStop chan struct{}
+
+	// transaction is held for reading by every command and for writing by EXEC, so queued commands run at once
+	transaction sync.RWMutex
+
+	// replication is held for reading by every mutating command and for writing while a replica is registered
+	replication sync.RWMutex
+
+	// credentials hold salted hash of Auth and password of every user
+	credentials map[string]credential
+
+	// verifications bound number of passwords hashed at once, so AUTH can't take every CPU
+	verifications chan struct{}
+
+	// processing track every running processMessage, so shutdown can wait until all replies are written
+	processing sync.WaitGroup
 	sync.RWMutex
 }
 
 // NewServer function, Server's constructor
+// if args.Logger is nil, default logger is used, if args.Protocol is empty kece protocol is used
 func NewServer(args *Arguments, commander Commander) *Server {
+	logger := args.Logger
+	if logger == nil {
+		logger = newLogger(os.Stdout, args.LogLevel, !args.NoColor)
+	}
+
 	clients := make(map[*Client]bool)
 	register := make(chan *Client)
 	unregister := make(chan *Client)
-	publish := make(chan []byte)
-	clientMessage := make(chan *ClientMessage)
 	done := make(chan bool, 1)
-	return &Server{
+
+	var pool *workerPool
+	if args.Workers > 0 {
+		pool = newWorkerPool(args.Workers)
+	}
+
+	maxCommandSize := args.MaxCommandSize
+	if maxCommandSize <= 0 {
+		maxCommandSize = DefaultMaxCommandSize
+	}
+
+	slowLogMaxLen := args.SlowLogMaxLen
+	if slowLogMaxLen <= 0 {
+		slowLogMaxLen = DefaultSlowLogMaxLen
+	}
+	server := &Server{
 		args:          args,
 		clients:       clients,
 		register:      register,
 		unregister:    unregister,
-		publish:       publish,
-		clientMessage: clientMessage,
 		commander:     commander,
+		logger:        logger,
+		protocol:      newProtocol(args.Protocol, args.LengthPrefixed, maxCommandSize),
 		done:          done,
+		channels:      make(map[string]map[*Client]bool),
+		events:        make(chan keyspaceEvent, keyspaceEventsBuffer),
+		quit:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		ready:         make(chan struct{}),
+		databases:     newDatabases(commander, args.Databases),
+		replicas:      make(map[*Client]*replica),
+		credentials:   newCredentials(args),
+		verifications: make(chan struct{}, runtime.NumCPU()),
+		metrics:       newMetrics(),
+		slowLog:       newSlowLog(slowLogMaxLen),
+		pool:          pool,
+		drained:       make(chan struct{}),
 	}
+	server.hookExpired()
+	return server
 }
 
-//addClient function will push new client to the map clients
-func (server *Server) addClient(key *Client, b bool) {
+//addClient function will push new client to the map clients, return false if MaxClients is reached
+func (server *Server) addClient(key *Client, b bool) bool {
 	server.Lock()
-	printYellowColor(fmt.Sprintf("log -> new client connected %s\n", key.ID))
+	defer server.Unlock()
+
+	if server.args.MaxClients > 0 && len(server.clients) >= server.args.MaxClients {
+		return false
+	}
+
+	server.logger.Info("new client connected %s", key.ID)
 	server.clients[key] = b
-	server.Unlock()
+	server.metrics.connected(1)
+	return true
+}
+
+// rejectClient function will notify client that server reach MaxClients then close its connection
+func (server *Server) rejectClient(client *Client) {
+	server.logger.Warn("max clients reached, rejecting client %s", client.ID)
+
+	if _, err := client.Conn.Write([]byte(ErrorMaxClients)); err != nil {
+		server.logger.Error("Failed to notify client %s. Err: %v", client.ID, err)
+	}
+
+	if err := client.Conn.Close(); err != nil {
+		server.logger.Error("Error when closing the client. Err: %v", err)
+	}
+}
+
+// clientList will return a line per connected client, sorted by ID so the listing is stable
+func (server *Server) clientList() [][]byte {
+	server.RLock()
+	list := make([]string, 0, len(server.clients))
+	for client := range server.clients {
+		authenticated := 0
+		if client.IsAuthenticated() {
+			authenticated = 1
+		}
+
+		age := int64(time.Since(client.ConnectedAt).Seconds())
+		list = append(list, fmt.Sprintf("id=%s authenticated=%d age=%d user=%s", client.ID, authenticated, age, client.User()))
+	}
+	server.RUnlock()
+
+	sort.Strings(list)
+	lines := make([][]byte, 0, len(list))
+	for _, line := range list {
+		lines = append(lines, []byte(line))
+	}
+	return lines
+}
+
+// hasClient will check client is still registered
+func (server *Server) hasClient(client *Client) bool {
+	server.RLock()
+	defer server.RUnlock()
+
+	_, ok := server.clients[client]
+	return ok
+}
+
+// findClient will return connected client by ID, nil is returned if there is no such client
+func (server *Server) findClient(id string) *Client {
+	server.RLock()
+	defer server.RUnlock()
+	for client := range server.clients {
+		if client.ID == id {
+			return client
+		}
+	}
+	return nil
 }
 
-//deleteClient function will delete client by specific key from map clients
+//deleteClient function will delete client by specific key from map clients and every channel it subscribed
 func (server *Server) deleteClient(key *Client) {
 	server.Lock()
-	delete(server.clients, key)
+	if _, ok := server.clients[key]; ok {
+		delete(server.clients, key)
+		server.metrics.connected(-1)
+	}
+	if r, ok := server.replicas[key]; ok {
+		delete(server.replicas, key)
+		close(r.queue)
+	}
+	for channel, subscribers := range server.channels {
+		delete(subscribers, key)
+		if len(subscribers) == 0 {
+			delete(server.channels, channel)
+		}
+	}
+	server.countKeyspaceSubscribers()
 	server.Unlock()
 }
 
+// subscribe function will add client to subscribers of channel
+func (server *Server) subscribe(client *Client, channel string) {
+	server.Lock()
+	defer server.Unlock()
+
+	subscribers, ok := server.channels[channel]
+	if !ok {
+		subscribers = make(map[*Client]bool)
+		server.channels[channel] = subscribers
+	}
+	subscribers[client] = true
+	server.countKeyspaceSubscribers()
+}
+
+// unsubscribe function will remove client from subscribers of channel and return the number of channels client still subscribed
+func (server *Server) unsubscribe(client *Client, channel string) int {
+	server.Lock()
+	defer server.Unlock()
+
+	if subscribers, ok := server.channels[channel]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(server.channels, channel)
+		}
+	}
+	server.countKeyspaceSubscribers()
+
+	remaining := 0
+	for _, subscribers := range server.channels {
+		if subscribers[client] {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// publish function will write message to every subscriber of channel and return the number of subscribers
+func (server *Server) publish(channel string, message []byte) int {
+	server.RLock()
+	subscribers := make([]*Client, 0, len(server.channels[channel]))
+	for client := range server.channels[channel] {
+		subscribers = append(subscribers, client)
+	}
+	server.RUnlock()
+
+	payload := server.protocol.Message(channel, message)
+	for _, client := range subscribers {
+		if err := server.write(client, payload); err != nil {
+			server.logger.Error("Failed to publish message to %s. Err: %v", client.ID, err)
+		}
+	}
+	return len(subscribers)
+}
+
+// enqueue will push message to client queue and track it as processing, false is returned once server is shutting down
+func (server *Server) enqueue(queue chan<- *ClientMessage, cm *ClientMessage) bool {
+	// quit is closed under write lock, so no message is tracked after shutdown start waiting processing
+	server.RLock()
+	select {
+	case <-server.quit:
+		server.RUnlock()
+		return false
+	default:
+	}
+	server.processing.Add(1)
+	cm.Client.pending.Add(1)
+	server.RUnlock()
+
+	select {
+	case queue <- cm:
+		return true
+	case <-server.quit:
+		cm.Client.pending.Done()
+		server.processing.Done()
+		return false
+	}
+}
+
+// processQueued will process message taken from queue of client
+func (server *Server) processQueued(cm *ClientMessage) {
+	server.processMessage(cm)
+	cm.Client.pending.Done()
+	server.processing.Done()
+}
+
+// clientQueue will return queue of messages of client and function which wait until every queued message is processed.
+// Without worker pool, every client has its own goroutine processing its queue
+func (server *Server) clientQueue(client *Client) (chan<- *ClientMessage, func()) {
+	if server.pool != nil {
+		return server.pool.assign(), func() {
+			processed := make(chan struct{})
+			go func() {
+				client.pending.Wait()
+				close(processed)
+			}()
+
+			// workers drop queued messages once server is drained
+			select {
+			case <-processed:
+			case <-server.drained:
+			}
+		}
+	}
+
+	queue := make(chan *ClientMessage, clientQueueSize)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for cm := range queue {
+			server.processQueued(cm)
+		}
+	}()
+
+	return queue, func() {
+		close(queue)
+		<-drained
+	}
+}
+
+// unregisterClient will send client to unregister channel, unless server is already shutting down
+func (server *Server) unregisterClient(client *Client) {
+	select {
+	case server.unregister <- client:
+	case <-server.quit:
+	}
+}
+
+// handleClient will read messages of client until it disconnect, messages are processed one by one in the order they are sent
+// so pipelined replies are never reordered, while different clients still run concurrently.
+// client is unregistered exactly once when the connection is closed
+func (server *Server) handleClient(client *Client) {
+	queue, wait := server.clientQueue(client)
+	defer func() {
+		// wait queued messages, so their replies are written before connection is closed
+		wait()
+
+		err := client.Close()
+		if err != nil {
+			server.logger.Error("Error when closing the client. Err: %v", err)
+		}
+		server.unregisterClient(client)
+	}()
+
+	// reader must live as long as the connection, otherwise bytes buffered after the first line are lost
+	reader := bufio.NewReader(client.Conn)
+	for {
+		// zero IdleTimeout means client can stay idle forever
+		idleTimeout, _, _ := server.timeouts()
+		if idleTimeout > 0 {
+			if err := client.setIdleDeadline(time.Now().Add(idleTimeout)); err != nil {
+				server.logger.Error("Failed to set read deadline of client %s. Err: %v", client.ID, err)
+			}
+		}
+
+		message, err := server.protocol.ReadMessage(reader)
+		if err != nil {
+			if client.HasQuit() {
+				server.logger.Info("client %s quit", client.ID)
+			} else if client.IsClosed() {
+				server.logger.Info("client %s is disconnected by server", client.ID)
+			} else if err.Error() == ErrorInvalidProtocol || err.Error() == ErrorCommandTooLarge {
+				reply := err.Error()
+				server.logger.Warn("client %s send %s, closing its connection", client.ID, strings.ToLower(strings.Trim(reply, "-"+crlf)))
+				if _, err := client.Conn.Write([]byte(reply)); err != nil {
+					server.logger.Error("Failed to write response. Err: %v", err)
+				}
+			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				server.logger.Info("client %s is idle more than %v, closing its connection", client.ID, idleTimeout)
+			} else if err != io.EOF {
+				server.logger.Warn("Failed to read message from client %s. Err: %v", client.ID, err)
+			}
+			return
+		}
+
+		server.logger.Debug("Received message : %s from %s", bytes.TrimSpace(message), client.ID)
+		if !server.enqueue(queue, &ClientMessage{Client: client, Message: message}) {
+			return
+		}
+	}
+}
+
 func (server *Server) serveClient() {
+	defer close(server.stopped)
 
 	for {
 		select {
 		case client := <-server.register:
 			// register client to client collection
-			server.addClient(client, true)
+			if !server.addClient(client, true) {
+				go server.rejectClient(client)
+				continue
+			}
 
 			// handle message from client
-			go func() {
-				defer func() {
-					err := client.Conn.Close()
-					if err != nil {
-						log.Printf("Error when closing the client. Err: %v", err)
-					}
-					server.unregister <- client
-				}()
-
-				for {
-					message, err := bufio.NewReader(client.Conn).ReadBytes('\n')
-					if err != nil {
-						server.unregister <- client
-						break
-					}
-
-					server.clientMessage <- &ClientMessage{Client: client, Message: message}
-				}
-			}()
+			go server.handleClient(client)
 		case client := <-server.unregister:
-			if _, ok := server.clients[client]; ok {
-				printRedColor(fmt.Sprintf("client %s unregister its connection\n", client.ID))
+			if server.hasClient(client) {
+				server.logger.Info("client %s unregister its connection", client.ID)
 				server.deleteClient(client)
 			}
-		case clientMessage := <-server.clientMessage:
-			printCyanColor(fmt.Sprintf("Received message : %s from %s\n", string(clientMessage.Message), clientMessage.Client.ID))
-
-			go processMessage(clientMessage, server.commander, server.args.Auth)
+		case <-server.quit:
+			return
 		}
 	}
 
@@ -106,198 +462,1698 @@ func (server *Server) serveClient() {
 
 // Start function, start Kece server
 func (server *Server) Start() error {
-	listener, err := net.Listen(server.args.Network, fmt.Sprintf(":%s", server.args.Port))
+	if err := server.restore(); err != nil {
+		return err
+	}
+
+	if err := server.openAppendOnly(); err != nil {
+		return err
+	}
+
+	if err := server.serveMetrics(); err != nil {
+		return err
+	}
+
+	listener, err := server.listen()
 	if err != nil {
 		return err
 	}
 
-	printGreenColor(Banner)
-	printYellowColor(fmt.Sprintf("log -> kece server listen on port : %s\n", server.args.Port))
+	server.Lock()
+	server.listener = listener
+	server.startTime = time.Now()
+	server.Unlock()
 
-	defer func() {
-		err := listener.Close()
-		if err != nil {
-			log.Printf("Failed to close listener. Err: %v", err)
-		}
-	}()
+	server.logger.Info(Banner)
+	if server.args.Network == NetworkUnix {
+		// socket file is removed once listener is closed
+		server.logger.Info("kece server listen on socket : %s", server.args.SocketPath)
+	} else {
+		server.logger.Info("kece server listen on port : %s", server.args.Port)
+	}
 
 	kill := make(chan os.Signal, 1)
 
 	// notify when user interrupt the process
 	signal.Notify(kill, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(kill)
 
 	// handle concurrent client
 	go server.serveClient()
 
+	if server.pool != nil {
+		server.pool.run(server, server.drained)
+	}
+
 	go server.waitOSNotify(kill)
 
+	// copy keyspace from primary and apply its writes
+	if len(server.args.ReplicaOf) > 0 {
+		server.replicaOf(server.args.ReplicaOf)
+	}
+
+	// delete expired keys periodically
+	go server.sweepExpired()
+
+	// publish keyspace events to their subscribers
+	go server.publishKeyspace()
+
+	// write keyspace to disk periodically
+	go server.snapshotPeriodically()
+
+	// flush append only file every second
+	go server.syncAppendOnlyPeriodically()
+
 	// handle concurrent incoming client
-	go func() {
-		for {
-			c, err := listener.Accept()
-			if err != nil {
-				fmt.Println("server stopped")
-				return
-			}
+	go server.accept(listener)
 
-			//register to every connected client to DB
-			server.register <- &Client{ID: c.RemoteAddr().String(), Conn: c}
-		}
-	}()
+	close(server.ready)
 
 	<-server.done
 
+	server.shutdown(listener)
 	return nil
 
 }
 
-func (server *Server) waitOSNotify(kill chan os.Signal) {
+// accept will register every incoming connection until listener is closed.
+// Temporary error like too many open files is retried with backoff instead of stopping the server
+func (server *Server) accept(listener net.Listener) {
+	var backoff time.Duration
 	for {
+		c, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if backoff == 0 {
+					backoff = 5 * time.Millisecond
+				} else {
+					backoff *= 2
+				}
+
+				if backoff > time.Second {
+					backoff = time.Second
+				}
+
+				server.logger.Error("Error when accepting connection, retrying in %v. Err: %v", backoff, err)
+				select {
+				case <-time.After(backoff):
+					continue
+				case <-server.quit:
+					return
+				}
+			}
+
+			server.logger.Info("server stopped")
+			return
+		}
+		backoff = 0
+
+		if !server.allowedAddr(c.RemoteAddr()) {
+			server.logger.Warn("connection from %s is denied", c.RemoteAddr())
+			if err := c.Close(); err != nil {
+				server.logger.Error("Error when closing the client. Err: %v", err)
+			}
+			continue
+		}
+
+		//register to every connected client to DB
 		select {
-		case <-kill:
-			fmt.Println("server daemon interrupted")
-			server.done <- true
+		case server.register <- &Client{ID: server.clientID(c), Conn: c, ConnectedAt: time.Now()}:
+		case <-server.quit:
+			if err := c.Close(); err != nil {
+				server.logger.Error("Error when closing the client. Err: %v", err)
+			}
 			return
 		}
 	}
 }
 
-func validateAuth(cm *ClientMessage, commander Commander, auth string) error {
+// listen will create listener of server, connection is encrypted using TLS if both TLSCertFile and TLSKeyFile are set
+func (server *Server) listen() (net.Listener, error) {
+	// empty Host bind every interface
+	address := net.JoinHostPort(server.args.Host, server.args.Port)
+	if server.args.Network == NetworkUnix {
+		address = server.args.SocketPath
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
 
-	clientID := cm.Client.ID
+	if len(server.args.TLSCertFile) <= 0 || len(server.args.TLSKeyFile) <= 0 {
+		return net.Listen(server.args.Network, address)
+	}
 
-	result, err := commander.Get([]byte(commands["GET"]), []byte(clientID))
+	cert, err := tls.LoadX509KeyPair(server.args.TLSCertFile, server.args.TLSKeyFile)
 	if err != nil {
-		return errors.New(ErrorInvalidAuth)
+		return nil, err
 	}
 
-	if !bytes.Equal([]byte(auth), result.Value) {
-		return errors.New(ErrorInvalidAuth)
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	return tls.Listen(server.args.Network, address, config)
+}
+
+// removeStaleSocket will remove socket file left by server which is not shut down cleanly,
+// a file which is not a socket is kept so listen fail instead of deleting user data
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
 	}
 
-	return nil
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	return os.Remove(path)
 }
 
-func writeMessage(cm *ClientMessage, message []byte) {
-	_, err := cm.Client.Conn.Write(message)
-	if err != nil {
-		log.Printf("Failed to write response. Err: %v", err)
+// clientID will return remote address of connection, unix socket clients share the same empty address
+// so they are numbered instead
+func (server *Server) clientID(conn net.Conn) string {
+	if server.args.Network != NetworkUnix {
+		return conn.RemoteAddr().String()
+	}
+	return fmt.Sprintf("unix:%d", atomic.AddUint64(&server.connections, 1))
+}
+
+// Ready return channel which is closed once server is listening and accepting clients,
+// so caller can dial Addr without polling. It is never closed if Start fail before listening =>
+//
+//	go server.Start()
+//	select {
+//	case <-server.Ready():
+//		conn, err := net.Dial(server.Addr().Network(), server.Addr().String())
+//	case <-time.After(time.Second):
+//		// server failed to start
+//	}
+func (server *Server) Ready() <-chan struct{} {
+	return server.ready
+}
+
+// Stop function, stop Kece server with the same draining logic as SIGTERM and unblock Start.
+// Stop is safe to be called multiple times and from any goroutine
+func (server *Server) Stop() {
+	server.stopOnce.Do(func() {
+		server.done <- true
+	})
+}
+
+// Addr function, return address of the listener, nil if server is not listening yet
+func (server *Server) Addr() net.Addr {
+	server.RLock()
+	defer server.RUnlock()
+
+	if server.listener == nil {
+		return nil
 	}
+	return server.listener.Addr()
 }
 
-func processExpired(ctx context.Context, cm *ClientMessage, commander Commander) {
-	c, cancel := context.WithTimeout(ctx, cm.Exp)
-	defer cancel()
+// shutdown will stop accepting new client, wait until running processMessage finished (bounded by ShutdownTimeout),
+// then notify and close every connected client
+func (server *Server) shutdown(listener net.Listener) {
+	err := listener.Close()
+	if err != nil {
+		server.logger.Error("Failed to close listener. Err: %v", err)
+	}
+
+	server.Lock()
+	close(server.quit)
+	server.Unlock()
+	<-server.stopped
+
+	timeout := server.args.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		server.processing.Wait()
+		close(finished)
+	}()
 
 	select {
-	case <-c.Done():
-		err := commander.Delete([]byte("DEL"), cm.Key)
+	case <-finished:
+	case <-time.After(timeout):
+		server.logger.Warn("Shutdown timeout after %v, some messages are not processed", timeout)
+	}
+	close(server.drained)
+
+	// take the last snapshot after every running message is finished
+	if len(server.args.SnapshotPath) > 0 {
+		if err := server.saveSnapshot(); err != nil {
+			server.logger.Error("Failed to save snapshot. Err: %v", err)
+		}
+	}
+
+	if server.aof != nil {
+		if err := server.aof.Close(); err != nil {
+			server.logger.Error("Failed to close append only file. Err: %v", err)
+		}
+	}
+
+	if server.metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := server.metricsServer.Shutdown(ctx); err != nil {
+			server.logger.Error("Failed to shutdown metrics server. Err: %v", err)
+		}
+		cancel()
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	for client := range server.clients {
+		_, err := client.Conn.Write([]byte(ReplyShutdown))
 		if err != nil {
-			log.Printf("Failed to delete value. Err: %v", err)
+			server.logger.Error("Failed to notify client %s. Err: %v", client.ID, err)
 		}
-	default:
+
+		if err := client.Close(); err != nil {
+			server.logger.Error("Error when closing the client. Err: %v", err)
+		}
+		delete(server.clients, client)
 	}
 }
 
-func processMessage(cm *ClientMessage, commander Commander, auth string) {
+// sweepExpired will delete expired keys every SweepInterval,
+// so expiration doesn't need a goroutine for each key
+func (server *Server) sweepExpired() {
+	interval := server.args.SweepInterval
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
-		if err := cm.ValidateMessage(); err != nil {
-			writeMessage(cm, []byte(err.Error()))
+		select {
+		case <-ticker.C:
+			server.deleteExpired()
+		case <-server.quit:
 			return
 		}
+	}
+}
 
-		cmd := cm.Cmd
-		key := cm.Key
-
-		switch string(cmd) {
-		case commands["AUTH"]:
-			value := cm.Key
-			value = bytes.Trim(value, crlf)
-			if len(auth) <= 0 {
-				reply := replies["ERROR"]
-				writeMessage(cm, []byte(reply))
-				return
-			}
+// deleteExpired will delete expired keys of every database, their expired events are published by hookExpired
+func (server *Server) deleteExpired() {
+	for _, db := range server.databases {
+		db.DeleteExpired()
+	}
+}
 
-			if !bytes.Equal([]byte(auth), value) {
-				writeMessage(cm, []byte(ErrorInvalidAuth))
-				return
-			}
+// saveSnapshot will write the whole keyspace to SnapshotPath
+func (server *Server) saveSnapshot() error {
+	server.snapshotLock.Lock()
+	defer server.snapshotLock.Unlock()
 
-			key = []byte(cm.Client.ID)
+	entries, err := server.snapshot()
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(server.args.SnapshotPath, entries)
+}
 
-			err := commander.Auth(cmd, key, value)
-			if err != nil {
-				reply := replies["ERROR"]
-				writeMessage(cm, []byte(reply))
-				return
-			}
+// snapshot will return keys of every database, entry DB is the index of its database
+func (server *Server) snapshot() ([]SnapshotEntry, error) {
+	var entries []SnapshotEntry
+	for i, db := range server.databases {
+		dbEntries, err := db.Snapshot()
+		if err != nil {
+			return nil, err
+		}
 
+		for _, entry := range dbEntries {
+			entry.DB = i
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// database return database selected by client
+func (server *Server) database(client *Client) Commander {
+	return server.databases[client.Database()]
+}
+
+// size return number of keys of every database
+func (server *Server) size(ctx context.Context) (int, error) {
+	total := 0
+	for _, db := range server.databases {
+		size, err := db.Size(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// evictions return number of keys evicted from every database
+func (server *Server) evictions() int64 {
+	var total int64
+	for _, db := range server.databases {
+		total += db.Evictions()
+	}
+	return total
+}
+
+// loadSnapshot will load keyspace from SnapshotPath if it is configured
+func (server *Server) loadSnapshot() error {
+	if len(server.args.SnapshotPath) <= 0 {
+		return nil
+	}
+
+	entries, err := readSnapshot(server.args.SnapshotPath)
+	if err != nil {
+		return err
+	}
+
+	server.logger.Info("load %d keys from snapshot %s", len(entries), server.args.SnapshotPath)
+
+	// entries of database which is not configured anymore are dropped
+	byDatabase := make([][]SnapshotEntry, len(server.databases))
+	for _, entry := range entries {
+		if entry.DB < 0 || entry.DB >= len(server.databases) {
+			server.logger.Warn("drop key %s of database %d from snapshot, only %d databases are configured", entry.Key, entry.DB, len(server.databases))
+			continue
+		}
+		byDatabase[entry.DB] = append(byDatabase[entry.DB], entry)
+	}
+
+	for i, dbEntries := range byDatabase {
+		if err := server.databases[i].Load(dbEntries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore will rebuild keyspace on start. Append only file is preferred because it is more complete than snapshot
+func (server *Server) restore() error {
+	if len(server.args.AOFPath) <= 0 {
+		return server.loadSnapshot()
+	}
+
+	lines, err := readAppendOnlyFile(server.args.AOFPath)
+	if err != nil {
+		return err
+	}
+
+	// replay through the same dispatch as clients, replies are discarded
+	client := discardClient("aof")
+	defer client.Conn.Close()
+
+	// consecutive SET and MSET without lifetime are applied as a single batch,
+	// the batch is flushed before any other command so the order of writes is kept
+	var batch []KeyValue
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := batchSet(context.Background(), server.database(client), batch); err != nil {
+			server.logger.Error("Failed to replay batch of %d writes. Err: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for _, line := range lines {
+		cm := &ClientMessage{Message: line}
+		if err := cm.ValidateMessage(); err == nil {
+			if string(cm.Cmd) == commands["SET"] && cm.Exp == 0 {
+				batch = append(batch, KeyValue{Key: cm.Key, Value: cm.Value})
+				continue
+			}
+
+			if string(cm.Cmd) == commands["MSET"] {
+				batch = append(batch, cm.Pairs...)
+				continue
+			}
+		}
+
+		flush()
+		server.processMessage(&ClientMessage{Client: client, Message: line})
+	}
+	flush()
+
+	server.logger.Info("replay %d commands from append only file %s", len(lines), server.args.AOFPath)
+	return nil
+}
+
+// discardClient will return authenticated client whose replies are discarded, it is used to apply commands
+// no one wait the reply of. Its connection must be closed once it is no longer used
+func discardClient(id string) *Client {
+	serverConn, replayConn := net.Pipe()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, replayConn)
+	}()
+	return &Client{ID: id, Conn: serverConn, Authenticated: true, replay: true}
+}
+
+// openAppendOnly will open append only file if it is configured, it must be called after restore
+// so replayed commands are not logged again
+func (server *Server) openAppendOnly() error {
+	if len(server.args.AOFPath) <= 0 {
+		return nil
+	}
+
+	aof, err := openAppendOnlyFile(server.args.AOFPath, server.args.AOFFsync)
+	if err != nil {
+		return err
+	}
+	// database of the last command in file is unknown, so the first command is preceded by SELECT
+	if len(server.databases) > 1 {
+		aof.db = -1
+	}
+
+	server.aof = aof
+	return nil
+}
+
+// syncAppendOnlyPeriodically will fsync append only file every second if the policy is everysec
+func (server *Server) syncAppendOnlyPeriodically() {
+	if server.aof == nil || server.aof.fsync != AOFFsyncEverySec {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := server.aof.Sync(); err != nil {
+				server.logger.Error("Failed to sync append only file. Err: %v", err)
+			}
+		case <-server.quit:
+			return
+		}
+	}
+}
+
+// snapshotPeriodically will write snapshot every SnapshotInterval, it does nothing if snapshot is not configured
+func (server *Server) snapshotPeriodically() {
+	if len(server.args.SnapshotPath) <= 0 || server.args.SnapshotInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(server.args.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := server.saveSnapshot(); err != nil {
+				server.logger.Error("Failed to save snapshot. Err: %v", err)
+			}
+		case <-server.quit:
+			return
+		}
+	}
+}
+
+func (server *Server) waitOSNotify(kill chan os.Signal) {
+	select {
+	case <-kill:
+		server.logger.Info("server daemon interrupted")
+		server.Stop()
+	case <-server.quit:
+	}
+}
+
+// appendOnly will log successful mutating command to append only file if it is configured, stream it to replicas
+// and publish its keyspace events
+func (server *Server) appendOnly(cm *ClientMessage) {
+	if !writeCommands[string(cm.Cmd)] {
+		return
+	}
+
+	db := cm.Client.Database()
+	server.propagate(db, cm.Raw)
+	server.notifyCommand(db, cm)
+	if server.aof == nil {
+		return
+	}
+
+	// replicas apply commands right away, only the file is replayed after lifetime may have passed
+	for _, line := range durableLines(cm, time.Now()) {
+		if err := server.aof.Write(db, line); err != nil {
+			server.logger.Error("Failed to write append only file. Err: %v", err)
+			return
+		}
+	}
+}
+
+func (server *Server) writeMessage(cm *ClientMessage, message []byte) {
+	if _, err := server.buffered(cm.Client).Write(message); err != nil {
+		server.logger.Error("Failed to write response. Err: %v", err)
+	}
+}
+
+// replyWriter write buffered replies of client by server.write, so WriteTimeout is applied to every flush
+type replyWriter struct {
+	server *Server
+	client *Client
+}
+
+func (w replyWriter) Write(payload []byte) (int, error) {
+	if err := w.server.write(w.client, payload); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// buffered will return writer of replies of client, it is created by the first reply.
+// Only the goroutine processing messages of client writes to it, other writers like publish write to connection directly
+func (server *Server) buffered(client *Client) *bufio.Writer {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.writer == nil {
+		client.writer = bufio.NewWriter(replyWriter{server: server, client: client})
+	}
+	return client.writer
+}
+
+// flush will write every buffered reply of client to its connection
+func (server *Server) flush(client *Client) {
+	if err := server.buffered(client).Flush(); err != nil {
+		server.logger.Error("Failed to write response. Err: %v", err)
+	}
+}
+
+// write will write payload to client. If WriteTimeout is set, client which doesn't read within it is disconnected,
+// then its connection handler unregister it
+func (server *Server) write(client *Client, payload []byte) error {
+	_, writeTimeout, _ := server.timeouts()
+	if writeTimeout > 0 {
+		if err := client.Conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+			server.logger.Error("Failed to set write deadline of client %s. Err: %v", client.ID, err)
+		}
+	}
+
+	_, err := client.Conn.Write(payload)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		server.logger.Warn("client %s doesn't read within %v, closing its connection", client.ID, writeTimeout)
+		if err := client.Close(); err != nil {
+			server.logger.Error("Error when closing the client. Err: %v", err)
+		}
+	}
+	return err
+}
+
+// writeBulk will write value encoded by server protocol
+func (server *Server) writeBulk(cm *ClientMessage, value []byte) {
+	server.writeMessage(cm, server.protocol.Bulk(value))
+}
+
+// writeInteger will write number encoded by server protocol
+func (server *Server) writeInteger(cm *ClientMessage, n int64) {
+	server.writeMessage(cm, server.protocol.Integer(n))
+}
+
+// writeError will write ErrorWrongType if key hold value of other type, other errors of commander are written as ERROR
+func (server *Server) writeError(cm *ClientMessage, err error) {
+	reply := replies["ERROR"]
+	if err.Error() == ErrorWrongType {
+		reply = ErrorWrongType
+	}
+	server.writeMessage(cm, []byte(reply))
+}
+
+// writeArray will write values encoded by server protocol
+func (server *Server) writeArray(cm *ClientMessage, values [][]byte) {
+	server.writeMessage(cm, server.protocol.Array(values))
+}
+
+// commandContext will return context of a single command, it is done once CommandTimeout is exceeded
+func (server *Server) commandContext() (context.Context, context.CancelFunc) {
+	_, _, commandTimeout := server.timeouts()
+	if commandTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), commandTimeout)
+}
+
+// logSlow will log command whose processing exceeds SlowLogThreshold and keep it for SLOWLOG
+func (server *Server) logSlow(cm *ClientMessage, start time.Time) {
+	elapsed := time.Since(start)
+	if server.args.SlowLogThreshold <= 0 || elapsed < server.args.SlowLogThreshold || len(cm.Cmd) == 0 {
+		return
+	}
+
+	// argument of AUTH is a password
+	var key string
+	if string(cm.Cmd) != commands["AUTH"] {
+		key = string(cm.Key)
+	}
+
+	server.logger.Warn("slow command %s %s of client %s took %v", cm.Cmd, key, cm.Client.ID, elapsed)
+	server.slowLog.add(slowLogEntry{start: start, duration: elapsed, client: cm.Client.ID, command: string(cm.Cmd), key: key})
+}
+
+func (server *Server) processMessage(cm *ClientMessage) {
+	start := time.Now()
+	ctx, cancel := server.commandContext()
+	defer func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			server.logger.Warn("command of client %s is not done within command timeout", cm.Client.ID)
+		}
+		cancel()
+		server.logSlow(cm, start)
+
+		// every reply of command is written at once
+		server.flush(cm.Client)
+	}()
+
+	for {
+		// commands pipelined after QUIT are dropped, connection is already closed
+		if cm.Client.HasQuit() {
+			return
+		}
+
+		// command run by EXEC is already validated when it is queued
+		if !cm.queued {
+			// writes of append only file and primary are already validated once
+			if !cm.Client.replay {
+				cm.keyValidator = server.args.KeyValidator
+			}
+
+			if err := cm.ValidateMessage(); err != nil {
+				server.writeMessage(cm, []byte(err.Error()))
+				return
+			}
+		}
+
+		cmd := cm.Cmd
+		key := cm.Key
+		commander := server.database(cm.Client)
+
+		// read only server still apply writes of its primary and append only file
+		if server.args.ReadOnly && writeCommands[string(cmd)] && !cm.Client.replay {
+			server.writeMessage(cm, []byte(ErrorReadOnly))
+			return
+		}
+
+		// once auth is configured, client must send valid AUTH before any other command
+		if server.authRequired() && !publicCommands[string(cmd)] && !cm.Client.IsAuthenticated() {
+			server.writeMessage(cm, []byte(ErrorInvalidAuth))
+			return
+		}
+
+		if !server.permitted(cm.Client.User(), string(cmd)) {
+			server.writeMessage(cm, []byte(ErrorNoPermission))
+			return
+		}
+
+		if !cm.queued {
+			server.metrics.command(string(cmd))
+		}
+
+		// commands of transaction are queued until EXEC
+		if cm.Client.InTransaction() && !transactionCommands[string(cmd)] {
+			cm.queued = true
+			cm.Client.QueueCommand(cm)
+
+			reply := replies["QUEUED"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		}
+
+		// command run by EXEC is already covered by its write lock
+		if string(cmd) != commands["EXEC"] && !cm.queued {
+			server.transaction.RLock()
+			defer server.transaction.RUnlock()
+		}
+
+		// replica registered by SYNC wait running writes, so none of them is missing from keyspace it receives
+		if writeCommands[string(cmd)] {
+			server.replication.RLock()
+			defer server.replication.RUnlock()
+		}
+
+		switch string(cmd) {
+		case commands["AUTH"]:
+			if !server.authRequired() {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			// AUTH password or AUTH username password
+			var username string
+			password := string(bytes.Trim(cm.Args[len(cm.Args)-1], crlf))
+			if len(cm.Args) > 1 {
+				username = string(cm.Args[0])
+			}
+
+			// unknown user and wrong password get the same reply, so users can't be enumerated
+			user, ok := server.authenticate(username, password)
+			if !ok {
+				server.writeMessage(cm, []byte(ErrorInvalidAuth))
+
+				// every AUTH costs hashing password, so client guessing passwords is disconnected
+				if cm.Client.FailAuth() >= maxAuthFailures {
+					server.logger.Info("client %s is disconnected after %d failed AUTH", cm.Client.ID, maxAuthFailures)
+					server.flush(cm.Client)
+					cm.Client.Quit()
+				}
+				return
+			}
+
+			cm.Client.Authenticate(user)
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["SET"]:
+			value := cm.Value
+			_, err := commander.Set(ctx, cmd, key, value, cm.Exp)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["SETEX"], commands["PSETEX"]:
+			lifetime, err := strconv.Atoi(string(cm.Args[1]))
+			if err != nil || lifetime <= 0 {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			unit := time.Second
+			if string(cmd) == commands["PSETEX"] {
+				unit = time.Millisecond
+			}
+
+			exp, ok := lifetimeDuration(int64(lifetime), unit)
+			if !ok {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			if _, err := commander.Set(ctx, cmd, key, cm.Value, exp); err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["MSET"]:
+			if err := batchSet(ctx, commander, cm.Pairs); err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["GET"]:
+			result, err := commander.Get(ctx, cmd, key)
+			if err != nil && err.Error() == ErrorEmptyValue {
+				server.writeMessage(cm, server.protocol.Nil())
+				return
+			}
+
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			// stored empty value is never written as nil
+			value := result.Value
+			if value == nil {
+				value = []byte{}
+			}
+			server.writeBulk(cm, value)
+			return
+		case commands["DEL"]:
+			deleted, err := commander.DeleteMany(ctx, cm.Args)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			if len(deleted) > 0 {
+				cm.deleted = deleted
+				server.appendOnly(cm)
+			}
+			server.writeInteger(cm, int64(len(deleted)))
+			return
+		case commands["TOUCH"]:
+			touched, err := commander.Touch(ctx, cm.Args)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeInteger(cm, int64(touched))
+			return
+		case commands["EXISTS"]:
+			exist, err := commander.Exists(ctx, cmd, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if exist {
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["MGET"]:
+			// missing key is written as nil, so client can align the values with requested keys
+			values := make([][]byte, 0, len(cm.Args))
+			for _, k := range cm.Args {
+				var value []byte
+				result, err := commander.Get(ctx, cmd, k)
+				if err == nil {
+					value = result.Value
+				}
+				values = append(values, value)
+			}
+
+			// missing key and timed out key can't be told apart, so the whole reply is an error
+			if ctx.Err() != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+			server.writeArray(cm, values)
+			return
+		case commands["TTL"]:
+			ttl, err := commander.TTL(ctx, cmd, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeInteger(cm, ttl)
+			return
+		case commands["PTTL"]:
+			ttl, err := commander.PTTL(ctx, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeInteger(cm, ttl)
+			return
+		case commands["EXPIRE"], commands["PEXPIRE"]:
+			unit := time.Second
+			expire := commander.Expire
+			if string(cmd) == commands["PEXPIRE"] {
+				unit = time.Millisecond
+				expire = commander.PExpire
+			}
+
+			lifetime, err := strconv.Atoi(string(cm.Args[1]))
+			if _, ok := lifetimeDuration(int64(lifetime), unit); err != nil || !ok {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			ok, err := expire(ctx, key, lifetime)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["PEXPIREAT"]:
+			deadline, err := strconv.ParseInt(string(cm.Args[1]), 10, 64)
+			if err != nil {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			ok, err := commander.PExpireAt(ctx, key, deadline)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["PERSIST"]:
+			ok, err := commander.Persist(ctx, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["INCR"], commands["DECR"]:
+			delta := int64(1)
+			if string(cmd) == commands["DECR"] {
+				delta = -1
+			}
+
+			result, err := commander.Incr(ctx, key, delta)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, result)
+			return
+		case commands["INCRBY"], commands["DECRBY"]:
+			delta, err := strconv.ParseInt(string(cm.Args[1]), 10, 64)
+			if err != nil {
+				server.writeMessage(cm, []byte(ErrorNotInteger))
+				return
+			}
+
+			if string(cmd) == commands["DECRBY"] {
+				if delta == math.MinInt64 {
+					server.writeMessage(cm, []byte(ErrorNotInteger))
+					return
+				}
+				delta = -delta
+			}
+
+			result, err := commander.Incr(ctx, key, delta)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, result)
+			return
+		case commands["APPEND"]:
+			length, err := commander.Append(ctx, key, cm.Value)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, int64(length))
+			return
+		case commands["STRLEN"]:
+			length, err := commander.Strlen(ctx, key)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.writeInteger(cm, int64(length))
+			return
+		case commands["GETRANGE"]:
+			start, errStart := strconv.Atoi(string(cm.Args[1]))
+			end, errEnd := strconv.Atoi(string(cm.Args[2]))
+			if errStart != nil || errEnd != nil {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			value, err := commander.GetRange(ctx, key, start, end)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.writeBulk(cm, value)
+			return
+		case commands["SETRANGE"]:
+			offset, err := strconv.Atoi(string(cm.Args[1]))
+			if err != nil || offset < 0 {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			length, err := commander.SetRange(ctx, key, offset, cm.Value)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, int64(length))
+			return
+		case commands["GETSET"]:
+			oldValue, err := commander.GetSet(ctx, key, cm.Value)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeBulk(cm, oldValue)
+			return
+		case commands["SETNX"]:
+			ok, err := commander.SetNX(ctx, key, cm.Value)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["RENAME"]:
+			if err := commander.Rename(ctx, key, cm.Args[1]); err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
 			reply := replies["OK"]
-			writeMessage(cm, []byte(reply))
+			server.writeMessage(cm, []byte(reply))
 			return
-		case commands["SET"]:
-			if len(auth) > 0 {
-				if err := validateAuth(cm, commander, auth); err != nil {
-					writeMessage(cm, []byte(err.Error()))
+		case commands["DUMP"]:
+			blob, err := commander.Dump(ctx, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeBulk(cm, blob)
+			return
+		case commands["RESTORE"]:
+			seconds, err := strconv.Atoi(string(cm.Args[1]))
+			ttl, ok := lifetimeDuration(int64(seconds), time.Second)
+			if err != nil || !ok || seconds < 0 {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			replace := len(cm.Args) > 3
+			if err := commander.Restore(ctx, key, cm.Args[2], ttl, replace); err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["RENAMENX"]:
+			ok, err := commander.RenameNX(ctx, key, cm.Args[1])
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["COPY"]:
+			ok, err := commander.Copy(ctx, key, cm.Args[1], len(cm.Args) > 2)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if ok {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["TYPE"]:
+			dataType, err := commander.Type(ctx, key)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeMessage(cm, []byte("+"+dataType+crlf))
+			return
+		case commands["LPUSH"], commands["RPUSH"]:
+			length, err := commander.Push(ctx, key, cm.Args[1:], string(cmd) == commands["LPUSH"])
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, int64(length))
+			return
+		case commands["LPOP"], commands["RPOP"]:
+			value, err := commander.Pop(ctx, key, string(cmd) == commands["LPOP"])
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			// empty list is written as empty reply
+			if value != nil {
+				server.appendOnly(cm)
+			}
+			server.writeBulk(cm, value)
+			return
+		case commands["LRANGE"]:
+			start, errStart := strconv.Atoi(string(cm.Args[1]))
+			stop, errStop := strconv.Atoi(string(cm.Args[2]))
+			if errStart != nil || errStop != nil {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			elements, err := commander.LRange(ctx, key, start, stop)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.writeArray(cm, elements)
+			return
+		case commands["LLEN"]:
+			length, err := commander.LLen(ctx, key)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.writeInteger(cm, int64(length))
+			return
+		case commands["HSET"]:
+			added, err := commander.HSet(ctx, key, cm.Args[1], cm.Value)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.appendOnly(cm)
+			server.writeInteger(cm, int64(added))
+			return
+		case commands["HGET"]:
+			value, err := commander.HGet(ctx, key, cm.Args[1])
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			// missing field is written as empty reply
+			server.writeBulk(cm, value)
+			return
+		case commands["HDEL"]:
+			deleted, err := commander.HDel(ctx, key, cm.Args[1])
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			if deleted > 0 {
+				server.appendOnly(cm)
+			}
+			server.writeInteger(cm, int64(deleted))
+			return
+		case commands["HGETALL"]:
+			pairs, err := commander.HGetAll(ctx, key)
+			if err != nil {
+				server.writeError(cm, err)
+				return
+			}
+
+			server.writeArray(cm, pairs)
+			return
+		case commands["KEYS"]:
+			keys, err := commander.Keys(ctx, string(key))
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeArray(cm, keys)
+			return
+		case commands["SCAN"]:
+			cursor, err := strconv.ParseUint(string(key), 10, 64)
+			if err != nil {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			// SCAN cursor [MATCH pattern] [COUNT n]
+			pattern, count := "*", defaultScanCount
+			for i := 1; i+1 < len(cm.Args); i += 2 {
+				switch strings.ToUpper(string(cm.Args[i])) {
+				case "MATCH":
+					pattern = string(cm.Args[i+1])
+				case "COUNT":
+					count, err = strconv.Atoi(string(cm.Args[i+1]))
+					if err != nil || count <= 0 {
+						server.writeMessage(cm, []byte(ErrorInvalidArgument))
+						return
+					}
+				default:
+					server.writeMessage(cm, []byte(ErrorInvalidArgument))
 					return
 				}
 			}
 
-			value := cm.Value
-			_, err := commander.Set(cmd, key, value)
+			next, keys, err := commander.Scan(ctx, cursor, pattern, count)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeMessage(cm, server.protocol.Cursor(next, keys))
+			return
+		case commands["DBSIZE"]:
+			size, err := commander.Size(ctx)
+			if err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeInteger(cm, int64(size))
+			return
+		case commands["RANDOMKEY"]:
+			key, err := commander.RandomKey(ctx)
 			if err != nil {
 				reply := replies["ERROR"]
-				writeMessage(cm, []byte(reply))
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			// empty db get empty reply
+			server.writeBulk(cm, key)
+			return
+		case commands["FLUSHALL"]:
+			// every database is flushed, not only the selected one
+			for _, db := range server.databases {
+				if err := db.Flush(ctx); err != nil {
+					reply := replies["ERROR"]
+					server.writeMessage(cm, []byte(reply))
+					return
+				}
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["SAVE"]:
+			if len(server.args.SnapshotPath) <= 0 {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
 				return
 			}
 
-			if cm.Exp != 0 {
-				go processExpired(context.Background(), cm, commander)
+			if err := server.saveSnapshot(); err != nil {
+				server.logger.Error("Failed to save snapshot. Err: %v", err)
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
 			}
 
 			reply := replies["OK"]
-			writeMessage(cm, []byte(reply))
+			server.writeMessage(cm, []byte(reply))
 			return
-		case commands["GET"]:
-			if len(auth) > 0 {
-				if err := validateAuth(cm, commander, auth); err != nil {
-					writeMessage(cm, []byte(err.Error()))
+		case commands["PING"]:
+			if len(cm.Args) == 0 {
+				reply := replies["PONG"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.writeBulk(cm, cm.Value)
+			return
+		case commands["ECHO"]:
+			server.writeBulk(cm, cm.Value)
+			return
+		case commands["CLIENT"]:
+			if strings.ToUpper(string(key)) == "LIST" {
+				server.writeArray(cm, server.clientList())
+				return
+			}
+
+			target := server.findClient(string(cm.Args[1]))
+			if target == nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			// reply is flushed before closing, so a client can kill itself
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			if target == cm.Client {
+				server.flush(cm.Client)
+			}
+
+			// connection handler of target is unblocked by the closed connection, then it unregister target
+			if err := target.Close(); err != nil {
+				server.logger.Error("Error when closing the client. Err: %v", err)
+			}
+			return
+		case commands["CONFIG"]:
+			if strings.ToUpper(string(key)) == "GET" {
+				server.writeArray(cm, server.configGet(string(cm.Args[1])))
+				return
+			}
+
+			if err := server.configSet(string(cm.Args[1]), string(cm.Value)); err != nil {
+				server.writeMessage(cm, []byte(err.Error()))
+				return
+			}
+
+			server.logger.Info("client %s set %s", cm.Client.ID, cm.Args[1])
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["DEBUG"]:
+			if !server.args.DebugEnabled {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			if strings.ToUpper(string(key)) == "OBJECT" {
+				info, err := commander.Inspect(cm.Args[1])
+				if err != nil {
+					reply := replies["ERROR"]
+					server.writeMessage(cm, []byte(reply))
 					return
 				}
+
+				server.writeBulk(cm, objectLine(info))
+				return
+			}
+
+			seconds, err := strconv.ParseFloat(string(cm.Args[1]), 64)
+			if err != nil || seconds < 0 {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			// sleep is still bounded by command timeout
+			select {
+			case <-time.After(time.Duration(seconds * float64(time.Second))):
+			case <-ctx.Done():
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
 			}
 
-			result, err := commander.Get(cmd, key)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["OBJECT"]:
+			// inspecting key doesn't count as access, so idle time is not reset
+			info, err := commander.Inspect(cm.Args[1])
 			if err != nil {
 				reply := replies["ERROR"]
-				writeMessage(cm, []byte(reply))
+				server.writeMessage(cm, []byte(reply))
 				return
 			}
 
-			reply := result.Value
-			writeMessage(cm, reply)
-			writeMessage(cm, []byte(crlf))
+			if strings.ToUpper(string(key)) == "FREQ" {
+				server.writeInteger(cm, info.Hits)
+				return
+			}
+
+			var idle int64
+			if !info.Accessed.IsZero() {
+				idle = int64(time.Since(info.Accessed).Seconds())
+			}
+			server.writeInteger(cm, idle)
+			return
+		case commands["SLOWLOG"]:
+			count := 10
+			if len(cm.Args) > 1 {
+				n, err := strconv.Atoi(string(cm.Args[1]))
+				if err != nil || n < 0 {
+					reply := replies["ERROR"]
+					server.writeMessage(cm, []byte(reply))
+					return
+				}
+				count = n
+			}
+
+			server.writeArray(cm, server.slowLog.get(count))
 			return
-		case commands["DEL"]:
-			if len(auth) > 0 {
-				if err := validateAuth(cm, commander, auth); err != nil {
-					writeMessage(cm, []byte(err.Error()))
+		case commands["INFO"]:
+			server.writeBulk(cm, server.info(ctx))
+			return
+		case commands["COMMAND"]:
+			if len(cm.Args) > 0 {
+				server.writeInteger(cm, int64(len(commands)))
+				return
+			}
+
+			// names are sorted, so the listing is stable
+			names := make([]string, 0, len(commands))
+			for _, name := range commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			values := make([][]byte, 0, len(names))
+			for _, name := range names {
+				values = append(values, []byte(name))
+			}
+			server.writeArray(cm, values)
+			return
+		case commands["REPLICAOF"]:
+			// REPLICAOF NO ONE promote server to primary
+			addr := ""
+			if strings.ToUpper(string(key)) != "NO" || strings.ToUpper(string(cm.Args[1])) != "ONE" {
+				if _, err := strconv.ParseUint(string(cm.Args[1]), 10, 16); err != nil {
+					server.writeMessage(cm, []byte(ErrorInvalidArgument))
 					return
 				}
+				addr = net.JoinHostPort(string(key), string(cm.Args[1]))
+			}
+
+			server.replicaOf(addr)
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["SELECT"]:
+			index, err := strconv.Atoi(string(key))
+			if err != nil || index < 0 || index >= len(server.databases) {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
+			}
+
+			cm.Client.Select(index)
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["MOVE"]:
+			index, err := strconv.Atoi(string(cm.Args[1]))
+			if err != nil || index < 0 || index >= len(server.databases) {
+				server.writeMessage(cm, []byte(ErrorInvalidArgument))
+				return
 			}
 
-			err := commander.Delete(cmd, key)
+			moved, err := moveKey(ctx, commander, server.databases[index], key)
 			if err != nil {
 				reply := replies["ERROR"]
-				writeMessage(cm, []byte(reply))
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := int64(0)
+			if moved {
+				server.appendOnly(cm)
+				reply = 1
+			}
+			server.writeInteger(cm, reply)
+			return
+		case commands["SWAPDB"]:
+			first, errFirst := strconv.Atoi(string(key))
+			second, errSecond := strconv.Atoi(string(cm.Args[1]))
+			if errFirst != nil || errSecond != nil || first < 0 || first >= len(server.databases) ||
+				second < 0 || second >= len(server.databases) {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			if err := swapDatabases(ctx, server.databases[first], server.databases[second]); err != nil {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			server.appendOnly(cm)
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["MULTI"]:
+			if !cm.Client.BeginTransaction() {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["WATCH"]:
+			// keys must be watched before transaction is started
+			if cm.Client.InTransaction() {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			for _, watchedKey := range cm.Args {
+				version, err := keyVersion(ctx, commander, watchedKey)
+				if err != nil {
+					reply := replies["ERROR"]
+					server.writeMessage(cm, []byte(reply))
+					return
+				}
+				cm.Client.Watch(cm.Client.Database(), watchedKey, version)
+			}
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["DISCARD"]:
+			cm.Client.Unwatch()
+			if _, ok := cm.Client.EndTransaction(); !ok {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["EXEC"]:
+			watched := cm.Client.Unwatch()
+			queued, ok := cm.Client.EndTransaction()
+			if !ok {
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+				return
+			}
+
+			// no other command run until every queued command is done, replies are written as a single array
+			server.transaction.Lock()
+			defer server.transaction.Unlock()
+
+			// transaction is aborted without running any queued command once a watched key is changed,
+			// it is replied as nil so it is distinct from empty transaction
+			for _, w := range watched {
+				version, err := keyVersion(ctx, server.databases[w.db], w.key)
+				if err != nil || version != w.version {
+					server.writeMessage(cm, server.protocol.Nil())
+					return
+				}
+			}
+
+			// kece protocol has no array header, so empty transaction is replied as empty array
+			if len(queued) == 0 {
+				server.writeArray(cm, nil)
 				return
 			}
 
+			if header := server.protocol.ArrayLength(len(queued)); len(header) > 0 {
+				server.writeMessage(cm, header)
+			}
+
+			for _, queuedMessage := range queued {
+				server.processMessage(queuedMessage)
+			}
+			return
+		case commands["SYNC"]:
+			if err := server.syncReplica(cm.Client); err != nil {
+				server.logger.Error("Failed to sync replica %s. Err: %v", cm.Client.ID, err)
+				reply := replies["ERROR"]
+				server.writeMessage(cm, []byte(reply))
+			}
+			return
+		case commands["SUBSCRIBE"]:
+			server.subscribe(cm.Client, string(key))
+
 			reply := replies["OK"]
-			writeMessage(cm, []byte(reply))
+			server.writeMessage(cm, []byte(reply))
+			return
+		case commands["UNSUBSCRIBE"]:
+			remaining := server.unsubscribe(cm.Client, string(key))
+
+			server.writeInteger(cm, int64(remaining))
+			return
+		case commands["QUIT"]:
+			// reply is flushed before closing, then connection handler unregister client
+			reply := replies["OK"]
+			server.writeMessage(cm, []byte(reply))
+			server.flush(cm.Client)
+
+			if err := cm.Client.Quit(); err != nil {
+				server.logger.Error("Error when closing the client. Err: %v", err)
+			}
+			return
+		case commands["PUBLISH"]:
+			receivers := server.publish(string(key), cm.Value)
+
+			server.writeInteger(cm, int64(receivers))
 			return
 		default:
-			writeMessage(cm, []byte(ErrorInvalidCommand))
+			server.writeMessage(cm, []byte(errorUnknownCommand(string(cmd)).Error()))
 			return
 		}
 	}
@@ -0,0 +1,2441 @@
+package kece
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should process all commands sent in a single write", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{}, cmd)
+		go server.serveClient()
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		server.register <- &Client{ID: "001", Conn: serverConn}
+
+		go func() {
+			_, err := clientConn.Write([]byte("SET a 1\r\nSET b 2\r\n"))
+			if err != nil {
+				t.Errorf("error write message %s", err.Error())
+			}
+		}()
+
+		reader := bufio.NewReader(clientConn)
+		for i := 0; i < 2; i++ {
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+
+			if reply != replies["OK"] {
+				t.Errorf("reply should be OK, got %q", reply)
+			}
+		}
+
+		for _, key := range []string{"a", "b"} {
+			if _, err := cmd.Get(ctx, []byte("GET"), []byte(key)); err != nil {
+				t.Errorf("key %s should be stored", key)
+			}
+		}
+	})
+
+	t.Run("should keep goroutine bounded when setting many keys with lifetime", func(t *testing.T) {
+		ds := newStructureMock()
+		cmd := NewCommander(ds)
+		server := NewServer(&Arguments{SweepInterval: 100 * time.Millisecond}, cmd)
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, clientConn)
+		}()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		before := runtime.NumGoroutine()
+
+		for i := 0; i < 1000; i++ {
+			message := []byte(fmt.Sprintf("SET key-%d value 1\r\n", i))
+			server.processMessage(&ClientMessage{Client: client, Message: message})
+		}
+
+		if after := runtime.NumGoroutine(); after > before+10 {
+			t.Errorf("goroutine should be bounded, before %d after %d", before, after)
+		}
+
+		go server.sweepExpired()
+		time.Sleep(1500 * time.Millisecond)
+
+		cmd.(*commander).lock.Lock()
+		remaining := len(ds.(*dataStructureMock).db)
+		cmd.(*commander).lock.Unlock()
+
+		if remaining != 0 {
+			t.Errorf("expired keys should be deleted by sweeper, %d keys remaining", remaining)
+		}
+	})
+
+	t.Run("should authenticate client once per session", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, cmd)
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET 1 wuriyanto", reply: ErrorInvalidAuth},
+			{message: "AUTH wrong-secret", reply: ErrorInvalidAuth},
+			{message: "SET 1 wuriyanto", reply: ErrorInvalidAuth},
+			{message: "AUTH my-secret", reply: replies["OK"]},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "GET 1", reply: "wuriyanto" + crlf},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+
+		if _, err := cmd.Get(ctx, []byte("GET"), []byte(client.ID)); err == nil {
+			t.Error("credential should not be stored in db")
+		}
+	})
+
+	t.Run("should reply PING and ECHO without auth", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "PING", reply: replies["PONG"]},
+			{message: "PING are you there", reply: "are you there" + crlf},
+			{message: "ECHO  hello   kece  ", reply: "hello   kece" + crlf},
+			{message: "GET 1", reply: ErrorInvalidAuth},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should list supported commands", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		done := make(chan bool)
+		go func() {
+			server.processMessage(&ClientMessage{Client: client, Message: []byte("COMMAND")})
+			done <- true
+		}()
+
+		listed := make(map[string]bool)
+		for i := 0; i < len(commands); i++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+			listed[strings.TrimSpace(line)] = true
+		}
+		<-done
+
+		for _, name := range []string{"SET", "GET", "DEL", "AUTH"} {
+			if !listed[name] {
+				t.Errorf("%s should be listed", name)
+			}
+		}
+
+		reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("COMMAND COUNT")})
+		if reply != strconv.Itoa(len(commands))+crlf {
+			t.Errorf("reply of COMMAND COUNT should be %d, got %q", len(commands), reply)
+		}
+	})
+
+	t.Run("should serve list as work queue", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "RPUSH jobs job:1 job:2", reply: "2" + crlf},
+			{message: "LPUSH jobs job:0", reply: "3" + crlf},
+			{message: "LRANGE jobs 1 -2", reply: "job:1" + crlf},
+			{message: "LPOP jobs", reply: "job:0" + crlf},
+			{message: "RPOP jobs", reply: "job:2" + crlf},
+			{message: "LPOP jobs", reply: "job:1" + crlf},
+			{message: "LPOP jobs", reply: crlf},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "LPUSH 1 job:0", reply: ErrorWrongType},
+			{message: "RPUSH queue job:1", reply: "1" + crlf},
+			{message: "GET queue", reply: ErrorWrongType},
+			{message: "INCR queue", reply: ErrorWrongType},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should serve hash as user profile", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: `HSET user:1 name "wuriyanto musthafa"`, reply: "1" + crlf},
+			{message: "HSET user:1 name wuriyanto", reply: "0" + crlf},
+			{message: "HGET user:1 name", reply: "wuriyanto" + crlf},
+			{message: "HGET user:1 city", reply: crlf},
+			{message: "HDEL user:1 name", reply: "1" + crlf},
+			{message: "HDEL user:1 name", reply: "0" + crlf},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "HGET 1 name", reply: ErrorWrongType},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should touch and delete multiple keys and count only present keys", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "SET 2 agung", reply: replies["OK"]},
+			{message: "RPUSH jobs a", reply: "1" + crlf},
+			{message: "TOUCH 1 missing 2", reply: "2" + crlf},
+			{message: "DEL 1 missing jobs 2 1", reply: "3" + crlf},
+			{message: "DEL 1", reply: "0" + crlf},
+			{message: "DBSIZE", reply: "0" + crlf},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should notify and close connected clients on shutdown", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{ShutdownTimeout: time.Second}, cmd)
+		go server.serveClient()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listen %s", err.Error())
+		}
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		server.register <- &Client{ID: "001", Conn: serverConn}
+
+		go server.shutdown(listener)
+
+		reader := bufio.NewReader(clientConn)
+		notice, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read notice %s", err.Error())
+		}
+
+		if notice != ReplyShutdown {
+			t.Errorf("notice should be %q, got %q", ReplyShutdown, notice)
+		}
+
+		if _, err := reader.ReadString('\n'); err != io.EOF {
+			t.Errorf("connection should be closed after notice, got %v", err)
+		}
+
+		if _, err := listener.Accept(); err == nil {
+			t.Error("listener should be closed")
+		}
+	})
+
+	t.Run("should return from Start after Stop is called", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", ShutdownTimeout: time.Second}, cmd)
+
+		started := make(chan error, 1)
+		go func() {
+			started <- server.Start()
+		}()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if _, err := conn.Write([]byte("SET 1 wuriyanto\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		server.Stop()
+		server.Stop()
+
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Errorf("Start should return nil, got %s", err.Error())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Start should return after Stop")
+		}
+	})
+
+	t.Run("should notify client connected over tcp before closing it on Stop", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", ShutdownTimeout: time.Second}, cmd)
+
+		started := make(chan error, 1)
+		go func() {
+			started <- server.Start()
+		}()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		// client is registered once its first message is replied
+		if reply, _ := reader.ReadString('\n'); reply != replies["PONG"] {
+			t.Errorf("reply should be PONG, got %q", reply)
+		}
+
+		server.Stop()
+
+		notice, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read notice %s", err.Error())
+		}
+
+		if notice != ReplyShutdown {
+			t.Errorf("notice should be %q, got %q", ReplyShutdown, notice)
+		}
+
+		if _, err := reader.ReadString('\n'); err != io.EOF {
+			t.Errorf("connection should be closed after notice, got %v", err)
+		}
+
+		select {
+		case <-started:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Start should return after Stop")
+		}
+	})
+
+	t.Run("should deliver published message to every subscriber", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		var subscribers []*bufio.Reader
+		for _, id := range []string{"001", "002"} {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+
+			client := &Client{ID: id, Conn: serverConn}
+			reader := bufio.NewReader(clientConn)
+
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SUBSCRIBE news")})
+			if reply != replies["OK"] {
+				t.Errorf("reply of SUBSCRIBE should be OK, got %q", reply)
+			}
+			subscribers = append(subscribers, reader)
+		}
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		publisher := &Client{ID: "003", Conn: serverConn}
+
+		received := make(chan string, len(subscribers))
+		for _, reader := range subscribers {
+			go func(reader *bufio.Reader) {
+				message, _ := reader.ReadString('\n')
+				received <- message
+			}(reader)
+		}
+
+		reply := processAndRead(t, server, bufio.NewReader(clientConn), &ClientMessage{Client: publisher, Message: []byte("PUBLISH news hello kece")})
+		if reply != "2"+crlf {
+			t.Errorf("reply of PUBLISH should be number of subscribers, got %q", reply)
+		}
+
+		for range subscribers {
+			if message := <-received; message != "MESSAGE news hello kece"+crlf {
+				t.Errorf("subscriber should receive message, got %q", message)
+			}
+		}
+
+		server.deleteClient(publisher)
+		if len(server.channels["news"]) != 2 {
+			t.Error("deleting non subscriber client should keep channel subscribers")
+		}
+	})
+
+	t.Run("should not deliver published message after UNSUBSCRIBE", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		subscriberConn, subscriberClientConn := net.Pipe()
+		defer subscriberClientConn.Close()
+		subscriber := &Client{ID: "001", Conn: subscriberConn}
+		subscriberReader := bufio.NewReader(subscriberClientConn)
+
+		publisherConn, publisherClientConn := net.Pipe()
+		defer publisherClientConn.Close()
+		publisher := &Client{ID: "002", Conn: publisherConn}
+		publisherReader := bufio.NewReader(publisherClientConn)
+
+		for _, channel := range []string{"news", "sport"} {
+			reply := processAndRead(t, server, subscriberReader, &ClientMessage{Client: subscriber, Message: []byte("SUBSCRIBE " + channel)})
+			if reply != replies["OK"] {
+				t.Errorf("reply of SUBSCRIBE should be OK, got %q", reply)
+			}
+		}
+
+		received := make(chan string, 1)
+		go func() {
+			message, _ := subscriberReader.ReadString('\n')
+			received <- message
+		}()
+
+		reply := processAndRead(t, server, publisherReader, &ClientMessage{Client: publisher, Message: []byte("PUBLISH news hello")})
+		if reply != "1"+crlf {
+			t.Errorf("reply of PUBLISH should be 1, got %q", reply)
+		}
+
+		if message := <-received; message != "MESSAGE news hello"+crlf {
+			t.Errorf("subscriber should receive message, got %q", message)
+		}
+
+		reply = processAndRead(t, server, subscriberReader, &ClientMessage{Client: subscriber, Message: []byte("UNSUBSCRIBE news")})
+		if reply != "1"+crlf {
+			t.Errorf("reply of UNSUBSCRIBE should be number of remaining channels, got %q", reply)
+		}
+
+		reply = processAndRead(t, server, publisherReader, &ClientMessage{Client: publisher, Message: []byte("PUBLISH news hello")})
+		if reply != "0"+crlf {
+			t.Errorf("reply of PUBLISH should be 0 after UNSUBSCRIBE, got %q", reply)
+		}
+	})
+
+	t.Run("should remove disconnected client from every channel", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+		go server.serveClient()
+
+		serverConn, clientConn := net.Pipe()
+		server.register <- &Client{ID: "001", Conn: serverConn}
+
+		if _, err := clientConn.Write([]byte("SUBSCRIBE news\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := bufio.NewReader(clientConn).ReadString('\n'); reply != replies["OK"] {
+			t.Errorf("reply of SUBSCRIBE should be OK, got %q", reply)
+		}
+		clientConn.Close()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			server.RLock()
+			subscribed := len(server.channels)
+			server.RUnlock()
+
+			if subscribed == 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("disconnected client should be removed from channels")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should add caller supplied amount with INCRBY and DECRBY", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "INCRBY score 10", reply: "10" + crlf},
+			{message: "INCRBY score -3", reply: "7" + crlf},
+			{message: "DECRBY score 20", reply: "-13" + crlf},
+			{message: "INCRBY score ten", reply: ErrorNotInteger},
+			{message: "DECRBY score -9223372036854775808", reply: ErrorNotInteger},
+			{message: "SET name wuriyanto", reply: replies["OK"]},
+			{message: "INCRBY name 1", reply: replies["ERROR"]},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should remove every key with FLUSHALL from authenticated client", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "FLUSHALL", reply: ErrorInvalidAuth},
+			{message: "AUTH my-secret", reply: replies["OK"]},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "SET 2 agung", reply: replies["OK"]},
+			{message: "SET 3 kece", reply: replies["OK"]},
+			{message: "DBSIZE", reply: "3" + crlf},
+			{message: "FLUSHALL", reply: replies["OK"]},
+			{message: "DBSIZE", reply: "0" + crlf},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+
+	t.Run("should evict client which idle more than IdleTimeout", func(t *testing.T) {
+		server := NewServer(&Arguments{IdleTimeout: 50 * time.Millisecond}, NewCommander(newStructureMock()))
+		go server.serveClient()
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		server.register <- &Client{ID: "001", Conn: serverConn}
+
+		if err := clientConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("error set read deadline %s", err.Error())
+		}
+
+		if _, err := bufio.NewReader(clientConn).ReadString('\n'); err != io.EOF {
+			t.Errorf("idle connection should be closed by server, got %v", err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			server.RLock()
+			connected := len(server.clients)
+			server.RUnlock()
+
+			if connected == 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("idle client should be unregistered")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should unregister client exactly once when it disconnect mid read", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		client := &Client{ID: "001", Conn: serverConn}
+
+		go server.handleClient(client)
+
+		// half written message, then connection is gone
+		if _, err := clientConn.Write([]byte("SET 1 wuri")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+		clientConn.Close()
+
+		select {
+		case unregistered := <-server.unregister:
+			if unregistered != client {
+				t.Error("unregistered client should be the disconnected client")
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("client should be unregistered")
+		}
+
+		select {
+		case <-server.unregister:
+			t.Error("client should not be unregistered twice")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("should reply pipelined messages in order", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("SET 1 wuriyanto\r\nGET 1\r\nDEL 1\r\nEXISTS 1\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		reader := bufio.NewReader(conn)
+		for _, expected := range []string{replies["OK"], "wuriyanto" + crlf, "1" + crlf, "0" + crlf} {
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+
+			if reply != expected {
+				t.Errorf("reply should be %q, got %q", expected, reply)
+			}
+		}
+	})
+
+	t.Run("should refuse connection when MaxClients is reached", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", MaxClients: 2}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		for i := 0; i < 2; i++ {
+			conn := dialServer(t, server)
+			defer conn.Close()
+
+			if _, err := conn.Write([]byte("DBSIZE\r\n")); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := bufio.NewReader(conn).ReadString('\n'); reply != "0"+crlf {
+				t.Errorf("client %d should be served, got %q", i, reply)
+			}
+		}
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if reply, _ := reader.ReadString('\n'); reply != ErrorMaxClients {
+			t.Errorf("third client should be refused, got %q", reply)
+		}
+
+		if _, err := reader.ReadString('\n'); err != io.EOF {
+			t.Errorf("refused connection should be closed, got %v", err)
+		}
+	})
+
+	t.Run("should SET and GET over TLS connection", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kece-tls")
+		if err != nil {
+			t.Fatalf("error create temp dir %s", err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		certFile, keyFile, pool := writeSelfSignedCert(t, dir)
+
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", TLSCertFile: certFile, TLSKeyFile: keyFile}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		_, port, _ := net.SplitHostPort(waitServer(t, server).String())
+		tlsConn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", port), &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("error dial TLS server %s", err.Error())
+		}
+		defer tlsConn.Close()
+
+		reader := bufio.NewReader(tlsConn)
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET secure wuriyanto", reply: replies["OK"]},
+			{message: "GET secure", reply: "wuriyanto" + crlf},
+		}
+
+		for _, e := range expectations {
+			if _, err := tlsConn.Write([]byte(e.message + crlf)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := reader.ReadString('\n'); reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+	})
+}
+
+// writeSelfSignedCert will write self signed certificate for 127.0.0.1 to dir
+func writeSelfSignedCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generate key %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"kece"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error create certificate %s", err.Error())
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshal key %s", err.Error())
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatalf("error write certificate %s", err.Error())
+	}
+
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatalf("error write key %s", err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPem)
+	return certFile, keyFile, pool
+}
+
+// waitServer will wait until server is listening and return its address
+func waitServer(t *testing.T, server *Server) net.Addr {
+	select {
+	case <-server.Ready():
+	case <-time.After(3 * time.Second):
+		t.Fatal("server is not listening")
+	}
+	return server.Addr()
+}
+
+// dialServer will wait until server is listening then connect to it
+func dialServer(t *testing.T, server *Server) net.Conn {
+	addr := waitServer(t, server)
+
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatalf("error dial server %s", err.Error())
+	}
+	return conn
+}
+
+// processAndRead will process message and read a single line reply from the client side of connection
+func processAndRead(t *testing.T, server *Server, reader *bufio.Reader, cm *ClientMessage) string {
+	done := make(chan bool)
+	go func() {
+		server.processMessage(cm)
+		done <- true
+	}()
+
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error read reply %s", err.Error())
+	}
+
+	<-done
+	return reply
+}
+
+// readInfo will send INFO then read reply until the last section, it return value of field
+func readInfo(t *testing.T, conn net.Conn, reader *bufio.Reader, field string) string {
+	if _, err := conn.Write([]byte("INFO\r\n")); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	var value string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, field+":") {
+			value = strings.TrimPrefix(line, field+":")
+		}
+
+		// keyspace is the last section, its line is followed by empty line of bulk terminator
+		if strings.HasPrefix(line, "keys:") {
+			if _, err := reader.ReadString('\n'); err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+			return value
+		}
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	t.Run("should reflect active connections in connected clients", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		other := dialServer(t, server)
+		otherReader := bufio.NewReader(other)
+
+		// a reply means the connection is already registered
+		for _, c := range []struct {
+			conn   net.Conn
+			reader *bufio.Reader
+		}{{conn, reader}, {other, otherReader}} {
+			if _, err := c.conn.Write([]byte("PING\r\n")); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := c.reader.ReadString('\n'); reply != replies["PONG"] {
+				t.Fatalf("reply should be PONG, got %q", reply)
+			}
+		}
+
+		if clients := readInfo(t, conn, reader, "connected_clients"); clients != "2" {
+			t.Errorf("connected clients should be 2, got %q", clients)
+		}
+
+		other.Close()
+
+		// client is unregistered asynchronously once its connection is closed
+		deadline := time.Now().Add(3 * time.Second)
+		for readInfo(t, conn, reader, "connected_clients") != "1" {
+			if time.Now().After(deadline) {
+				t.Fatal("connected clients should be 1 after a client disconnect")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if total := readInfo(t, conn, reader, "total_commands_processed"); total == "" || total == "0" {
+			t.Errorf("total commands processed should be counted, got %q", total)
+		}
+	})
+}
+
+func TestServerClientList(t *testing.T) {
+	t.Run("should list every connected client", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Network: "tcp", Port: "0", Auth: "my-secret"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		other := dialServer(t, server)
+		defer other.Close()
+		otherReader := bufio.NewReader(other)
+
+		if _, err := conn.Write([]byte("CLIENT LIST\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != ErrorInvalidAuth {
+			t.Errorf("CLIENT LIST should require auth, got %q", reply)
+		}
+
+		// a reply means the connection is already registered
+		for _, c := range []struct {
+			conn   net.Conn
+			reader *bufio.Reader
+		}{{conn, reader}, {other, otherReader}} {
+			if _, err := c.conn.Write([]byte("AUTH my-secret\r\n")); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := c.reader.ReadString('\n'); reply != replies["OK"] {
+				t.Fatalf("reply should be OK, got %q", reply)
+			}
+		}
+
+		if _, err := conn.Write([]byte("CLIENT LIST\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		var lines []string
+		for i := 0; i < 2; i++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error read reply %s", err.Error())
+			}
+			lines = append(lines, line)
+		}
+
+		for _, c := range []net.Conn{conn, other} {
+			expected := fmt.Sprintf("id=%s authenticated=1 age=", c.LocalAddr())
+
+			found := false
+			for _, line := range lines {
+				found = found || strings.HasPrefix(line, expected)
+			}
+
+			if !found {
+				t.Errorf("client %s should be listed, got %q", c.LocalAddr(), lines)
+			}
+		}
+	})
+
+	t.Run("should list clients while other clients connect and disconnect", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		addr := waitServer(t, server)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					conn, err := net.Dial(addr.Network(), addr.String())
+					if err != nil {
+						t.Errorf("error dial server %s", err.Error())
+						return
+					}
+
+					// a reply means the connection is already registered
+					if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+						t.Errorf("error write message %s", err.Error())
+					}
+					bufio.NewReader(conn).ReadString('\n')
+					conn.Close()
+				}
+			}()
+		}
+
+		done := make(chan struct{})
+		var readers sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					server.clientList()
+					server.findClient("missing")
+					server.info(context.Background())
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(done)
+		readers.Wait()
+	})
+}
+
+func TestServerClientKill(t *testing.T) {
+	t.Run("should disconnect and unregister killed client", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		victim := dialServer(t, server)
+		defer victim.Close()
+		victimReader := bufio.NewReader(victim)
+
+		// a reply means the connection is already registered
+		if _, err := victim.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := victimReader.ReadString('\n'); reply != replies["PONG"] {
+			t.Fatalf("reply should be PONG, got %q", reply)
+		}
+
+		id := victim.LocalAddr().String()
+		if server.findClient(id) == nil {
+			t.Fatalf("client %s should be registered", id)
+		}
+
+		if _, err := conn.Write([]byte("CLIENT KILL 127.0.0.1:1\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["ERROR"] {
+			t.Errorf("killing unknown client should reply ERROR, got %q", reply)
+		}
+
+		if _, err := conn.Write([]byte("CLIENT KILL " + id + "\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		if _, err := victimReader.ReadString('\n'); err != io.EOF {
+			t.Errorf("connection of killed client should be closed, got %v", err)
+		}
+
+		// client is unregistered asynchronously by its connection handler
+		deadline := time.Now().Add(3 * time.Second)
+		for server.findClient(id) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("killed client should be removed from clients")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should reply OK to client killing itself", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		id := conn.LocalAddr().String()
+		if _, err := conn.Write([]byte("CLIENT KILL " + id + "\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, err := reader.ReadString('\n'); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q %v", reply, err)
+		}
+
+		if _, err := reader.ReadString('\n'); err != io.EOF {
+			t.Errorf("connection of killed client should be closed, got %v", err)
+		}
+
+		deadline := time.Now().Add(3 * time.Second)
+		for server.findClient(id) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("killed client should be removed from clients")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestServerQuit(t *testing.T) {
+	t.Run("should reply OK, close connection and unregister client", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		// a reply means the connection is already registered
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["PONG"] {
+			t.Fatalf("reply should be PONG, got %q", reply)
+		}
+
+		id := conn.LocalAddr().String()
+		if server.findClient(id) == nil {
+			t.Fatalf("client %s should be registered", id)
+		}
+
+		// PING pipelined after QUIT is dropped
+		if _, err := conn.Write([]byte("QUIT\r\nPING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := reader.ReadString('\n'); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		if reply, err := reader.ReadString('\n'); err != io.EOF {
+			t.Errorf("connection should be closed after QUIT, got %q %v", reply, err)
+		}
+
+		deadline := time.Now().Add(3 * time.Second)
+		for server.findClient(id) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("client should be removed from clients after QUIT")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// slowCommander delay every GET, it gives up once context of command is done
+type slowCommander struct {
+	Commander
+	delay time.Duration
+}
+
+func (c slowCommander) Get(ctx context.Context, command, key []byte) (*Schema, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(c.delay):
+		return c.Commander.Get(ctx, command, key)
+	}
+}
+
+func TestServerShutdownInFlight(t *testing.T) {
+	cmd := slowCommander{Commander: NewCommander(newStructureMock()), delay: 300 * time.Millisecond}
+	cmd.Set(context.Background(), []byte("SET"), []byte("1"), []byte("wuriyanto"), 0)
+
+	server := NewServer(&Arguments{Network: "tcp", Port: "0", ShutdownTimeout: 3 * time.Second}, cmd)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start()
+	}()
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("GET 1\r\n")); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	// GET is still waiting the slow commander when Stop is called
+	time.Sleep(50 * time.Millisecond)
+	server.Stop()
+
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"wuriyanto" + crlf, ReplyShutdown} {
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+
+		if reply != expected {
+			t.Errorf("reply should be %q, got %q", expected, reply)
+		}
+	}
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Start should return after Stop")
+	}
+}
+
+func TestServerCommandTimeout(t *testing.T) {
+	t.Run("should reply ERROR once command exceed CommandTimeout", func(t *testing.T) {
+		cmd := slowCommander{Commander: NewCommander(newStructureMock()), delay: time.Minute}
+		server := NewServer(&Arguments{CommandTimeout: 50 * time.Millisecond}, cmd)
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SET 1 wuriyanto")}); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		start := time.Now()
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("GET 1")}); reply != replies["ERROR"] {
+			t.Errorf("reply should be ERROR, got %q", reply)
+		}
+
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("GET should not wait the slow commander, it took %v", elapsed)
+		}
+	})
+
+	t.Run("should wait slow commander if CommandTimeout is not set", func(t *testing.T) {
+		cmd := slowCommander{Commander: NewCommander(newStructureMock()), delay: 50 * time.Millisecond}
+		server := NewServer(&Arguments{}, cmd)
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SET 1 wuriyanto")})
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("GET 1")}); reply != "wuriyanto"+crlf {
+			t.Errorf("reply should be wuriyanto, got %q", reply)
+		}
+	})
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	t.Run("should disconnect client which never read its replies", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0", WriteTimeout: 100 * time.Millisecond}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := bufio.NewReader(conn).ReadString('\n'); reply != replies["PONG"] {
+			t.Fatalf("reply should be PONG, got %q", reply)
+		}
+
+		// replies of big value fill socket buffers, client write may block too so it is done in background
+		go func() {
+			if _, err := conn.Write([]byte("SET big " + strings.Repeat("x", 1<<20) + "\r\n")); err != nil {
+				return
+			}
+
+			for i := 0; i < 64; i++ {
+				if _, err := conn.Write([]byte("GET big\r\n")); err != nil {
+					return
+				}
+			}
+		}()
+
+		id := conn.LocalAddr().String()
+		deadline := time.Now().Add(10 * time.Second)
+		for server.findClient(id) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("client which never read should be disconnected")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestServerHost(t *testing.T) {
+	t.Run("should bind only the configured interface", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		addr := waitServer(t, server)
+		if host, _, _ := net.SplitHostPort(addr.String()); host != "127.0.0.1" {
+			t.Errorf("server should listen on 127.0.0.1, got %s", addr)
+		}
+
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("error dial server %s", err.Error())
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := bufio.NewReader(conn).ReadString('\n'); reply != replies["PONG"] {
+			t.Errorf("reply should be PONG, got %q", reply)
+		}
+	})
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kece-unix")
+	if err != nil {
+		t.Fatalf("error create temp dir %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kece.sock")
+
+	t.Run("should serve SET and GET over unix socket", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: NetworkUnix, SocketPath: path, ShutdownTimeout: time.Second}, NewCommander(newStructureMock()))
+
+		started := make(chan error, 1)
+		go func() {
+			started <- server.Start()
+		}()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for _, e := range []struct {
+			message string
+			reply   string
+		}{
+			{message: "SET 1 wuriyanto\r\n", reply: replies["OK"]},
+			{message: "GET 1\r\n", reply: "wuriyanto" + crlf},
+		} {
+			if _, err := conn.Write([]byte(e.message)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			if reply, _ := reader.ReadString('\n'); reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+
+		server.Stop()
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Start should return after Stop")
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("socket file should be removed on shutdown")
+		}
+	})
+
+	t.Run("should replace stale socket file", func(t *testing.T) {
+		// listener which doesn't unlink its socket file on close leave it behind like a crashed server
+		listener, err := net.Listen(NetworkUnix, path)
+		if err != nil {
+			t.Fatalf("error listen %s", err.Error())
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+
+		server := NewServer(&Arguments{Network: NetworkUnix, SocketPath: path}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		conn.Close()
+	})
+}
+
+func TestServerReady(t *testing.T) {
+	t.Run("should close Ready once server is listening", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		select {
+		case <-server.Ready():
+		case <-time.After(3 * time.Second):
+			t.Fatal("Ready should be closed")
+		}
+
+		conn, err := net.Dial(server.Addr().Network(), server.Addr().String())
+		if err != nil {
+			t.Fatalf("error dial server %s", err.Error())
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		if reply, _ := bufio.NewReader(conn).ReadString('\n'); reply != replies["PONG"] {
+			t.Errorf("reply should be PONG, got %q", reply)
+		}
+	})
+
+	t.Run("should not close Ready if server fail to listen", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Port: "invalid"}, NewCommander(newStructureMock()))
+		if err := server.Start(); err == nil {
+			t.Fatal("Start should fail on invalid port")
+		}
+
+		select {
+		case <-server.Ready():
+			t.Error("Ready should not be closed")
+		default:
+		}
+	})
+}
+
+// temporaryError is returned by flakyListener, like EMFILE it is a temporary net.Error
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// flakyListener fail to accept the first failures times before accepting from conns
+type flakyListener struct {
+	net.Listener
+	failures int
+	conns    chan net.Conn
+	closed   chan struct{}
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errors.New("use of closed network connection")
+	}
+}
+
+func TestServerAcceptTemporaryError(t *testing.T) {
+	server := NewServer(&Arguments{Network: "tcp", Port: "0"}, NewCommander(newStructureMock()))
+
+	listener := &flakyListener{failures: 3, conns: make(chan net.Conn, 1), closed: make(chan struct{})}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	listener.conns <- serverConn
+
+	accepted := make(chan struct{})
+	go func() {
+		server.accept(listener)
+		close(accepted)
+	}()
+
+	select {
+	case client := <-server.register:
+		if client.Conn != serverConn {
+			t.Error("accepted connection should be registered")
+		}
+	case <-accepted:
+		t.Fatal("accept should keep running after temporary error")
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection should be accepted after temporary error")
+	}
+
+	close(listener.closed)
+	select {
+	case <-accepted:
+	case <-time.After(3 * time.Second):
+		t.Fatal("accept should return once listener is closed")
+	}
+}
+
+func TestServerReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	commander := NewCommander(newStructureMock())
+	commander.Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), 0)
+
+	server := NewServer(&Arguments{ReadOnly: true}, commander)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	for _, message := range []string{"SET 2 agung", "DEL 1", "EXPIRE 1 10", "INCR counter"} {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)}); reply != ErrorReadOnly {
+			t.Errorf("%s should be rejected, got %q", message, reply)
+		}
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("GET 1")}); reply != "wuriyanto"+crlf {
+		t.Errorf("GET should be served, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("EXISTS 1")}); reply == ErrorReadOnly {
+		t.Error("EXISTS should be served")
+	}
+
+	if exist, _ := commander.Exists(ctx, []byte("EXISTS"), []byte("2")); exist {
+		t.Error("rejected SET should not be applied")
+	}
+}
+
+func TestServerSelect(t *testing.T) {
+	server := NewServer(&Arguments{Databases: 2}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "SET 1 wuriyanto", reply: replies["OK"]},
+		{message: "SELECT 1", reply: replies["OK"]},
+		{message: "GET 1", reply: "(nil)" + crlf},
+		{message: "DBSIZE", reply: "0" + crlf},
+		{message: "SET 1 agung", reply: replies["OK"]},
+		{message: "SET 2 kece", reply: replies["OK"]},
+		{message: "DBSIZE", reply: "2" + crlf},
+		{message: "SELECT 2", reply: ErrorInvalidArgument},
+		{message: "SELECT -1", reply: ErrorInvalidArgument},
+		{message: "GET 1", reply: "agung" + crlf},
+		{message: "SELECT 0", reply: replies["OK"]},
+		{message: "GET 1", reply: "wuriyanto" + crlf},
+		{message: "EXISTS 2", reply: "0" + crlf},
+		{message: "DBSIZE", reply: "1" + crlf},
+		{message: "FLUSHALL", reply: replies["OK"]},
+		{message: "SELECT 1", reply: replies["OK"]},
+		{message: "DBSIZE", reply: "0" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerSwapDB(t *testing.T) {
+	ctx := context.Background()
+
+	server := NewServer(&Arguments{Databases: 3}, NewCommander(newStructureMock()))
+	server.databases[0].Set(ctx, []byte("SET"), []byte("color"), []byte("blue"), 0)
+	server.databases[0].Set(ctx, []byte("SET"), []byte("blue"), []byte("yes"), time.Hour)
+	server.databases[1].Set(ctx, []byte("SET"), []byte("color"), []byte("green"), 0)
+	server.databases[1].Push(ctx, []byte("green"), [][]byte{[]byte("yes")}, false)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SWAPDB 0 1")}); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "GET color", reply: "green" + crlf},
+		{message: "LLEN green", reply: "1" + crlf},
+		{message: "EXISTS blue", reply: "0" + crlf},
+		{message: "SELECT 1", reply: replies["OK"]},
+		{message: "GET color", reply: "blue" + crlf},
+		{message: "EXISTS green", reply: "0" + crlf},
+		{message: "TTL blue", reply: "3600" + crlf},
+		{message: "SWAPDB 0 3", reply: replies["ERROR"]},
+		{message: "SWAPDB -1 0", reply: replies["ERROR"]},
+		{message: "SWAPDB 1 1", reply: replies["OK"]},
+		{message: "DBSIZE", reply: "2" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+
+	if size, _ := server.databases[2].Size(ctx); size != 0 {
+		t.Errorf("database 2 should not be touched, got %d keys", size)
+	}
+}
+
+func TestServerMove(t *testing.T) {
+	ctx := context.Background()
+
+	server := NewServer(&Arguments{Databases: 2}, NewCommander(newStructureMock()))
+	server.databases[0].Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), time.Hour)
+	server.databases[0].Set(ctx, []byte("SET"), []byte("2"), []byte("agung"), 0)
+	server.databases[1].Set(ctx, []byte("SET"), []byte("2"), []byte("kece"), 0)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "MOVE 1 1", reply: "1" + crlf},
+		{message: "EXISTS 1", reply: "0" + crlf},
+		{message: "MOVE 2 1", reply: "0" + crlf},
+		{message: "MOVE missing 1", reply: "0" + crlf},
+		{message: "MOVE 2 0", reply: "0" + crlf},
+		{message: "MOVE 2 2", reply: ErrorInvalidArgument},
+		{message: "GET 2", reply: "agung" + crlf},
+		{message: "SELECT 1", reply: replies["OK"]},
+		{message: "GET 1", reply: "wuriyanto" + crlf},
+		{message: "TTL 1", reply: "3600" + crlf},
+		{message: "GET 2", reply: "kece" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerTransaction(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	otherConn, otherClientConn := net.Pipe()
+	defer otherClientConn.Close()
+
+	other := &Client{ID: "002", Conn: otherConn}
+	otherReader := bufio.NewReader(otherClientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "EXEC", reply: replies["ERROR"]},
+		{message: "DISCARD", reply: replies["ERROR"]},
+		{message: "MULTI", reply: replies["OK"]},
+		{message: "EXEC", reply: crlf},
+		{message: "MULTI", reply: replies["OK"]},
+		{message: "MULTI", reply: replies["ERROR"]},
+		{message: "SET 1 wuriyanto", reply: replies["QUEUED"]},
+		{message: "DISCARD", reply: replies["OK"]},
+		{message: "MULTI", reply: replies["OK"]},
+		{message: "SET 1 agung", reply: replies["QUEUED"]},
+		{message: "GET 1", reply: replies["QUEUED"]},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+
+	if reply := processAndRead(t, server, otherReader, &ClientMessage{Client: other, Message: []byte("GET 1")}); reply != "(nil)"+crlf {
+		t.Errorf("queued command should not run before EXEC, got %q", reply)
+	}
+
+	done := make(chan bool)
+	go func() {
+		server.processMessage(&ClientMessage{Client: client, Message: []byte("EXEC")})
+		done <- true
+	}()
+
+	for _, expected := range []string{replies["OK"], "agung" + crlf} {
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error read reply %s", err.Error())
+		}
+
+		if reply != expected {
+			t.Errorf("reply of EXEC should be %q, got %q", expected, reply)
+		}
+	}
+	<-done
+
+	if reply := processAndRead(t, server, otherReader, &ClientMessage{Client: other, Message: []byte("GET 1")}); reply != "agung"+crlf {
+		t.Errorf("key 1 should be set by EXEC, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("EXEC")}); reply != replies["ERROR"] {
+		t.Errorf("EXEC should end transaction, got %q", reply)
+	}
+
+	resp := NewServer(&Arguments{Protocol: ProtocolRESP}, NewCommander(newStructureMock()))
+	for _, e := range []struct {
+		message string
+		reply   string
+	}{
+		{message: "*1\r\n$5\r\nMULTI\r\n", reply: replies["OK"]},
+		{message: "*1\r\n$4\r\nEXEC\r\n", reply: "*0" + crlf},
+	} {
+		if reply := processAndRead(t, resp, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("RESP reply of %q should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerWatch(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	otherConn, otherClientConn := net.Pipe()
+	defer otherClientConn.Close()
+
+	other := &Client{ID: "002", Conn: otherConn}
+	otherReader := bufio.NewReader(otherClientConn)
+
+	expectations := []struct {
+		client  *Client
+		reader  *bufio.Reader
+		message string
+		reply   string
+	}{
+		{client: other, reader: otherReader, message: "SET 1 wuriyanto", reply: replies["OK"]},
+		{client: client, reader: reader, message: "WATCH 1", reply: replies["OK"]},
+		{client: other, reader: otherReader, message: "SET 1 agung", reply: replies["OK"]},
+		{client: client, reader: reader, message: "MULTI", reply: replies["OK"]},
+		{client: client, reader: reader, message: "WATCH 1", reply: replies["ERROR"]},
+		{client: client, reader: reader, message: "SET 1 kece", reply: replies["QUEUED"]},
+		{client: client, reader: reader, message: "EXEC", reply: "(nil)" + crlf},
+		{client: client, reader: reader, message: "GET 1", reply: "agung" + crlf},
+
+		// watched key which is not changed doesn't abort transaction
+		{client: client, reader: reader, message: "WATCH 1 2", reply: replies["OK"]},
+		{client: other, reader: otherReader, message: "GET 1", reply: "agung" + crlf},
+		{client: client, reader: reader, message: "MULTI", reply: replies["OK"]},
+		{client: client, reader: reader, message: "SET 1 kece", reply: replies["QUEUED"]},
+		{client: client, reader: reader, message: "EXEC", reply: replies["OK"]},
+		{client: client, reader: reader, message: "GET 1", reply: "kece" + crlf},
+
+		// missing key which is created then deleted again is changed
+		{client: client, reader: reader, message: "WATCH 2", reply: replies["OK"]},
+		{client: other, reader: otherReader, message: "SET 2 agung", reply: replies["OK"]},
+		{client: other, reader: otherReader, message: "DEL 2", reply: "1" + crlf},
+		{client: client, reader: reader, message: "MULTI", reply: replies["OK"]},
+		{client: client, reader: reader, message: "SET 1 wuriyanto", reply: replies["QUEUED"]},
+		{client: client, reader: reader, message: "EXEC", reply: "(nil)" + crlf},
+		{client: client, reader: reader, message: "GET 1", reply: "kece" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, e.reader, &ClientMessage{Client: e.client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerSetEx(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "SETEX 1 0 wuriyanto", reply: replies["ERROR"]},
+		{message: "SETEX 1 -1 wuriyanto", reply: replies["ERROR"]},
+		{message: "SETEX 1 one wuriyanto", reply: replies["ERROR"]},
+		{message: "SETEX 1 wuriyanto", reply: errorWrongArity("SETEX").Error()},
+		{message: "EXISTS 1", reply: "0" + crlf},
+		{message: "SETEX 1 1 wuriyanto musthafa", reply: replies["OK"]},
+		{message: "GET 1", reply: "wuriyanto musthafa" + crlf},
+		{message: "TTL 1", reply: "1" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("EXISTS 1")}); reply != "0"+crlf {
+		t.Errorf("key should be expired after its lifetime, got %q", reply)
+	}
+}
+
+func TestServerDebugSleep(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	t.Run("should error DEBUG if debug is not enabled", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG SLEEP 0")}); reply != replies["ERROR"] {
+			t.Errorf("reply should be ERROR, got %q", reply)
+		}
+	})
+
+	t.Run("should reply DEBUG SLEEP after the duration", func(t *testing.T) {
+		server := NewServer(&Arguments{DebugEnabled: true}, NewCommander(newStructureMock()))
+
+		start := time.Now()
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG SLEEP 0.2")}); reply != replies["OK"] {
+			t.Errorf("reply should be OK, got %q", reply)
+		}
+
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+			t.Errorf("reply should arrive after about 200ms, got %v", elapsed)
+		}
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG SLEEP -1")}); reply != replies["ERROR"] {
+			t.Errorf("reply of negative duration should be ERROR, got %q", reply)
+		}
+	})
+
+	t.Run("should error DEBUG SLEEP exceeding command timeout", func(t *testing.T) {
+		server := NewServer(&Arguments{DebugEnabled: true, CommandTimeout: 100 * time.Millisecond}, NewCommander(newStructureMock()))
+
+		start := time.Now()
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG SLEEP 5")}); reply != replies["ERROR"] {
+			t.Errorf("reply should be ERROR, got %q", reply)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("reply should arrive once command timeout is exceeded, got %v", elapsed)
+		}
+	})
+
+	t.Run("should require AUTH before DEBUG", func(t *testing.T) {
+		server := NewServer(&Arguments{HashIterations: testHashIterations, DebugEnabled: true, Auth: "my-secret"}, NewCommander(newStructureMock()))
+
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG SLEEP 0")}); reply != ErrorInvalidAuth {
+			t.Errorf("reply should be %q, got %q", ErrorInvalidAuth, reply)
+		}
+	})
+}
+
+func TestServerDebugObject(t *testing.T) {
+	server := NewServer(&Arguments{DebugEnabled: true}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SET 1 wuriyanto")}); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+
+	reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG OBJECT 1")})
+	if !strings.HasPrefix(reply, "type:string length:9 deadline:-1 accessed:") {
+		t.Errorf("reply should report string of length 9 without lifetime, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("DEBUG OBJECT 2")}); reply != replies["ERROR"] {
+		t.Errorf("reply of missing key should be ERROR, got %q", reply)
+	}
+}
+
+func TestServerMaxCommandSize(t *testing.T) {
+	server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", MaxCommandSize: 1024}, NewCommander(newStructureMock()))
+	go func() {
+		if err := server.Start(); err != nil {
+			t.Errorf("error start server %s", err.Error())
+		}
+	}()
+	defer server.Stop()
+
+	conn := dialServer(t, server)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	if _, err := conn.Write([]byte("SET 1 wuriyanto\r\n")); err != nil {
+		t.Fatalf("error write message %s", err.Error())
+	}
+
+	if reply, _ := reader.ReadString('\n'); reply != replies["OK"] {
+		t.Fatalf("command within max size should be processed, got %q", reply)
+	}
+
+	// server stop reading once limit is exceeded, so writing the rest may fail
+	go conn.Write([]byte("SET 2 " + strings.Repeat("a", 1024*1024) + "\r\n"))
+
+	if reply, _ := reader.ReadString('\n'); reply != ErrorCommandTooLarge {
+		t.Errorf("reply should be %q, got %q", ErrorCommandTooLarge, reply)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Error("connection should be closed after oversized command")
+	}
+
+	t.Run("should reject RESP headers claiming more than max size", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Protocol: ProtocolRESP, MaxCommandSize: 1024}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		for _, header := range []string{"*1000\r\n", "*3\r\n$3\r\nSET\r\n$1\r\n1\r\n$536870000\r\n"} {
+			conn := dialServer(t, server)
+			reader := bufio.NewReader(conn)
+
+			if _, err := conn.Write([]byte(header)); err != nil {
+				t.Fatalf("error write message %s", err.Error())
+			}
+
+			conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+			if reply, _ := reader.ReadString('\n'); reply != ErrorCommandTooLarge {
+				t.Errorf("header %q reply should be %q, got %q", header, ErrorCommandTooLarge, reply)
+			}
+			conn.Close()
+		}
+	})
+
+	t.Run("should not allocate claimed bulk length before it is received", func(t *testing.T) {
+		server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Protocol: ProtocolRESP}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+		defer server.Stop()
+
+		conn := dialServer(t, server)
+		defer conn.Close()
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		if _, err := conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\n1\r\n$536870000\r\nwuriyanto")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64*1024*1024 {
+			t.Errorf("claimed bulk length should not be allocated, allocated %d bytes", allocated)
+		}
+	})
+}
+
+func TestServerArrayLength(t *testing.T) {
+	for _, protocol := range []string{ProtocolKece, ProtocolRESP} {
+		server := NewServer(&Arguments{Network: "tcp", Host: "127.0.0.1", Port: "0", Protocol: protocol}, NewCommander(newStructureMock()))
+		go func() {
+			if err := server.Start(); err != nil {
+				t.Errorf("error start server %s", err.Error())
+			}
+		}()
+
+		conn := dialServer(t, server)
+		reader := bufio.NewReader(conn)
+
+		if _, err := conn.Write([]byte("*999999999999\r\n")); err != nil {
+			t.Fatalf("error write message %s", err.Error())
+		}
+
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		if reply, _ := reader.ReadString('\n'); reply != ErrorInvalidProtocol {
+			t.Errorf("%s reply should be %q, got %q", protocol, ErrorInvalidProtocol, reply)
+		}
+
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestServerGetNil(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := map[string][]struct {
+		message string
+		reply   string
+	}{
+		ProtocolKece: {
+			{message: "GET 1", reply: "(nil)" + crlf},
+			{message: `SET 1 ""`, reply: replies["OK"]},
+			{message: "GET 1", reply: crlf},
+		},
+		ProtocolRESP: {
+			{message: "*2\r\n$3\r\nGET\r\n$1\r\n2\r\n", reply: "$-1" + crlf},
+			{message: "*3\r\n$3\r\nSET\r\n$1\r\n2\r\n$0\r\n\r\n", reply: replies["OK"]},
+			{message: "*2\r\n$3\r\nGET\r\n$1\r\n2\r\n", reply: "$0" + crlf},
+		},
+	}
+
+	for protocol, protocolExpectations := range expectations {
+		server := NewServer(&Arguments{Protocol: protocol}, NewCommander(newStructureMock()))
+
+		for _, e := range protocolExpectations {
+			if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+				t.Errorf("%s reply of %q should be %q, got %q", protocol, e.message, e.reply, reply)
+			}
+
+			// empty bulk string is followed by CR/LF
+			if e.reply == "$0"+crlf {
+				if line, _ := reader.ReadString('\n'); line != crlf {
+					t.Errorf("empty bulk string should end with CR/LF, got %q", line)
+				}
+			}
+		}
+	}
+}
+
+func TestServerCopy(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "SETEX 1 100 wuriyanto", reply: replies["OK"]},
+		{message: "COPY 1 2", reply: "1" + crlf},
+		{message: "GET 1", reply: "wuriyanto" + crlf},
+		{message: "GET 2", reply: "wuriyanto" + crlf},
+		{message: "TTL 2", reply: "100" + crlf},
+		{message: "SET 3 agung", reply: replies["OK"]},
+		{message: "COPY 3 2", reply: "0" + crlf},
+		{message: "GET 2", reply: "wuriyanto" + crlf},
+		{message: "COPY 3 2 REPLACE", reply: "1" + crlf},
+		{message: "GET 2", reply: "agung" + crlf},
+		{message: "TTL 2", reply: "-1" + crlf},
+		{message: "COPY missing 4", reply: "0" + crlf},
+		{message: "COPY 1 1", reply: replies["ERROR"]},
+		{message: "COPY 1 4 KEEP", reply: ErrorInvalidOperation},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerObject(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	read := func(message string) string {
+		return processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)})
+	}
+
+	if reply := read("SET 1 wuriyanto"); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+
+	if reply := read("OBJECT IDLETIME 1"); reply != "0"+crlf {
+		t.Errorf("idle time of new key should be 0, got %q", reply)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// OBJECT itself doesn't reset idle time
+	for i := 0; i < 2; i++ {
+		if reply := read("OBJECT IDLETIME 1"); reply != "1"+crlf {
+			t.Errorf("idle time should grow to 1, got %q", reply)
+		}
+	}
+
+	before, _ := strconv.Atoi(strings.TrimSpace(read("OBJECT FREQ 1")))
+	if reply := read("GET 1"); reply != "wuriyanto"+crlf {
+		t.Fatalf("reply should be wuriyanto, got %q", reply)
+	}
+
+	if reply := read("OBJECT IDLETIME 1"); reply != "0"+crlf {
+		t.Errorf("idle time should be reset by GET, got %q", reply)
+	}
+
+	if after, _ := strconv.Atoi(strings.TrimSpace(read("OBJECT FREQ 1"))); after <= before {
+		t.Errorf("access count should grow after GET, got %d then %d", before, after)
+	}
+
+	if reply := read("OBJECT IDLETIME missing"); reply != replies["ERROR"] {
+		t.Errorf("reply of missing key should be ERROR, got %q", reply)
+	}
+
+	if reply := read("OBJECT ENCODING 1"); reply != ErrorInvalidOperation {
+		t.Errorf("reply of unknown subcommand should be %q, got %q", ErrorInvalidOperation, reply)
+	}
+}
+
+func TestServerRandomKey(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("RANDOMKEY")}); reply != crlf {
+		t.Errorf("reply of empty db should be empty, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SET 1 wuriyanto")}); reply != replies["OK"] {
+		t.Fatalf("reply should be OK, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("RANDOMKEY")}); reply != "1"+crlf {
+		t.Errorf("reply should be the only key, got %q", reply)
+	}
+
+	if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("RANDOMKEY 1")}); reply != errorWrongArity("RANDOMKEY").Error() {
+		t.Errorf("reply of RANDOMKEY with argument should be %q, got %q", errorWrongArity("RANDOMKEY").Error(), reply)
+	}
+}
+
+func TestServerWrongArity(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "SET 1", reply: "-ERR wrong number of arguments for 'SET'" + crlf},
+		{message: "*4\r\n$3\r\nSET\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\nb\r\n", reply: "-ERR wrong number of arguments for 'SET'" + crlf},
+		{message: "GET", reply: "-ERR wrong number of arguments for 'GET'" + crlf},
+		{message: "GET 1 2", reply: "-ERR wrong number of arguments for 'GET'" + crlf},
+		{message: "EXPIRE 1", reply: "-ERR wrong number of arguments for 'EXPIRE'" + crlf},
+		{message: "LRANGE 1 0 1 2", reply: "-ERR wrong number of arguments for 'LRANGE'" + crlf},
+		{message: "MSET 1 a 2", reply: "-ERR wrong number of arguments for 'MSET'" + crlf},
+		{message: "DBSIZE 1", reply: "-ERR wrong number of arguments for 'DBSIZE'" + crlf},
+		{message: "DEL", reply: "-ERR wrong number of arguments for 'DEL'" + crlf},
+		{message: "SET 1 a", reply: replies["OK"]},
+		{message: "GET 1", reply: "a" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerUnknownCommand(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "FOO 1", reply: "-ERR unknown command 'FOO'" + crlf},
+		{message: "FOO\x1b[31m 1", reply: "-ERR unknown command 'FOO?[31m'" + crlf},
+		{message: "*2\r\n$5\r\nF\r\nO\x00\r\n$1\r\n1\r\n", reply: "-ERR unknown command 'F??O?'" + crlf},
+		{message: strings.Repeat("A", 100), reply: "-ERR unknown command '" + strings.Repeat("A", maxUnknownCommandLen) + "'" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+}
+
+func TestServerMillisecondLifetime(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "PSETEX 1 0 wuriyanto", reply: replies["ERROR"]},
+		{message: "PSETEX 1 500 wuriyanto", reply: replies["OK"]},
+		{message: "GET 1", reply: "wuriyanto" + crlf},
+		{message: "SET 2 agung", reply: replies["OK"]},
+		{message: "PTTL 2", reply: "-1" + crlf},
+		{message: "PTTL missing", reply: "-2" + crlf},
+		{message: "PEXPIRE missing 500", reply: "0" + crlf},
+		{message: "PEXPIRE 2 500", reply: "1" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+
+	for _, key := range []string{"1", "2"} {
+		reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("PTTL " + key)})
+		ttl, err := strconv.Atoi(strings.TrimSpace(reply))
+		if err != nil || ttl <= 0 || ttl > 500 {
+			t.Errorf("PTTL of key %s should be within 500 milliseconds, got %q", key, reply)
+		}
+	}
+
+	time.Sleep(600 * time.Millisecond)
+
+	for _, key := range []string{"1", "2"} {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("EXISTS " + key)}); reply != "0"+crlf {
+			t.Errorf("key %s should be expired after 500 milliseconds, got %q", key, reply)
+		}
+	}
+}
+
+func TestServerLifetimeOverflow(t *testing.T) {
+	server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	client := &Client{ID: "001", Conn: serverConn}
+	reader := bufio.NewReader(clientConn)
+
+	// time.Duration hold at most 9223372036 seconds
+	expectations := []struct {
+		message string
+		reply   string
+	}{
+		{message: "SET 1 wuriyanto", reply: replies["OK"]},
+		{message: "EXPIRE 1 9300000000000", reply: ErrorInvalidArgument},
+		{message: "EXPIRE 1 -9300000000000", reply: ErrorInvalidArgument},
+		{message: "PEXPIRE 1 9300000000000000", reply: ErrorInvalidArgument},
+		{message: "SETEX 2 9300000000000 wuriyanto", reply: ErrorInvalidArgument},
+		{message: "PSETEX 2 9300000000000000 wuriyanto", reply: ErrorInvalidArgument},
+		{message: "RESTORE 2 9300000000000 blob", reply: ErrorInvalidArgument},
+		{message: "SET 2 wuriyanto 9300000000000", reply: ErrorInvalidArgument},
+		{message: "EXISTS 2", reply: "0" + crlf},
+		{message: "TTL 1", reply: "-1" + crlf},
+		{message: "EXPIRE 1 9200000000", reply: "1" + crlf},
+	}
+
+	for _, e := range expectations {
+		if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)}); reply != e.reply {
+			t.Errorf("reply of %s should be %q, got %q", e.message, e.reply, reply)
+		}
+	}
+
+	reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("TTL 1")})
+	if ttl, err := strconv.Atoi(strings.TrimSpace(reply)); err != nil || ttl <= 0 {
+		t.Errorf("lifetime within range should be set, got %q", reply)
+	}
+}
+
+// BenchmarkServerLRange compare reply of 100 elements LRANGE written at once with a write per element
+func BenchmarkServerLRange(b *testing.B) {
+	ctx := context.Background()
+
+	cmd := NewCommander(newStructureMock())
+	server := NewServer(&Arguments{}, cmd)
+
+	elements := make([][]byte, 0, 100)
+	for i := 0; i < 100; i++ {
+		elements = append(elements, []byte(fmt.Sprintf("element:%d", i)))
+	}
+
+	if _, err := cmd.Push(ctx, []byte("jobs"), elements, false); err != nil {
+		b.Fatal(err.Error())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("error listen %s", err.Error())
+	}
+	defer listener.Close()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatalf("error dial %s", err.Error())
+	}
+	defer clientConn.Close()
+
+	serverConn, err := listener.Accept()
+	if err != nil {
+		b.Fatalf("error accept %s", err.Error())
+	}
+	defer serverConn.Close()
+
+	go io.Copy(ioutil.Discard, clientConn)
+
+	client := &Client{ID: "001", Conn: serverConn}
+
+	b.Run("buffered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			server.processMessage(&ClientMessage{Client: client, Message: []byte("LRANGE jobs 0 -1")})
+		}
+	})
+
+	b.Run("unbuffered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			values, err := cmd.LRange(ctx, []byte("jobs"), 0, -1)
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+
+			for _, value := range values {
+				if err := server.write(client, server.protocol.Bulk(value)); err != nil {
+					b.Fatal(err.Error())
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package kece
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// slowLog keep the last commands whose processing exceeds SlowLogThreshold, the oldest entry is overwritten once it is full
+type slowLog struct {
+	entries []slowLogEntry
+	next    int
+	full    bool
+	id      int64
+	sync.Mutex
+}
+
+type slowLogEntry struct {
+	id       int64
+	start    time.Time
+	duration time.Duration
+	client   string
+	command  string
+	key      string
+}
+
+func newSlowLog(size int) *slowLog {
+	return &slowLog{entries: make([]slowLogEntry, size)}
+}
+
+// add will keep entry as the newest one and number it
+func (l *slowLog) add(entry slowLogEntry) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.entries) == 0 {
+		return
+	}
+
+	l.id++
+	entry.id = l.id
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	l.full = l.full || l.next == 0
+}
+
+// get will return a line per entry from the newest, at most n entries are returned
+func (l *slowLog) get(n int) [][]byte {
+	l.Lock()
+	defer l.Unlock()
+
+	size := l.next
+	if l.full {
+		size = len(l.entries)
+	}
+
+	if n > size {
+		n = size
+	}
+
+	lines := make([][]byte, 0, n)
+	for i := 1; i <= n; i++ {
+		entry := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		lines = append(lines, []byte(fmt.Sprintf("id=%d time=%d duration_us=%d client=%s command=%s key=%s",
+			entry.id, entry.start.Unix(), int64(entry.duration/time.Microsecond), entry.client, entry.command, entry.key)))
+	}
+	return lines
+}
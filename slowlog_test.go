@@ -0,0 +1,56 @@
+package kece
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLog(t *testing.T) {
+	t.Run("should return the newest entries and overwrite the oldest once it is full", func(t *testing.T) {
+		log := newSlowLog(3)
+		for i := 0; i < 5; i++ {
+			log.add(slowLogEntry{start: time.Now(), command: "GET", key: fmt.Sprintf("%d", i)})
+		}
+
+		lines := log.get(10)
+		if len(lines) != 3 {
+			t.Fatalf("slow log should keep 3 entries, got %d", len(lines))
+		}
+
+		for i, id := range []int{5, 4, 3} {
+			if !strings.HasPrefix(string(lines[i]), fmt.Sprintf("id=%d ", id)) {
+				t.Errorf("entry %d should have id %d, got %q", i, id, lines[i])
+			}
+		}
+
+		if lines := log.get(1); len(lines) != 1 || !strings.HasSuffix(string(lines[0]), "key=4") {
+			t.Errorf("slow log should return the newest entry, got %q", lines)
+		}
+	})
+
+	t.Run("should keep command exceeding threshold for SLOWLOG GET", func(t *testing.T) {
+		server := NewServer(&Arguments{DebugEnabled: true, SlowLogThreshold: 100 * time.Millisecond}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		// PING is not slow, so DEBUG SLEEP is the first entry
+		for _, message := range []string{"PING", "DEBUG SLEEP 0.2"} {
+			if reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(message)}); strings.HasPrefix(reply, "-") {
+				t.Fatalf("reply of %s should be success, got %q", message, reply)
+			}
+		}
+
+		reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SLOWLOG GET")})
+		if !strings.HasPrefix(reply, "id=1 ") || !strings.Contains(reply, "client=001 command=DEBUG key=SLEEP") {
+			t.Errorf("SLOWLOG GET should return DEBUG SLEEP, got %q", reply)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package kece
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotEntry struct, a single key stored in snapshot file
+type SnapshotEntry struct {
+	Key   []byte
+	Value []byte
+	// ExpiredAt is deadline of key, zero means key has no lifetime
+	ExpiredAt time.Time
+
+	// DB is index of database of key
+	DB int
+
+	// Type, List and Hash are set if value is not a string
+	Type string
+	List [][]byte
+	Hash map[string][]byte
+}
+
+// writeSnapshot will encode entries to path. Entries are written to temporary file first
+// then renamed, so crash in the middle of writing doesn't corrupt the old snapshot
+func writeSnapshot(path string, entries []SnapshotEntry) error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"))
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(tmp).Encode(entries); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// make sure content is on disk before rename
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readSnapshot will decode entries from path, missing snapshot file is not an error
+func readSnapshot(path string) ([]SnapshotEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []SnapshotEntry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,174 @@
+package kece
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "kece-snapshot")
+	if err != nil {
+		t.Fatalf("error create temp dir %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kece.snapshot")
+
+	t.Run("should keep keys after restart", func(t *testing.T) {
+		cmd := NewCommander(newStructureMock())
+		server := NewServer(&Arguments{SnapshotPath: path}, cmd)
+
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("2"), []byte("agung"), time.Hour); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("3"), []byte("expired"), time.Millisecond); err != nil {
+			t.Fatal(err.Error())
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if err := server.saveSnapshot(); err != nil {
+			t.Fatalf("error save snapshot %s", err.Error())
+		}
+
+		restartedCmd := NewCommander(newStructureMock())
+		restarted := NewServer(&Arguments{SnapshotPath: path}, restartedCmd)
+
+		if err := restarted.loadSnapshot(); err != nil {
+			t.Fatalf("error load snapshot %s", err.Error())
+		}
+
+		value, err := restartedCmd.Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(value.Value) != "wuriyanto" {
+			t.Error("key 1 should survive restart")
+		}
+
+		ttl, _ := restartedCmd.TTL(ctx, []byte("TTL"), []byte("2"))
+		if ttl <= 0 || ttl > 3600 {
+			t.Errorf("lifetime of key 2 should survive restart, got ttl %d", ttl)
+		}
+
+		if _, err := restartedCmd.Get(ctx, []byte("GET"), []byte("3")); err == nil {
+			t.Error("expired key should not be loaded")
+		}
+	})
+
+	t.Run("should keep keys in their database after restart", func(t *testing.T) {
+		databasesDir, err := ioutil.TempDir("", "kece-snapshot")
+		if err != nil {
+			t.Fatalf("error create temp dir %s", err.Error())
+		}
+		defer os.RemoveAll(databasesDir)
+
+		databasesPath := filepath.Join(databasesDir, "kece.snapshot")
+		server := NewServer(&Arguments{SnapshotPath: databasesPath, Databases: 2}, NewCommander(newStructureMock()))
+
+		if _, err := server.databases[1].Set(ctx, []byte("SET"), []byte("1"), []byte("agung"), 0); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := server.saveSnapshot(); err != nil {
+			t.Fatalf("error save snapshot %s", err.Error())
+		}
+
+		restartedCmd := NewCommander(newStructureMock())
+		restarted := NewServer(&Arguments{SnapshotPath: databasesPath, Databases: 2}, restartedCmd)
+
+		if err := restarted.loadSnapshot(); err != nil {
+			t.Fatalf("error load snapshot %s", err.Error())
+		}
+
+		if _, err := restartedCmd.Get(ctx, []byte("GET"), []byte("1")); err == nil {
+			t.Error("key of database 1 should not be loaded into database 0")
+		}
+
+		value, err := restarted.databases[1].Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(value.Value) != "agung" {
+			t.Error("key of database 1 should survive restart")
+		}
+	})
+
+	t.Run("should not leave temporary file after writing snapshot", func(t *testing.T) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("error read dir %s", err.Error())
+		}
+
+		if len(files) != 1 || files[0].Name() != "kece.snapshot" {
+			t.Errorf("dir should only contain snapshot file, got %d files", len(files))
+		}
+	})
+
+	t.Run("should write snapshot on SAVE command", func(t *testing.T) {
+		savePath := filepath.Join(dir, "save.snapshot")
+		server := NewServer(&Arguments{HashIterations: testHashIterations, Auth: "my-secret", SnapshotPath: savePath}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		expectations := []struct {
+			message string
+			reply   string
+		}{
+			{message: "SAVE", reply: ErrorInvalidAuth},
+			{message: "AUTH my-secret", reply: replies["OK"]},
+			{message: "SET 1 wuriyanto", reply: replies["OK"]},
+			{message: "SAVE", reply: replies["OK"]},
+		}
+
+		for _, e := range expectations {
+			reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte(e.message)})
+			if reply != e.reply {
+				t.Errorf("reply of %q should be %q, got %q", e.message, e.reply, reply)
+			}
+		}
+
+		entries, err := readSnapshot(savePath)
+		if err != nil {
+			t.Fatalf("error read snapshot %s", err.Error())
+		}
+
+		if len(entries) != 1 || string(entries[0].Key) != "1" || string(entries[0].Value) != "wuriyanto" {
+			t.Errorf("snapshot should contain key 1, got %d entries", len(entries))
+		}
+
+		os.Remove(savePath)
+	})
+
+	t.Run("should reply error on SAVE if snapshot is not configured", func(t *testing.T) {
+		server := NewServer(&Arguments{}, NewCommander(newStructureMock()))
+
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+
+		client := &Client{ID: "001", Conn: serverConn}
+		reader := bufio.NewReader(clientConn)
+
+		reply := processAndRead(t, server, reader, &ClientMessage{Client: client, Message: []byte("SAVE")})
+		if reply != replies["ERROR"] {
+			t.Errorf("reply of SAVE should be %q, got %q", replies["ERROR"], reply)
+		}
+	})
+
+	t.Run("should success load missing snapshot file", func(t *testing.T) {
+		entries, err := readSnapshot(filepath.Join(dir, "missing.snapshot"))
+		if err != nil || entries != nil {
+			t.Error("missing snapshot file should be treated as empty")
+		}
+	})
+}
@@ -37,7 +37,7 @@ func (n *node) insert(newNode *node) {
 		n.left.insert(newNode)
 
 	} else {
-		n.Value = newNode.Value
+		n.Schema = newNode.Schema
 	}
 }
 
@@ -112,9 +112,7 @@ func (n *node) delete(key string, parent *node) {
 			return
 		}
 		replacement := n.left.findBiggestNode()
-		n.Key = replacement.Key
-		n.Value = replacement.Value
-		n.Timestamp = replacement.Timestamp
+		n.Schema = replacement.Schema
 		replacement.delete(string(replacement.Key), n)
 	}
 }
@@ -138,6 +136,16 @@ func (n *node) printPreOrder() {
 	}
 }
 
+// collectKeys append keys with traverse tree left->root->right, so keys are ordered
+func (n *node) collectKeys(keys [][]byte) [][]byte {
+	if n == nil {
+		return keys
+	}
+	keys = n.left.collectKeys(keys)
+	keys = append(keys, n.Key)
+	return n.right.collectKeys(keys)
+}
+
 /*
 	------------------------------------
 */
@@ -145,6 +153,7 @@ func (n *node) printPreOrder() {
 // BST Binary Search Tree
 type BST struct {
 	root *node
+	size int
 }
 
 // NewBST init new BST
@@ -155,24 +164,35 @@ func NewBST() kece.DataStructure {
 
 // Insert node with new key and value
 func (tree *BST) Insert(key, value []byte) *kece.Schema {
-	newSchema := &kece.Schema{Key: key, Value: value, Timestamp: time.Now()}
+	return tree.InsertSchema(&kece.Schema{Key: key, Value: value})
+}
+
+// InsertSchema insert node with schema of any data type
+func (tree *BST) InsertSchema(schema *kece.Schema) *kece.Schema {
+	newSchema := *schema
+	newSchema.Timestamp = time.Now()
 	newNode := new(node)
-	newNode.Key = newSchema.Key
-	newNode.Value = newSchema.Value
-	newNode.Timestamp = newSchema.Timestamp
+	newNode.Schema = newSchema
+	key := newSchema.Key
 	if tree.root == nil {
 		tree.root = newNode
-		return newSchema
+		tree.size++
+		return &newSchema
+	}
+
+	if tree.root.searchNode(string(key)) == nil {
+		tree.size++
 	}
 	tree.root.insert(newNode)
-	return newSchema
+	return &newSchema
 }
 
 // Search node based on key
 func (tree *BST) Search(key []byte) (*kece.Schema, error) {
 	resNode := tree.root.searchNode(string(key))
 	if resNode != nil {
-		return &kece.Schema{Key: resNode.Key, Value: resNode.Value, Timestamp: resNode.Timestamp}, nil
+		result := resNode.Schema
+		return &result, nil
 	}
 	return nil, errors.New(kece.ErrorEmptyValue)
 }
@@ -182,14 +202,28 @@ func (tree *BST) Delete(key []byte) error {
 	if tree.root == nil {
 		return errors.New(kece.ErrorEmptyValue)
 	}
+	if tree.root.searchNode(string(key)) == nil {
+		return errors.New(kece.ErrorEmptyValue)
+	}
 	tmpParent := &node{right: tree.root}
 	tree.root.delete(string(key), tmpParent)
-	if tmpParent.right == nil {
-		tree.root = nil
-	}
+	tree.size--
+
+	// root may be replaced by its child
+	tree.root = tmpParent.right
 	return nil
 }
 
+// Keys return all keys in tree ordered ascending
+func (tree *BST) Keys() [][]byte {
+	return tree.root.collectKeys(nil)
+}
+
+// Len return number of nodes in tree
+func (tree *BST) Len() int {
+	return tree.size
+}
+
 // Print want show in pretty tree
 func (tree *BST) Print() {
 	tree.root.printPreOrder()
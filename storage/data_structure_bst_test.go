@@ -3,6 +3,8 @@ package storage
 
 import (
 	"testing"
+
+	"github.com/wuriyanto48/kece"
 )
 
 func TestNewBST(t *testing.T) {
@@ -77,3 +79,76 @@ func TestBST_Delete(t *testing.T) {
 		t.Errorf("expected a, result is %s", string(leftRoot.Key))
 	}
 }
+
+func TestBST_Keys(t *testing.T) {
+	bst := new(BST)
+	bst.Insert([]byte("d"), []byte("ini d"))
+	bst.Insert([]byte("b"), []byte("ini b"))
+	bst.Insert([]byte("c"), []byte("ini c"))
+	bst.Insert([]byte("e"), []byte("ini e"))
+	bst.Insert([]byte("a"), []byte("ini a"))
+
+	keys := bst.Keys()
+	expected := []string{"a", "b", "c", "d", "e"}
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), len(keys))
+	}
+
+	for i, key := range keys {
+		if string(key) != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], string(key))
+		}
+	}
+}
+
+func TestBST_Len(t *testing.T) {
+	bst := new(BST)
+	bst.Insert([]byte("d"), []byte("ini d"))
+	bst.Insert([]byte("b"), []byte("ini b"))
+	bst.Insert([]byte("d"), []byte("ini d lagi"))
+
+	if bst.Len() != 2 {
+		t.Errorf("expected 2, got %d", bst.Len())
+	}
+
+	err := bst.Delete([]byte("d"))
+	if err != nil {
+		t.Errorf("Expected %v, got %v", nil, err)
+	}
+
+	if string(bst.root.Key) != "b" {
+		t.Errorf("root should be replaced by its child, got %s", string(bst.root.Key))
+	}
+
+	err = bst.Delete([]byte("x"))
+	if err == nil {
+		t.Errorf("delete missing key should return error")
+	}
+
+	if bst.Len() != 1 {
+		t.Errorf("expected 1, got %d", bst.Len())
+	}
+}
+
+func TestBST_InsertSchema(t *testing.T) {
+	bst := new(BST)
+	bst.Insert([]byte("b"), []byte("ini b"))
+	bst.InsertSchema(&kece.Schema{Key: []byte("a"), Type: kece.TypeList, List: [][]byte{[]byte("satu"), []byte("dua")}})
+	bst.Insert([]byte("c"), []byte("ini c"))
+
+	result, err := bst.Search([]byte("a"))
+	if err != nil {
+		t.Fatalf("Expected %v, got %v", nil, err)
+	}
+
+	if result.DataType() != kece.TypeList || len(result.List) != 2 {
+		t.Errorf("expected list of 2 elements, got %s of %d elements", result.DataType(), len(result.List))
+	}
+
+	// replace list with string
+	bst.Insert([]byte("a"), []byte("ini a"))
+	result, _ = bst.Search([]byte("a"))
+	if result.DataType() != kece.TypeString || result.List != nil {
+		t.Errorf("expected string, got %s", result.DataType())
+	}
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wuriyanto48/kece"
+)
+
+// diskRecord is a single write in data file, a JSON object per line. Schema is nil if key is deleted
+type diskRecord struct {
+	Key    []byte
+	Schema *kece.Schema
+}
+
+// disk keep every key in memory like hashMap, every write is appended to data file
+// so keyspace survive restart without snapshot. Data file is compacted every time it is opened
+type disk struct {
+	db   map[string]*kece.Schema
+	path string
+	file *os.File
+	enc  *json.Encoder
+
+	// err is the first failed write, Insert can't return it so it is returned by Delete and Close
+	err error
+	mu  sync.Mutex
+}
+
+// NewDisk open data file in path, it is created if it doesn't exist yet
+func NewDisk(path string) (kece.DataStructure, error) {
+	ds := &disk{db: make(map[string]*kece.Schema), path: path}
+	if err := ds.load(); err != nil {
+		return nil, err
+	}
+
+	if err := ds.compact(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.file = file
+	ds.enc = json.NewEncoder(file)
+	return ds, nil
+}
+
+// load will replay every record of data file, missing file is an empty keyspace
+func (d *disk) load() error {
+	file, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var record diskRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+
+		// the last record may be written partially if process is killed, every record before it is kept
+		if err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if record.Schema == nil {
+			delete(d.db, string(record.Key))
+			continue
+		}
+		d.db[string(record.Key)] = record.Schema
+	}
+}
+
+// compact will rewrite data file with a record per key, it is written to temp file first
+// so data file is never left half written
+func (d *disk) compact() error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(d.path), "."+filepath.Base(d.path)+".tmp"))
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(writer)
+	for key, schema := range d.db {
+		if err := enc.Encode(diskRecord{Key: []byte(key), Schema: schema}); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// make sure content is on disk before rename
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
+
+// write will append record to data file, only the first error is kept
+func (d *disk) write(record diskRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	d.err = d.enc.Encode(record)
+}
+
+// Insert new data to storage with new key and value
+func (d *disk) Insert(key, value []byte) *kece.Schema {
+	newData := &kece.Schema{Key: key, Value: value, Timestamp: time.Now()}
+	d.db[string(key)] = newData
+	d.write(diskRecord{Key: key, Schema: newData})
+	return newData
+}
+
+// InsertSchema store schema of any data type
+func (d *disk) InsertSchema(schema *kece.Schema) *kece.Schema {
+	newData := *schema
+	newData.Timestamp = time.Now()
+	d.db[string(newData.Key)] = &newData
+	d.write(diskRecord{Key: newData.Key, Schema: &newData})
+	return &newData
+}
+
+// Search data based on key
+func (d *disk) Search(key []byte) (*kece.Schema, error) {
+	value, ok := d.db[string(key)]
+	if !ok {
+		return nil, errors.New(kece.ErrorEmptyValue)
+	}
+	return value, nil
+}
+
+// Delete data based on key
+func (d *disk) Delete(key []byte) error {
+	_, ok := d.db[string(key)]
+	if !ok {
+		return errors.New(kece.ErrorEmptyValue)
+	}
+	delete(d.db, string(key))
+	d.write(diskRecord{Key: key})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Keys return all keys in storage
+func (d *disk) Keys() [][]byte {
+	keys := make([][]byte, 0, len(d.db))
+	for _, value := range d.db {
+		keys = append(keys, value.Key)
+	}
+	return keys
+}
+
+// Len return number of keys in storage
+func (d *disk) Len() int {
+	return len(d.db)
+}
+
+// Close will flush data file to disk and close it, the first failed write is returned if any
+func (d *disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.file.Sync(); err != nil {
+		d.file.Close()
+		return err
+	}
+
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	return d.err
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wuriyanto48/kece"
+)
+
+func TestDiskStorage(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "kece-disk")
+	if err != nil {
+		t.Fatalf("error create temp dir %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kece.data")
+
+	t.Run("should keep keys after data file is reopened", func(t *testing.T) {
+		ds, err := NewDisk(path)
+		if err != nil {
+			t.Fatalf("error open disk %s", err.Error())
+		}
+
+		ds.Insert([]byte("1"), []byte("wuriyanto"))
+		ds.Insert([]byte("2"), []byte("agung"))
+		ds.Insert([]byte("1"), []byte("wuriyanto 48"))
+		ds.InsertSchema(&kece.Schema{Key: []byte("hash"), Type: kece.TypeHash, Hash: map[string][]byte{"name": []byte("kece")}})
+
+		if err := ds.Delete([]byte("2")); err != nil {
+			t.Error(err.Error())
+		}
+
+		if err := ds.(io.Closer).Close(); err != nil {
+			t.Fatalf("error close disk %s", err.Error())
+		}
+
+		reopened, err := NewDisk(path)
+		if err != nil {
+			t.Fatalf("error reopen disk %s", err.Error())
+		}
+		defer reopened.(io.Closer).Close()
+
+		if reopened.Len() != 2 {
+			t.Errorf("reopened disk should have 2 keys, got %d", reopened.Len())
+		}
+
+		value, err := reopened.Search([]byte("1"))
+		if err != nil || !bytes.Equal(value.Value, []byte("wuriyanto 48")) {
+			t.Error("the last value of key 1 should be kept")
+		}
+
+		if _, err := reopened.Search([]byte("2")); err == nil {
+			t.Error("deleted key 2 should not be present")
+		}
+
+		value, err = reopened.Search([]byte("hash"))
+		if err != nil || value.DataType() != kece.TypeHash || string(value.Hash["name"]) != "kece" {
+			t.Error("hash should be kept")
+		}
+	})
+
+	t.Run("should ignore partially written last record", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatalf("error open data file %s", err.Error())
+		}
+
+		if _, err := f.WriteString(`{"Key":"MQ==","Sch`); err != nil {
+			t.Fatalf("error write data file %s", err.Error())
+		}
+		f.Close()
+
+		ds, err := NewDisk(path)
+		if err != nil {
+			t.Fatalf("error open disk %s", err.Error())
+		}
+		defer ds.(io.Closer).Close()
+
+		if ds.Len() != 2 {
+			t.Errorf("disk should have 2 keys, got %d", ds.Len())
+		}
+	})
+
+	t.Run("should persist keys written by commander", func(t *testing.T) {
+		commanderPath := filepath.Join(dir, "commander.data")
+		ds, err := NewDisk(commanderPath)
+		if err != nil {
+			t.Fatalf("error open disk %s", err.Error())
+		}
+
+		cmd := kece.NewCommander(ds)
+		if _, err := cmd.Set(ctx, []byte("SET"), []byte("1"), []byte("wuriyanto"), 0); err != nil {
+			t.Error(err.Error())
+		}
+
+		if _, err := cmd.Push(ctx, []byte("jobs"), [][]byte{[]byte("a"), []byte("b")}, false); err != nil {
+			t.Error(err.Error())
+		}
+
+		if err := ds.(io.Closer).Close(); err != nil {
+			t.Fatalf("error close disk %s", err.Error())
+		}
+
+		reopened, err := NewDisk(commanderPath)
+		if err != nil {
+			t.Fatalf("error reopen disk %s", err.Error())
+		}
+		defer reopened.(io.Closer).Close()
+
+		cmd = kece.NewCommander(reopened)
+		value, err := cmd.Get(ctx, []byte("GET"), []byte("1"))
+		if err != nil || string(value.Value) != "wuriyanto" {
+			t.Error("key 1 should be present after reopen")
+		}
+
+		if length, _ := cmd.LLen(ctx, []byte("jobs")); length != 2 {
+			t.Errorf("list should have 2 elements after reopen, got %d", length)
+		}
+	})
+}
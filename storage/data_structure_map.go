@@ -25,6 +25,14 @@ func (h *hashMap) Insert(key, value []byte) *kece.Schema {
 	return newData
 }
 
+// InsertSchema store schema of any data type
+func (h *hashMap) InsertSchema(schema *kece.Schema) *kece.Schema {
+	newData := *schema
+	newData.Timestamp = time.Now()
+	h.db[string(newData.Key)] = &newData
+	return &newData
+}
+
 // Search data based on key
 func (h *hashMap) Search(key []byte) (*kece.Schema, error) {
 	value, ok := h.db[string(key)]
@@ -43,3 +51,17 @@ func (h *hashMap) Delete(key []byte) error {
 	delete(h.db, string(key))
 	return nil
 }
+
+// Keys return all keys in storage
+func (h *hashMap) Keys() [][]byte {
+	keys := make([][]byte, 0, len(h.db))
+	for _, value := range h.db {
+		keys = append(keys, value.Key)
+	}
+	return keys
+}
+
+// Len return number of keys in storage
+func (h *hashMap) Len() int {
+	return len(h.db)
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"bytes"
 	"testing"
+
+	"github.com/wuriyanto48/kece"
 )
 
 func TestHashMapStorage(t *testing.T) {
@@ -36,6 +38,31 @@ func TestHashMapStorage(t *testing.T) {
 		}
 	})
 
+	t.Run("should success Keys from db", func(t *testing.T) {
+		keys := cmd.Keys()
+
+		if len(keys) != 1 || string(keys[0]) != "1" {
+			t.Error("keys should contain inserted key")
+		}
+	})
+
+	t.Run("should success InsertSchema of list to db", func(t *testing.T) {
+		cmd.InsertSchema(&kece.Schema{Key: []byte("list"), Type: kece.TypeList, List: [][]byte{[]byte("wuriyanto")}})
+
+		value, err := cmd.Search([]byte("list"))
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		if value.DataType() != kece.TypeList || len(value.List) != 1 {
+			t.Error("value should be list of 1 element")
+		}
+
+		if err := cmd.Delete([]byte("list")); err != nil {
+			t.Error(err.Error())
+		}
+	})
+
 	t.Run("should success DELETE value from db", func(t *testing.T) {
 		key := []byte("1")
 